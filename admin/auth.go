@@ -0,0 +1,54 @@
+package admin
+
+import (
+	"context"
+	"crypto/subtle"
+	"net/http"
+)
+
+// anonymousActor is recorded in the audit table for changes made without an actor in the
+// request context, see WithActor.
+const anonymousActor = "anonymous"
+
+type actorKey struct{}
+
+// Middleware wraps the admin handler, e.g. to authenticate requests before they reach it. A
+// middleware that authenticates a request should use WithActor to record who made it.
+type Middleware func(http.Handler) http.Handler
+
+// WithActor returns a copy of ctx with the actor that is making a request, which is recorded in
+// the audit table for any retries that the request changes.
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// ActorFromContext returns the actor set by WithActor, or "anonymous" if there is none.
+func ActorFromContext(ctx context.Context) string {
+	if actor, ok := ctx.Value(actorKey{}).(string); ok && actor != "" {
+		return actor
+	}
+	return anonymousActor
+}
+
+// BasicAuth returns a middleware that requires requests to authenticate with HTTP basic
+// authentication, using one of the given usernames and passwords. The username is used as the
+// actor of the request.
+func BasicAuth(realm string, credentials map[string]string) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			user, pass, ok := r.BasicAuth()
+			if !ok || !validCredentials(credentials, user, pass) {
+				w.Header().Set("WWW-Authenticate", `Basic realm="`+realm+`"`)
+				writeError(w, http.StatusUnauthorized, "unauthorized")
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(WithActor(r.Context(), user)))
+		})
+	}
+}
+
+func validCredentials(credentials map[string]string, user, pass string) bool {
+	expected, ok := credentials[user]
+	return ok && subtle.ConstantTimeCompare([]byte(expected), []byte(pass)) == 1
+}
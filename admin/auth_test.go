@@ -0,0 +1,60 @@
+package admin
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestActorFromContext(t *testing.T) {
+	if got := ActorFromContext(context.Background()); got != anonymousActor {
+		t.Errorf("expected the anonymous actor without one in the context, but got '%s'", got)
+	}
+
+	if got := ActorFromContext(WithActor(context.Background(), "jane")); got != "jane" {
+		t.Errorf("expected actor 'jane', but got '%s'", got)
+	}
+}
+
+func TestBasicAuth(t *testing.T) {
+	var actor string
+	h := BasicAuth("retries", map[string]string{"jane": "secret"})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		actor = ActorFromContext(r.Context())
+	}))
+
+	tests := []struct {
+		name       string
+		user, pass string
+		noAuth     bool
+		wantCode   int
+	}{
+		{name: "valid credentials", user: "jane", pass: "secret", wantCode: http.StatusOK},
+		{name: "wrong password", user: "jane", pass: "guess", wantCode: http.StatusUnauthorized},
+		{name: "unknown user", user: "john", pass: "secret", wantCode: http.StatusUnauthorized},
+		{name: "no credentials", noAuth: true, wantCode: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			actor = ""
+			req := httptest.NewRequest(http.MethodGet, "/stats", nil)
+			if !tt.noAuth {
+				req.SetBasicAuth(tt.user, tt.pass)
+			}
+
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantCode {
+				t.Errorf("expected status %d, but got %d", tt.wantCode, rec.Code)
+			}
+			if tt.wantCode == http.StatusOK && actor != tt.user {
+				t.Errorf("expected actor '%s', but got '%s'", tt.user, actor)
+			}
+			if tt.wantCode == http.StatusUnauthorized && rec.Header().Get("WWW-Authenticate") != `Basic realm="retries"` {
+				t.Errorf("unexpected WWW-Authenticate header '%s'", rec.Header().Get("WWW-Authenticate"))
+			}
+		})
+	}
+}
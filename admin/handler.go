@@ -0,0 +1,346 @@
+// Package admin provides an http.Handler that exposes the retry database as a JSON API, so that
+// services using database retries can inspect and operate their retries and dead letters.
+package admin
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/inviqa/kafka-consumer-go/data/retry"
+	"github.com/inviqa/kafka-consumer-go/data/retry/model"
+	"github.com/inviqa/kafka-consumer-go/log"
+)
+
+const (
+	// maxRequestBodySize limits the size of request bodies, in bytes.
+	maxRequestBodySize = 1 << 20
+	// maxFilterIDs limits the number of IDs in a dead-letter filter, as they are all locked in
+	// a single transaction, and each is a query parameter.
+	maxFilterIDs = 1000
+)
+
+// Options configures the admin handler.
+type Options struct {
+	// Middleware is applied to every request, with the first middleware being the outermost.
+	// Use it to authenticate requests, see BasicAuth.
+	Middleware []Middleware
+	// Logger is used to log errors from the retry database, which are not included in responses.
+	Logger log.StructuredLogger
+}
+
+type retryManager interface {
+	List(ctx context.Context, filter model.ListFilter) ([]model.Retry, error)
+	Get(ctx context.Context, id int64) (model.Retry, error)
+	RequeueDeadLettered(ctx context.Context, filter model.DeadLetterFilter, actor string) (int64, error)
+	PurgeDeadLettered(ctx context.Context, filter model.DeadLetterFilter, actor string) (int64, error)
+	RetryNow(ctx context.Context, topic string, ids []int64, actor string) (int64, error)
+	Summary(ctx context.Context) ([]model.TopicSummary, error)
+	SequenceSummary(ctx context.Context) ([]model.SequenceSummary, error)
+}
+
+type handler struct {
+	retries retryManager
+	logger  log.StructuredLogger
+}
+
+// NewHandler returns an http.Handler that serves the admin API for the retries managed by m.
+// Paths are relative to the root of the handler, so use http.StripPrefix to mount it under a
+// prefix. The routes are:
+//
+//	GET    /retries                     list retries, filtered by topic, state, attempts and limit
+//	GET    /retries/{id}                get a retry, with its headers and payload
+//	DELETE /retries/{id}                delete a dead-lettered retry
+//	POST   /retries/{id}/requeue        requeue a dead-lettered retry
+//	POST   /retries/{id}/retry-now      make a waiting retry due straight away
+//	POST   /deadletters/requeue         requeue the dead-lettered retries matching a filter
+//	POST   /deadletters/purge           delete the dead-lettered retries matching a filter
+//	GET    /stats                       count retries in each state, by topic and by sequence
+//
+// Requests are not authenticated unless a middleware that does so is given in opts.
+func NewHandler(m *retry.Manager, opts Options) http.Handler {
+	return newHandler(m, opts)
+}
+
+func newHandler(m retryManager, opts Options) http.Handler {
+	if opts.Logger == nil {
+		opts.Logger = log.NullLogger{}
+	}
+
+	var h http.Handler = &handler{retries: m, logger: opts.Logger}
+	for i := len(opts.Middleware) - 1; i >= 0; i-- {
+		h = opts.Middleware[i](h)
+	}
+
+	return h
+}
+
+func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+
+	switch {
+	case len(parts) == 1 && parts[0] == "retries":
+		h.route(w, r, map[string]http.HandlerFunc{http.MethodGet: h.list})
+	case len(parts) == 1 && parts[0] == "stats":
+		h.route(w, r, map[string]http.HandlerFunc{http.MethodGet: h.stats})
+	case len(parts) == 2 && parts[0] == "deadletters" && parts[1] == "requeue":
+		h.route(w, r, map[string]http.HandlerFunc{http.MethodPost: h.requeueDeadLetters})
+	case len(parts) == 2 && parts[0] == "deadletters" && parts[1] == "purge":
+		h.route(w, r, map[string]http.HandlerFunc{http.MethodPost: h.purgeDeadLetters})
+	case len(parts) >= 2 && parts[0] == "retries":
+		h.routeRetry(w, r, parts[1:])
+	default:
+		writeError(w, http.StatusNotFound, "not found")
+	}
+}
+
+func (h *handler) routeRetry(w http.ResponseWriter, r *http.Request, parts []string) {
+	id, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil || id <= 0 {
+		writeError(w, http.StatusNotFound, "not found")
+		return
+	}
+
+	switch {
+	case len(parts) == 1:
+		h.route(w, r, map[string]http.HandlerFunc{
+			http.MethodGet:    func(w http.ResponseWriter, r *http.Request) { h.get(w, r, id) },
+			http.MethodDelete: func(w http.ResponseWriter, r *http.Request) { h.delete(w, r, id) },
+		})
+	case len(parts) == 2 && parts[1] == "requeue":
+		h.route(w, r, map[string]http.HandlerFunc{
+			http.MethodPost: func(w http.ResponseWriter, r *http.Request) { h.requeue(w, r, id) },
+		})
+	case len(parts) == 2 && parts[1] == "retry-now":
+		h.route(w, r, map[string]http.HandlerFunc{
+			http.MethodPost: func(w http.ResponseWriter, r *http.Request) { h.retryNow(w, r, id) },
+		})
+	default:
+		writeError(w, http.StatusNotFound, "not found")
+	}
+}
+
+// route calls the handler for the method of the request, or responds with 405 Method Not
+// Allowed if there is none.
+func (h *handler) route(w http.ResponseWriter, r *http.Request, methods map[string]http.HandlerFunc) {
+	if fn, ok := methods[r.Method]; ok {
+		fn(w, r)
+		return
+	}
+
+	var allowed []string
+	for m := range methods {
+		allowed = append(allowed, m)
+	}
+	sort.Strings(allowed)
+	w.Header().Set("Allow", strings.Join(allowed, ", "))
+	writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+}
+
+func (h *handler) list(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	filter := model.ListFilter{Topic: q.Get("topic"), State: q.Get("state"), Limit: 100}
+
+	if filter.State != "" && !model.IsValidState(filter.State) {
+		writeError(w, http.StatusBadRequest, "unknown state '"+filter.State+"'")
+		return
+	}
+	if v := q.Get("attempts"); v != "" {
+		attempts, err := strconv.ParseUint(v, 10, 8)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid attempts '"+v+"'")
+			return
+		}
+		filter.Attempts = uint8(attempts)
+	}
+	if v := q.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 0 {
+			writeError(w, http.StatusBadRequest, "invalid limit '"+v+"'")
+			return
+		}
+		filter.Limit = limit
+	}
+
+	retries, err := h.retries.List(r.Context(), filter)
+	if err != nil {
+		h.internalError(w, "error listing retries", err)
+		return
+	}
+
+	views := make([]model.View, 0, len(retries))
+	for _, rt := range retries {
+		views = append(views, model.NewView(rt))
+	}
+	writeJSON(w, http.StatusOK, views)
+}
+
+func (h *handler) get(w http.ResponseWriter, r *http.Request, id int64) {
+	rt, err := h.retries.Get(r.Context(), id)
+	if errors.Is(err, sql.ErrNoRows) {
+		writeError(w, http.StatusNotFound, "retry not found")
+		return
+	}
+	if err != nil {
+		h.internalError(w, "error getting retry", err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, model.NewDetailedView(rt))
+}
+
+func (h *handler) delete(w http.ResponseWriter, r *http.Request, id int64) {
+	n, err := h.retries.PurgeDeadLettered(r.Context(), model.DeadLetterFilter{IDs: []int64{id}}, ActorFromContext(r.Context()))
+	h.writeSingleChange(w, n, err, "deleting retry", "dead-lettered retry not found")
+}
+
+func (h *handler) requeue(w http.ResponseWriter, r *http.Request, id int64) {
+	n, err := h.retries.RequeueDeadLettered(r.Context(), model.DeadLetterFilter{IDs: []int64{id}}, ActorFromContext(r.Context()))
+	h.writeSingleChange(w, n, err, "requeuing retry", "dead-lettered retry not found")
+}
+
+func (h *handler) retryNow(w http.ResponseWriter, r *http.Request, id int64) {
+	n, err := h.retries.RetryNow(r.Context(), "", []int64{id}, ActorFromContext(r.Context()))
+	h.writeSingleChange(w, n, err, "retrying retry", "waiting retry not found")
+}
+
+func (h *handler) requeueDeadLetters(w http.ResponseWriter, r *http.Request) {
+	filter, ok := readDeadLetterFilter(w, r)
+	if !ok {
+		return
+	}
+
+	n, err := h.retries.RequeueDeadLettered(r.Context(), filter.toModel(), ActorFromContext(r.Context()))
+	if err != nil {
+		h.internalError(w, "error requeuing dead-lettered retries", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, changedResponse{Changed: n})
+}
+
+func (h *handler) purgeDeadLetters(w http.ResponseWriter, r *http.Request) {
+	filter, ok := readDeadLetterFilter(w, r)
+	if !ok {
+		return
+	}
+
+	// purged retries cannot be recovered, so purging all of them must be asked for explicitly
+	if filter.toModel().IsEmpty() && !filter.All {
+		writeError(w, http.StatusBadRequest, "a filter, or \"all\": true, is required to purge dead-lettered retries")
+		return
+	}
+
+	n, err := h.retries.PurgeDeadLettered(r.Context(), filter.toModel(), ActorFromContext(r.Context()))
+	if err != nil {
+		h.internalError(w, "error purging dead-lettered retries", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, changedResponse{Changed: n})
+}
+
+func (h *handler) stats(w http.ResponseWriter, r *http.Request) {
+	topics, err := h.retries.Summary(r.Context())
+	if err != nil {
+		h.internalError(w, "error summarising retries", err)
+		return
+	}
+
+	sequences, err := h.retries.SequenceSummary(r.Context())
+	if err != nil {
+		h.internalError(w, "error summarising retries", err)
+		return
+	}
+
+	if topics == nil {
+		topics = []model.TopicSummary{}
+	}
+	if sequences == nil {
+		sequences = []model.SequenceSummary{}
+	}
+	writeJSON(w, http.StatusOK, statsResponse{Topics: topics, Sequences: sequences})
+}
+
+// writeSingleChange responds to a change of a single retry, with 404 Not Found if the retry
+// was not changed because it does not exist or is not in a state that the change applies to.
+func (h *handler) writeSingleChange(w http.ResponseWriter, n int64, err error, action, notFound string) {
+	if err != nil {
+		h.internalError(w, "error "+action, err)
+		return
+	}
+	if n == 0 {
+		writeError(w, http.StatusNotFound, notFound)
+		return
+	}
+	writeJSON(w, http.StatusOK, changedResponse{Changed: n})
+}
+
+func (h *handler) internalError(w http.ResponseWriter, msg string, err error) {
+	log.Error(h.logger, "admin: "+msg, log.Err(err))
+	writeError(w, http.StatusInternalServerError, msg)
+}
+
+type changedResponse struct {
+	Changed int64 `json:"changed"`
+}
+
+type statsResponse struct {
+	Topics    []model.TopicSummary    `json:"topics"`
+	Sequences []model.SequenceSummary `json:"sequences"`
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+// deadLetterFilter is the request body used to select dead-lettered retries, see
+// model.DeadLetterFilter. All must be set to purge every dead-lettered retry.
+type deadLetterFilter struct {
+	Topic         string    `json:"topic"`
+	IDs           []int64   `json:"ids"`
+	ErrorContains string    `json:"error_contains"`
+	CreatedFrom   time.Time `json:"created_from"`
+	CreatedTo     time.Time `json:"created_to"`
+	All           bool      `json:"all"`
+}
+
+func readDeadLetterFilter(w http.ResponseWriter, r *http.Request) (deadLetterFilter, bool) {
+	var f deadLetterFilter
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestBodySize))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&f); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body: "+err.Error())
+		return f, false
+	}
+	if len(f.IDs) > maxFilterIDs {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("at most %d ids can be given", maxFilterIDs))
+		return f, false
+	}
+	return f, true
+}
+
+func (f deadLetterFilter) toModel() model.DeadLetterFilter {
+	return model.DeadLetterFilter{
+		Topic:         f.Topic,
+		IDs:           f.IDs,
+		ErrorContains: f.ErrorContains,
+		CreatedFrom:   f.CreatedFrom,
+		CreatedTo:     f.CreatedTo,
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, errorResponse{Error: msg})
+}
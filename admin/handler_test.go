@@ -0,0 +1,308 @@
+package admin
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-test/deep"
+
+	"github.com/inviqa/kafka-consumer-go/data/retry/model"
+)
+
+type fakeRetryManager struct {
+	retries    []model.Retry
+	topics     []model.TopicSummary
+	sequences  []model.SequenceSummary
+	changed    int64
+	willError  bool
+	listFilter *model.ListFilter
+	dlFilter   *model.DeadLetterFilter
+	action     string
+	actor      string
+	ids        []int64
+}
+
+func (f *fakeRetryManager) List(ctx context.Context, filter model.ListFilter) ([]model.Retry, error) {
+	f.listFilter = &filter
+	return f.retries, f.err()
+}
+
+func (f *fakeRetryManager) Get(ctx context.Context, id int64) (model.Retry, error) {
+	if f.willError {
+		return model.Retry{}, f.err()
+	}
+	for _, r := range f.retries {
+		if r.ID == id {
+			return r, nil
+		}
+	}
+	return model.Retry{}, fmt.Errorf("data/retries: error getting retry %d: %w", id, sql.ErrNoRows)
+}
+
+func (f *fakeRetryManager) RequeueDeadLettered(ctx context.Context, filter model.DeadLetterFilter, actor string) (int64, error) {
+	f.action, f.dlFilter, f.actor = "requeue", &filter, actor
+	return f.changed, f.err()
+}
+
+func (f *fakeRetryManager) PurgeDeadLettered(ctx context.Context, filter model.DeadLetterFilter, actor string) (int64, error) {
+	f.action, f.dlFilter, f.actor = "purge", &filter, actor
+	return f.changed, f.err()
+}
+
+func (f *fakeRetryManager) RetryNow(ctx context.Context, topic string, ids []int64, actor string) (int64, error) {
+	f.action, f.ids, f.actor = "retry_now", ids, actor
+	return f.changed, f.err()
+}
+
+func (f *fakeRetryManager) Summary(ctx context.Context) ([]model.TopicSummary, error) {
+	return f.topics, f.err()
+}
+
+func (f *fakeRetryManager) SequenceSummary(ctx context.Context) ([]model.SequenceSummary, error) {
+	return f.sequences, f.err()
+}
+
+func (f *fakeRetryManager) err() error {
+	if f.willError {
+		return errors.New("oops")
+	}
+	return nil
+}
+
+func serve(h http.Handler, method, target, body string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(method, target, strings.NewReader(body)))
+	return rec
+}
+
+func assertResponse(t *testing.T, rec *httptest.ResponseRecorder, code int, body string) {
+	t.Helper()
+	if rec.Code != code {
+		t.Errorf("expected status %d, but got %d", code, rec.Code)
+	}
+	if got := strings.TrimSpace(rec.Body.String()); got != body {
+		t.Errorf("expected body %s, but got %s", body, got)
+	}
+}
+
+func TestHandler_list(t *testing.T) {
+	created := time.Date(2022, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	t.Run("retries are listed with the filter", func(t *testing.T) {
+		rm := &fakeRetryManager{retries: []model.Retry{{ID: 1, Topic: "product", Attempts: 2, Errored: true, CreatedAt: created, UpdatedAt: created}}}
+		rec := serve(newHandler(rm, Options{}), http.MethodGet, "/retries?topic=product&state=errored&attempts=2&limit=10", "")
+
+		assertResponse(t, rec, http.StatusOK, `[{"id":1,"topic":"product","key":"","partition":0,"offset":0,"attempts":2,"state":"errored","last_error":"","created_at":"2022-06-01T12:00:00Z","updated_at":"2022-06-01T12:00:00Z"}]`)
+
+		exp := &model.ListFilter{Topic: "product", State: model.StateErrored, Attempts: 2, Limit: 10}
+		if diff := deep.Equal(exp, rm.listFilter); diff != nil {
+			t.Error(diff)
+		}
+	})
+
+	t.Run("an empty list is returned as an array", func(t *testing.T) {
+		rec := serve(newHandler(&fakeRetryManager{}, Options{}), http.MethodGet, "/retries", "")
+		assertResponse(t, rec, http.StatusOK, `[]`)
+	})
+
+	t.Run("invalid filters are rejected", func(t *testing.T) {
+		h := newHandler(&fakeRetryManager{}, Options{})
+
+		for _, q := range []string{"state=stuck", "attempts=300", "limit=-1"} {
+			if rec := serve(h, http.MethodGet, "/retries?"+q, ""); rec.Code != http.StatusBadRequest {
+				t.Errorf("expected status 400 for %s, but got %d", q, rec.Code)
+			}
+		}
+	})
+
+	t.Run("errors are not included in the response", func(t *testing.T) {
+		rec := serve(newHandler(&fakeRetryManager{willError: true}, Options{}), http.MethodGet, "/retries", "")
+		assertResponse(t, rec, http.StatusInternalServerError, `{"error":"error listing retries"}`)
+	})
+}
+
+func TestHandler_get(t *testing.T) {
+	rm := &fakeRetryManager{retries: []model.Retry{{
+		ID:             7,
+		Topic:          "product",
+		PayloadJSON:    []byte(`{"sku":"A1"}`),
+		PayloadHeaders: []byte(`{"x-attempts":"1"}`),
+		Deadlettered:   true,
+	}}}
+	h := newHandler(rm, Options{})
+
+	rec := serve(h, http.MethodGet, "/retries/7", "")
+	assertResponse(t, rec, http.StatusOK, `{"id":7,"topic":"product","key":"","partition":0,"offset":0,"attempts":0,"state":"deadlettered","last_error":"","created_at":"0001-01-01T00:00:00Z","updated_at":"0001-01-01T00:00:00Z","headers":{"x-attempts":"1"},"payload":{"sku":"A1"}}`)
+
+	rec = serve(h, http.MethodGet, "/retries/8", "")
+	assertResponse(t, rec, http.StatusNotFound, `{"error":"retry not found"}`)
+
+	rec = serve(h, http.MethodGet, "/retries/abc", "")
+	assertResponse(t, rec, http.StatusNotFound, `{"error":"not found"}`)
+}
+
+func TestHandler_singleRetryChanges(t *testing.T) {
+	tests := []struct {
+		name   string
+		method string
+		target string
+		action string
+	}{
+		{name: "delete", method: http.MethodDelete, target: "/retries/3", action: "purge"},
+		{name: "requeue", method: http.MethodPost, target: "/retries/3/requeue", action: "requeue"},
+		{name: "retry now", method: http.MethodPost, target: "/retries/3/retry-now", action: "retry_now"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rm := &fakeRetryManager{changed: 1}
+			auth := func(next http.Handler) http.Handler {
+				return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					next.ServeHTTP(w, r.WithContext(WithActor(r.Context(), "jane")))
+				})
+			}
+
+			rec := serve(newHandler(rm, Options{Middleware: []Middleware{auth}}), tt.method, tt.target, "")
+			assertResponse(t, rec, http.StatusOK, `{"changed":1}`)
+
+			if rm.action != tt.action || rm.actor != "jane" {
+				t.Errorf("expected %s by 'jane', but got %s by '%s'", tt.action, rm.action, rm.actor)
+			}
+			if rm.dlFilter != nil && (len(rm.dlFilter.IDs) != 1 || rm.dlFilter.IDs[0] != 3) {
+				t.Errorf("unexpected filter %+v", rm.dlFilter)
+			}
+			if rm.ids != nil && (len(rm.ids) != 1 || rm.ids[0] != 3) {
+				t.Errorf("unexpected IDs %v", rm.ids)
+			}
+		})
+
+		t.Run(tt.name+" of a retry that cannot be changed", func(t *testing.T) {
+			rec := serve(newHandler(&fakeRetryManager{}, Options{}), tt.method, tt.target, "")
+			if rec.Code != http.StatusNotFound {
+				t.Errorf("expected status 404, but got %d", rec.Code)
+			}
+		})
+	}
+}
+
+func TestHandler_requeueDeadLetters(t *testing.T) {
+	rm := &fakeRetryManager{changed: 4}
+	h := newHandler(rm, Options{})
+
+	rec := serve(h, http.MethodPost, "/deadletters/requeue", `{"topic":"product","error_contains":"timeout","created_from":"2022-06-01T00:00:00Z"}`)
+	assertResponse(t, rec, http.StatusOK, `{"changed":4}`)
+
+	exp := &model.DeadLetterFilter{Topic: "product", ErrorContains: "timeout", CreatedFrom: time.Date(2022, 6, 1, 0, 0, 0, 0, time.UTC)}
+	if diff := deep.Equal(exp, rm.dlFilter); diff != nil {
+		t.Error(diff)
+	}
+	if rm.actor != anonymousActor {
+		t.Errorf("expected the anonymous actor, but got '%s'", rm.actor)
+	}
+
+	rec = serve(h, http.MethodPost, "/deadletters/requeue", `{"topics":"product"}`)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("expected status 400 for an unknown field, but got %d", rec.Code)
+	}
+}
+
+func TestHandler_deadLetterFilterLimits(t *testing.T) {
+	ids := make([]string, maxFilterIDs+1)
+	for i := range ids {
+		ids[i] = strconv.Itoa(i + 1)
+	}
+
+	tests := []struct {
+		name string
+		body string
+	}{
+		{name: "too many ids", body: `{"ids":[` + strings.Join(ids, ",") + `]}`},
+		{name: "body too large", body: `{"error_contains":"` + strings.Repeat("a", maxRequestBodySize) + `"}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rm := &fakeRetryManager{}
+
+			rec := serve(newHandler(rm, Options{}), http.MethodPost, "/deadletters/requeue", tt.body)
+			if rec.Code != http.StatusBadRequest || rm.action != "" {
+				t.Errorf("expected a bad request without requeuing, but got status %d", rec.Code)
+			}
+		})
+	}
+}
+
+func TestHandler_purgeDeadLetters(t *testing.T) {
+	t.Run("purging without a filter needs all", func(t *testing.T) {
+		rm := &fakeRetryManager{changed: 9}
+		h := newHandler(rm, Options{})
+
+		rec := serve(h, http.MethodPost, "/deadletters/purge", `{}`)
+		if rec.Code != http.StatusBadRequest || rm.action != "" {
+			t.Errorf("expected a bad request without purging, but got status %d", rec.Code)
+		}
+
+		rec = serve(h, http.MethodPost, "/deadletters/purge", `{"all":true}`)
+		assertResponse(t, rec, http.StatusOK, `{"changed":9}`)
+	})
+
+	t.Run("purging with a filter", func(t *testing.T) {
+		rm := &fakeRetryManager{changed: 2}
+
+		rec := serve(newHandler(rm, Options{}), http.MethodPost, "/deadletters/purge", `{"ids":[1,2]}`)
+		assertResponse(t, rec, http.StatusOK, `{"changed":2}`)
+
+		if diff := deep.Equal([]int64{1, 2}, rm.dlFilter.IDs); diff != nil {
+			t.Error(diff)
+		}
+	})
+}
+
+func TestHandler_stats(t *testing.T) {
+	rm := &fakeRetryManager{
+		topics:    []model.TopicSummary{{Topic: "product", Pending: 1, DeadLettered: 2}},
+		sequences: []model.SequenceSummary{{Topic: "product", Sequence: 1, Pending: 1}, {Topic: "product", Sequence: 3, DeadLettered: 2}},
+	}
+
+	rec := serve(newHandler(rm, Options{}), http.MethodGet, "/stats", "")
+	assertResponse(t, rec, http.StatusOK, `{"topics":[{"topic":"product","pending":1,"errored":0,"deadlettered":2,"successful":0}],"sequences":[{"topic":"product","sequence":1,"pending":1,"errored":0,"deadlettered":0,"successful":0},{"topic":"product","sequence":3,"pending":0,"errored":0,"deadlettered":2,"successful":0}]}`)
+}
+
+func TestHandler_routing(t *testing.T) {
+	h := newHandler(&fakeRetryManager{}, Options{})
+
+	rec := serve(h, http.MethodPost, "/retries/1", "")
+	assertResponse(t, rec, http.StatusMethodNotAllowed, `{"error":"method not allowed"}`)
+	if got := rec.Header().Get("Allow"); got != "DELETE, GET" {
+		t.Errorf("unexpected Allow header '%s'", got)
+	}
+
+	rec = serve(h, http.MethodGet, "/unknown", "")
+	assertResponse(t, rec, http.StatusNotFound, `{"error":"not found"}`)
+}
+
+func TestHandler_middlewareOrder(t *testing.T) {
+	var calls []string
+	mw := func(name string) Middleware {
+		return func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				calls = append(calls, name)
+				next.ServeHTTP(w, r)
+			})
+		}
+	}
+
+	serve(newHandler(&fakeRetryManager{}, Options{Middleware: []Middleware{mw("first"), mw("second")}}), http.MethodGet, "/stats", "")
+
+	if diff := deep.Equal([]string{"first", "second"}, calls); diff != nil {
+		t.Error(diff)
+	}
+}
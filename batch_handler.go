@@ -0,0 +1,102 @@
+package consumer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/Shopify/sarama"
+
+	"github.com/inviqa/kafka-consumer-go/config"
+	"github.com/inviqa/kafka-consumer-go/log"
+)
+
+// BatchHandler processes a batch of messages from the same topic in a single call. If it
+// returns a *BatchError then only the messages recorded in that error are sent for retry,
+// any other non-nil error causes every message in the batch to be sent for retry.
+type BatchHandler func(ctx context.Context, msgs []*sarama.ConsumerMessage) error
+type BatchHandlerMap map[config.TopicKey]BatchHandler
+
+func (bhm BatchHandlerMap) handlerForTopic(t config.TopicKey) (BatchHandler, bool) {
+	h, ok := bhm[t]
+	return h, ok
+}
+
+// withMiddleware returns a copy of the batch handler map with the given middleware applied to each handler.
+func (bhm BatchHandlerMap) withMiddleware(mws []BatchMiddleware) BatchHandlerMap {
+	if len(mws) == 0 {
+		return bhm
+	}
+
+	wrapped := make(BatchHandlerMap, len(bhm))
+	for k, h := range bhm {
+		wrapped[k] = applyBatchMiddleware(h, mws)
+	}
+
+	return wrapped
+}
+
+// callBatchHandler calls the batch handler, converting a panic into a *PanicError, which fails
+// every message in the batch.
+func callBatchHandler(ctx context.Context, logger log.StructuredLogger, h BatchHandler, msgs []*sarama.ConsumerMessage) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			pe := newPanicError(r)
+			logPanic(logger, pe, batchFields(msgs))
+			err = pe
+		}
+	}()
+
+	return h(ctx, msgs)
+}
+
+// BatchError is returned from a BatchHandler to report the individual messages in a batch
+// that failed processing.
+type BatchError struct {
+	failures map[*sarama.ConsumerMessage]error
+}
+
+func NewBatchError() *BatchError {
+	return &BatchError{
+		failures: map[*sarama.ConsumerMessage]error{},
+	}
+}
+
+// Fail records that msg failed processing with err.
+func (e *BatchError) Fail(msg *sarama.ConsumerMessage, err error) {
+	e.failures[msg] = err
+}
+
+// Failed returns the number of messages recorded as failed.
+func (e *BatchError) Failed() int {
+	return len(e.failures)
+}
+
+func (e *BatchError) Error() string {
+	return fmt.Sprintf("consumer: %d message(s) in batch failed processing", len(e.failures))
+}
+
+// batchFailures returns the error for each message in msgs that failed, based on the
+// error returned from a BatchHandler.
+func batchFailures(msgs []*sarama.ConsumerMessage, err error) map[*sarama.ConsumerMessage]error {
+	failures := map[*sarama.ConsumerMessage]error{}
+	if err == nil {
+		return failures
+	}
+
+	var be *BatchError
+	if errors.As(err, &be) {
+		for _, msg := range msgs {
+			if msgErr, failed := be.failures[msg]; failed {
+				failures[msg] = msgErr
+			}
+		}
+		return failures
+	}
+
+	for _, msg := range msgs {
+		failures[msg] = err
+	}
+
+	return failures
+}
@@ -0,0 +1,50 @@
+package consumer
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/Shopify/sarama"
+	"github.com/go-test/deep"
+)
+
+func TestBatchFailures(t *testing.T) {
+	msg1 := &sarama.ConsumerMessage{Offset: 1}
+	msg2 := &sarama.ConsumerMessage{Offset: 2}
+	msgs := []*sarama.ConsumerMessage{msg1, msg2}
+	err := errors.New("oops")
+
+	t.Run("no failures when handler returns nil", func(t *testing.T) {
+		if got := batchFailures(msgs, nil); len(got) != 0 {
+			t.Errorf("expected no failures, but got %d", len(got))
+		}
+	})
+
+	t.Run("all messages fail when handler returns an error", func(t *testing.T) {
+		exp := map[*sarama.ConsumerMessage]error{msg1: err, msg2: err}
+		if diff := deep.Equal(exp, batchFailures(msgs, err)); diff != nil {
+			t.Error(diff)
+		}
+	})
+
+	t.Run("only reported messages fail when handler returns a batch error", func(t *testing.T) {
+		be := NewBatchError()
+		be.Fail(msg2, err)
+
+		exp := map[*sarama.ConsumerMessage]error{msg2: err}
+		if diff := deep.Equal(exp, batchFailures(msgs, be)); diff != nil {
+			t.Error(diff)
+		}
+	})
+
+	t.Run("wrapped batch errors are detected", func(t *testing.T) {
+		be := NewBatchError()
+		be.Fail(msg1, err)
+
+		exp := map[*sarama.ConsumerMessage]error{msg1: err}
+		if diff := deep.Equal(exp, batchFailures(msgs, fmt.Errorf("wrapped: %w", be))); diff != nil {
+			t.Error(diff)
+		}
+	})
+}
@@ -0,0 +1,92 @@
+package consumer
+
+import (
+	"context"
+	"time"
+
+	"github.com/Shopify/sarama"
+
+	"github.com/inviqa/kafka-consumer-go/log"
+)
+
+// BatchMiddleware wraps a BatchHandler to add behaviour around the processing of each batch,
+// in the same way as Middleware does for a Handler. Middleware registered with
+// WithBatchMiddleware is applied to every handler in the BatchHandlerMap, so it runs for
+// batches from Kafka and from the DB retry processors alike.
+type BatchMiddleware func(BatchHandler) BatchHandler
+
+// WithBatchMiddleware registers middleware to apply to every batch handler. The first
+// middleware given is the outermost, so it is the first to see each batch. Middleware
+// registered with WithMiddleware is not applied to batch handlers.
+func WithBatchMiddleware(mws ...BatchMiddleware) Option {
+	return func(o *options) {
+		o.batchMiddleware = append(o.batchMiddleware, mws...)
+	}
+}
+
+// BatchRecovery returns a batch middleware that recovers from a panic in the batch handler, logs
+// it with its stack trace, and returns it as a *PanicError so that every message in the batch is
+// sent for retry.
+func BatchRecovery(logger log.StructuredLogger) BatchMiddleware {
+	if logger == nil {
+		logger = log.NullLogger{}
+	}
+
+	return func(next BatchHandler) BatchHandler {
+		return func(ctx context.Context, msgs []*sarama.ConsumerMessage) (err error) {
+			defer func() {
+				if r := recover(); r != nil {
+					pe := newPanicError(r)
+					logPanic(logger, pe, batchFields(msgs))
+					err = pe
+				}
+			}()
+
+			return next(ctx, msgs)
+		}
+	}
+}
+
+// BatchTimeout returns a batch middleware that cancels the context passed to the batch handler
+// once the given duration has elapsed.
+func BatchTimeout(d time.Duration) BatchMiddleware {
+	return func(next BatchHandler) BatchHandler {
+		return func(ctx context.Context, msgs []*sarama.ConsumerMessage) error {
+			ctx, cancel := context.WithTimeout(ctx, d)
+			defer cancel()
+
+			return next(ctx, msgs)
+		}
+	}
+}
+
+// BatchLogging returns a batch middleware that logs the outcome and duration of each batch
+// handler call, with the topic and size of the batch as fields.
+func BatchLogging(logger log.StructuredLogger) BatchMiddleware {
+	if logger == nil {
+		logger = log.NullLogger{}
+	}
+
+	return func(next BatchHandler) BatchHandler {
+		return func(ctx context.Context, msgs []*sarama.ConsumerMessage) error {
+			start := time.Now()
+			err := next(ctx, msgs)
+			fields := append(batchFields(msgs), log.F("duration", time.Since(start)))
+
+			if err != nil {
+				log.Error(logger, "error handling batch", append(fields, log.Err(err))...)
+				return err
+			}
+
+			log.Debug(logger, "handled batch", fields...)
+			return nil
+		}
+	}
+}
+
+func applyBatchMiddleware(h BatchHandler, mws []BatchMiddleware) BatchHandler {
+	for i := len(mws) - 1; i >= 0; i-- {
+		h = mws[i](h)
+	}
+	return h
+}
@@ -0,0 +1,121 @@
+package consumer
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/go-test/deep"
+
+	"github.com/inviqa/kafka-consumer-go/log"
+)
+
+func TestBatchHandlerMap_withMiddleware(t *testing.T) {
+	var calls []string
+	mw := func(name string) BatchMiddleware {
+		return func(next BatchHandler) BatchHandler {
+			return func(ctx context.Context, msgs []*sarama.ConsumerMessage) error {
+				calls = append(calls, name)
+				return next(ctx, msgs)
+			}
+		}
+	}
+	bhm := BatchHandlerMap{
+		"product": func(ctx context.Context, msgs []*sarama.ConsumerMessage) error {
+			calls = append(calls, "handler")
+			return nil
+		},
+	}
+
+	wrapped := bhm.withMiddleware([]BatchMiddleware{mw("first"), mw("second")})
+	if err := wrapped["product"](context.Background(), nil); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if diff := deep.Equal([]string{"first", "second", "handler"}, calls); diff != nil {
+		t.Error(diff)
+	}
+
+	calls = nil
+	if err := bhm["product"](context.Background(), nil); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if diff := deep.Equal([]string{"handler"}, calls); diff != nil {
+		t.Errorf("original batch handler map was modified: %v", diff)
+	}
+}
+
+func TestBatchRecovery(t *testing.T) {
+	t.Run("panic is logged and returned as an error", func(t *testing.T) {
+		l := &recordingLogger{}
+		h := BatchRecovery(l)(func(ctx context.Context, msgs []*sarama.ConsumerMessage) error {
+			panic("something bad happened")
+		})
+
+		err := h(context.Background(), []*sarama.ConsumerMessage{{Topic: "product"}})
+
+		var pe *PanicError
+		if !errors.As(err, &pe) {
+			t.Fatalf("expected a *PanicError, but got %#v", err)
+		}
+		if len(l.entries) != 1 {
+			t.Fatalf("expected the panic to be logged once, but got %d log entries", len(l.entries))
+		}
+
+		got := map[string]interface{}{}
+		for _, f := range l.entries[0].fields {
+			got[f.Key] = f.Value
+		}
+		if got["topic"] != "product" || got["batch_size"] != 1 || !strings.Contains(got["stack"].(string), "batch_middleware_test.go") {
+			t.Errorf("expected the batch and stack trace to be logged, but got: %v", got)
+		}
+	})
+
+	t.Run("errors are passed through", func(t *testing.T) {
+		exp := errors.New("oops")
+		h := BatchRecovery(log.NullLogger{})(func(ctx context.Context, msgs []*sarama.ConsumerMessage) error {
+			return exp
+		})
+
+		if err := h(context.Background(), nil); err != exp {
+			t.Errorf("expected error %v, but got %v", exp, err)
+		}
+	})
+}
+
+func TestBatchTimeout(t *testing.T) {
+	h := BatchTimeout(time.Millisecond)(func(ctx context.Context, msgs []*sarama.ConsumerMessage) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	if err := h(context.Background(), nil); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected context.DeadlineExceeded, but got %v", err)
+	}
+}
+
+func TestBatchLogging(t *testing.T) {
+	l := &recordingLogger{}
+	exp := errors.New("oops")
+	h := BatchLogging(l)(func(ctx context.Context, msgs []*sarama.ConsumerMessage) error {
+		return exp
+	})
+
+	if err := h(context.Background(), []*sarama.ConsumerMessage{{Topic: "product"}, {Topic: "product"}}); err != exp {
+		t.Errorf("expected error %v, but got %v", exp, err)
+	}
+
+	if len(l.entries) != 1 {
+		t.Fatalf("expected 1 log entry, but got %d", len(l.entries))
+	}
+	got := map[string]interface{}{}
+	for _, f := range l.entries[0].fields {
+		got[f.Key] = f.Value
+	}
+	if l.entries[0].level != log.LevelError || got["topic"] != "product" || got["batch_size"] != 2 || got["error"] != exp {
+		t.Errorf("unexpected log entry: %s %v", l.entries[0].level, got)
+	}
+}
@@ -0,0 +1,252 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/inviqa/kafka-consumer-go/data/retry/model"
+)
+
+const commandUsage = `  list       list retries by topic, state and attempt
+  show       show a retry, with its decoded payload and headers
+  requeue    requeue dead-lettered retries so that they are retried again, -all without a filter
+  purge      delete dead-lettered retries, -all without a filter
+  retry-now  make waiting retries due straight away, -all without -topic or -ids
+  summary    count the retries in each state for every topic
+  migrate    apply the retry database migrations
+`
+
+type retryManager interface {
+	List(ctx context.Context, filter model.ListFilter) ([]model.Retry, error)
+	Get(ctx context.Context, id int64) (model.Retry, error)
+	RequeueDeadLettered(ctx context.Context, filter model.DeadLetterFilter, actor string) (int64, error)
+	PurgeDeadLettered(ctx context.Context, filter model.DeadLetterFilter, actor string) (int64, error)
+	RetryNow(ctx context.Context, topic string, ids []int64, actor string) (int64, error)
+	Summary(ctx context.Context) ([]model.TopicSummary, error)
+}
+
+type deadLetterCounter interface {
+	Count(ctx context.Context) uint
+}
+
+type app struct {
+	retries     retryManager
+	deadLetters deadLetterCounter
+	migrate     func() error
+	out         *output
+}
+
+func (a *app) run(ctx context.Context, command string, args []string) error {
+	switch command {
+	case "list":
+		return a.list(ctx, args)
+	case "show":
+		return a.show(ctx, args)
+	case "requeue":
+		return a.requeue(ctx, args)
+	case "purge":
+		return a.purge(ctx, args)
+	case "retry-now":
+		return a.retryNow(ctx, args)
+	case "summary":
+		return a.summary(ctx, args)
+	case "migrate":
+		return a.runMigrations(args)
+	default:
+		return fmt.Errorf("unknown command '%s'", command)
+	}
+}
+
+func (a *app) list(ctx context.Context, args []string) error {
+	fs := newCommandFlags("list")
+	topic := fs.String("topic", "", "only list retries from this source topic")
+	state := fs.String("state", "", "only list retries in this state, one of pending, errored, deadlettered or successful")
+	attempts := fs.Uint("attempts", 0, "only list retries with this number of attempts")
+	limit := fs.Int("limit", 100, "the maximum number of retries to list, 0 lists them all")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if *attempts > 255 {
+		return errors.New("attempts must be no more than 255")
+	}
+
+	retries, err := a.retries.List(ctx, model.ListFilter{
+		Topic:    *topic,
+		State:    *state,
+		Attempts: uint8(*attempts),
+		Limit:    *limit,
+	})
+	if err != nil {
+		return err
+	}
+
+	return a.out.retries(retries)
+}
+
+func (a *app) show(ctx context.Context, args []string) error {
+	fs := newCommandFlags("show")
+	id := fs.Int64("id", 0, "the ID of the retry to show")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if *id == 0 {
+		return errors.New("the ID of a retry must be given with -id")
+	}
+
+	r, err := a.retries.Get(ctx, *id)
+	if err != nil {
+		return err
+	}
+
+	return a.out.retry(r)
+}
+
+func (a *app) requeue(ctx context.Context, args []string) error {
+	fs := newCommandFlags("requeue")
+	filter, actor := deadLetterFlags(fs)
+	all := fs.Bool("all", false, "requeue every dead-lettered retry when no filter is given")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	f, err := filter()
+	if err != nil {
+		return err
+	}
+
+	if f.IsEmpty() && !*all {
+		return errors.New("refusing to requeue every dead-lettered retry without -all")
+	}
+
+	n, err := a.retries.RequeueDeadLettered(ctx, f, *actor)
+	if err != nil {
+		return err
+	}
+
+	return a.out.changed("requeue", n)
+}
+
+func (a *app) purge(ctx context.Context, args []string) error {
+	fs := newCommandFlags("purge")
+	filter, actor := deadLetterFlags(fs)
+	all := fs.Bool("all", false, "purge every dead-lettered retry when no filter is given")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	f, err := filter()
+	if err != nil {
+		return err
+	}
+
+	// purged retries cannot be recovered, so purging all of them must be asked for explicitly
+	if f.IsEmpty() && !*all {
+		return errors.New("refusing to purge every dead-lettered retry without -all")
+	}
+
+	n, err := a.retries.PurgeDeadLettered(ctx, f, *actor)
+	if err != nil {
+		return err
+	}
+
+	return a.out.changed("purge", n)
+}
+
+func (a *app) retryNow(ctx context.Context, args []string) error {
+	fs := newCommandFlags("retry-now")
+	topic := fs.String("topic", "", "only retry retries from this source topic")
+	ids := fs.String("ids", "", "comma separated IDs of the retries to retry")
+	actor := fs.String("actor", os.Getenv("USER"), "who is retrying the retries, recorded in the audit table")
+	all := fs.Bool("all", false, "retry every waiting retry when no topic or IDs are given")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	idList, err := int64List(*ids)
+	if err != nil {
+		return fmt.Errorf("invalid IDs: %w", err)
+	}
+
+	if *topic == "" && len(idList) == 0 && !*all {
+		return errors.New("refusing to retry every waiting retry without -all")
+	}
+
+	n, err := a.retries.RetryNow(ctx, *topic, idList, *actor)
+	if err != nil {
+		return err
+	}
+
+	return a.out.changed("retry-now", n)
+}
+
+func (a *app) summary(ctx context.Context, args []string) error {
+	fs := newCommandFlags("summary")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	summaries, err := a.retries.Summary(ctx)
+	if err != nil {
+		return err
+	}
+
+	return a.out.summary(summaries, a.deadLetters.Count(ctx))
+}
+
+func (a *app) runMigrations(args []string) error {
+	fs := newCommandFlags("migrate")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if err := a.migrate(); err != nil {
+		return err
+	}
+
+	return a.out.message("migrations applied")
+}
+
+func newCommandFlags(command string) *flag.FlagSet {
+	return flag.NewFlagSet("kafka-consumer-admin "+command, flag.ContinueOnError)
+}
+
+// deadLetterFlags adds the flags that select dead-lettered retries to fs. It returns a function
+// that builds the filter once fs has been parsed, along with the actor flag.
+func deadLetterFlags(fs *flag.FlagSet) (func() (model.DeadLetterFilter, error), *string) {
+	topic := fs.String("topic", "", "only include retries from this source topic")
+	ids := fs.String("ids", "", "comma separated IDs of the retries to include")
+	errContains := fs.String("error", "", "only include retries whose last error contains this text")
+	from := fs.String("created-from", "", "only include retries created at or after this RFC3339 time")
+	to := fs.String("created-to", "", "only include retries created at or before this RFC3339 time")
+	actor := fs.String("actor", os.Getenv("USER"), "who is making the change, recorded in the audit table")
+
+	return func() (model.DeadLetterFilter, error) {
+		f := model.DeadLetterFilter{Topic: *topic, ErrorContains: *errContains}
+
+		var err error
+		if f.IDs, err = int64List(*ids); err != nil {
+			return f, fmt.Errorf("invalid IDs: %w", err)
+		}
+		if f.CreatedFrom, err = parseTime(*from); err != nil {
+			return f, fmt.Errorf("invalid created-from time: %w", err)
+		}
+		if f.CreatedTo, err = parseTime(*to); err != nil {
+			return f, fmt.Errorf("invalid created-to time: %w", err)
+		}
+
+		return f, nil
+	}, actor
+}
+
+func parseTime(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.RFC3339, s)
+}
@@ -0,0 +1,269 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-test/deep"
+
+	"github.com/inviqa/kafka-consumer-go/data/retry/model"
+)
+
+type fakeRetryManager struct {
+	retries    []model.Retry
+	summaries  []model.TopicSummary
+	listFilter model.ListFilter
+	dlFilter   *model.DeadLetterFilter
+	action     string
+	actor      string
+	topic      string
+	ids        []int64
+}
+
+func (f *fakeRetryManager) List(ctx context.Context, filter model.ListFilter) ([]model.Retry, error) {
+	f.listFilter = filter
+	return f.retries, nil
+}
+
+func (f *fakeRetryManager) Get(ctx context.Context, id int64) (model.Retry, error) {
+	for _, r := range f.retries {
+		if r.ID == id {
+			return r, nil
+		}
+	}
+	return model.Retry{}, errors.New("not found")
+}
+
+func (f *fakeRetryManager) RequeueDeadLettered(ctx context.Context, filter model.DeadLetterFilter, actor string) (int64, error) {
+	f.action, f.dlFilter, f.actor = "requeue", &filter, actor
+	return 2, nil
+}
+
+func (f *fakeRetryManager) PurgeDeadLettered(ctx context.Context, filter model.DeadLetterFilter, actor string) (int64, error) {
+	f.action, f.dlFilter, f.actor = "purge", &filter, actor
+	return 3, nil
+}
+
+func (f *fakeRetryManager) RetryNow(ctx context.Context, topic string, ids []int64, actor string) (int64, error) {
+	f.action, f.topic, f.ids, f.actor = "retry-now", topic, ids, actor
+	return int64(len(ids)), nil
+}
+
+func (f *fakeRetryManager) Summary(ctx context.Context) ([]model.TopicSummary, error) {
+	return f.summaries, nil
+}
+
+type fakeDeadLetterCounter uint
+
+func (c fakeDeadLetterCounter) Count(ctx context.Context) uint {
+	return uint(c)
+}
+
+func newTestApp(format string) (*app, *fakeRetryManager, *bytes.Buffer) {
+	buf := &bytes.Buffer{}
+	rm := &fakeRetryManager{}
+	out, _ := newOutput(buf, format)
+
+	return &app{
+		retries:     rm,
+		deadLetters: fakeDeadLetterCounter(5),
+		migrate:     func() error { return nil },
+		out:         out,
+	}, rm, buf
+}
+
+func TestApp_list(t *testing.T) {
+	a, rm, buf := newTestApp(formatCSV)
+	rm.retries = []model.Retry{{ID: 1, Topic: "product", Attempts: 2, Errored: true, LastError: "oops"}}
+
+	err := a.run(context.Background(), "list", []string{"-topic", "product", "-state", "errored", "-attempts", "2"})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	exp := model.ListFilter{Topic: "product", State: model.StateErrored, Attempts: 2, Limit: 100}
+	if diff := deep.Equal(exp, rm.listFilter); diff != nil {
+		t.Error(diff)
+	}
+
+	if !strings.Contains(buf.String(), "1,product,,0,0,2,errored,,,,oops\n") {
+		t.Errorf("retry was not listed, got:\n%s", buf.String())
+	}
+}
+
+func TestApp_show(t *testing.T) {
+	a, rm, buf := newTestApp(formatTable)
+	rm.retries = []model.Retry{{ID: 7, Topic: "product", PayloadJSON: []byte(`{"sku":"A1"}`), PayloadHeaders: []byte(`{"x-attempts":"2"}`)}}
+
+	if err := a.run(context.Background(), "show", []string{"-id", "7"}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	for _, exp := range []string{"header.x-attempts  2", "payload:\n{\n  \"sku\": \"A1\"\n}"} {
+		if !strings.Contains(buf.String(), exp) {
+			t.Errorf("expected output to contain %q, got:\n%s", exp, buf.String())
+		}
+	}
+
+	if err := a.run(context.Background(), "show", nil); err == nil {
+		t.Error("expected an error without an ID but got nil")
+	}
+}
+
+func TestApp_requeue(t *testing.T) {
+	a, rm, buf := newTestApp(formatTable)
+
+	err := a.run(context.Background(), "requeue", []string{"-topic", "product", "-ids", "1, 2", "-error", "timeout", "-created-from", "2022-06-01T00:00:00Z", "-actor", "jane"})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	exp := &model.DeadLetterFilter{
+		Topic:         "product",
+		IDs:           []int64{1, 2},
+		ErrorContains: "timeout",
+		CreatedFrom:   time.Date(2022, 6, 1, 0, 0, 0, 0, time.UTC),
+	}
+	if diff := deep.Equal(exp, rm.dlFilter); diff != nil {
+		t.Error(diff)
+	}
+	if rm.action != "requeue" || rm.actor != "jane" {
+		t.Errorf("unexpected %s by '%s'", rm.action, rm.actor)
+	}
+	if buf.String() != "requeue: 2 retries changed\n" {
+		t.Errorf("unexpected output: %s", buf.String())
+	}
+
+	if err := a.run(context.Background(), "requeue", []string{"-created-to", "yesterday"}); err == nil {
+		t.Error("expected an error for an invalid time but got nil")
+	}
+}
+
+func TestApp_requeue_WithoutFilter(t *testing.T) {
+	a, rm, _ := newTestApp(formatTable)
+
+	if err := a.run(context.Background(), "requeue", nil); err == nil {
+		t.Error("expected an error but got nil")
+	}
+	if rm.action != "" {
+		t.Error("retries were requeued without -all")
+	}
+
+	if err := a.run(context.Background(), "requeue", []string{"-all"}); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+	if rm.action != "requeue" {
+		t.Error("retries were not requeued with -all")
+	}
+}
+
+func TestApp_purge(t *testing.T) {
+	t.Run("purging without a filter needs -all", func(t *testing.T) {
+		a, rm, _ := newTestApp(formatTable)
+
+		if err := a.run(context.Background(), "purge", nil); err == nil {
+			t.Error("expected an error but got nil")
+		}
+		if rm.action != "" {
+			t.Error("retries were purged without -all")
+		}
+
+		if err := a.run(context.Background(), "purge", []string{"-all"}); err != nil {
+			t.Errorf("unexpected error: %s", err)
+		}
+		if rm.action != "purge" {
+			t.Error("retries were not purged with -all")
+		}
+	})
+
+	t.Run("purging with a filter", func(t *testing.T) {
+		a, rm, buf := newTestApp(formatJSON)
+
+		if err := a.run(context.Background(), "purge", []string{"-topic", "product"}); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if rm.dlFilter.Topic != "product" {
+			t.Errorf("unexpected filter %+v", rm.dlFilter)
+		}
+		if buf.String() != "{\n  \"action\": \"purge\",\n  \"changed\": 3\n}\n" {
+			t.Errorf("unexpected output: %s", buf.String())
+		}
+	})
+}
+
+func TestApp_retryNow(t *testing.T) {
+	a, rm, _ := newTestApp(formatTable)
+
+	if err := a.run(context.Background(), "retry-now", []string{"-topic", "product", "-ids", "4", "-actor", "jane"}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if rm.action != "retry-now" || rm.topic != "product" || rm.actor != "jane" {
+		t.Errorf("unexpected %s of '%s' by '%s'", rm.action, rm.topic, rm.actor)
+	}
+	if diff := deep.Equal([]int64{4}, rm.ids); diff != nil {
+		t.Error(diff)
+	}
+
+	if err := a.run(context.Background(), "retry-now", []string{"-ids", "4,x"}); err == nil {
+		t.Error("expected an error for invalid IDs but got nil")
+	}
+}
+
+func TestApp_retryNow_WithoutFilter(t *testing.T) {
+	a, rm, _ := newTestApp(formatTable)
+
+	if err := a.run(context.Background(), "retry-now", nil); err == nil {
+		t.Error("expected an error but got nil")
+	}
+	if rm.action != "" {
+		t.Error("retries were retried without -all")
+	}
+
+	if err := a.run(context.Background(), "retry-now", []string{"-all"}); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+	if rm.action != "retry-now" {
+		t.Error("retries were not retried with -all")
+	}
+}
+
+func TestApp_summary(t *testing.T) {
+	a, rm, buf := newTestApp(formatCSV)
+	rm.summaries = []model.TopicSummary{
+		{Topic: "payment", Errored: 1, DeadLettered: 2},
+		{Topic: "product", Pending: 4, DeadLettered: 3, Successful: 6},
+	}
+
+	if err := a.run(context.Background(), "summary", nil); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	exp := "topic,pending,errored,deadlettered,successful\npayment,0,1,2,0\nproduct,4,0,3,6\nTOTAL,4,1,5,6\n"
+	if buf.String() != exp {
+		t.Errorf("expected output:\n%s\ngot:\n%s", exp, buf.String())
+	}
+}
+
+func TestApp_migrate(t *testing.T) {
+	a, _, _ := newTestApp(formatTable)
+	a.migrate = func() error {
+		return errors.New("oops")
+	}
+
+	if err := a.run(context.Background(), "migrate", nil); err == nil {
+		t.Error("expected an error but got nil")
+	}
+}
+
+func TestApp_unknownCommand(t *testing.T) {
+	a, _, _ := newTestApp(formatTable)
+
+	if err := a.run(context.Background(), "frobnicate", nil); err == nil {
+		t.Error("expected an error but got nil")
+	}
+}
@@ -0,0 +1,80 @@
+// Command kafka-consumer-admin inspects and operates the retry database used by consumers that
+// are configured to store retries in the database. It connects with the same settings as
+// config.Builder, which can be given as flags or as environment variables.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+
+	"github.com/inviqa/kafka-consumer-go/data"
+	"github.com/inviqa/kafka-consumer-go/data/deadletter"
+	"github.com/inviqa/kafka-consumer-go/data/retry"
+)
+
+func main() {
+	if err := run(os.Args[1:]); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			os.Exit(2)
+		}
+		fmt.Fprintf(os.Stderr, "kafka-consumer-admin: %s\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(args []string) error {
+	fs := flag.NewFlagSet("kafka-consumer-admin", flag.ContinueOnError)
+	s := newSettings(fs)
+	format := fs.String("format", formatTable, "output format, one of table, json or csv")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: kafka-consumer-admin [flags] <command> [command flags]\n\nCommands:\n%s\nFlags:\n", commandUsage)
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return flag.ErrHelp
+	}
+
+	out, err := newOutput(os.Stdout, *format)
+	if err != nil {
+		return err
+	}
+
+	b, err := s.builder()
+	if err != nil {
+		return err
+	}
+
+	cfg, err := b.Config()
+	if err != nil {
+		return err
+	}
+
+	db, err := cfg.DB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	a := &app{
+		retries:     retry.NewManagerWithDefaults(cfg.DBRetries, db),
+		deadLetters: deadletter.NewRepository(db),
+		migrate: func() error {
+			return data.MigrateDatabase(db, cfg.DBSchema())
+		},
+		out: out,
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	return a.run(ctx, fs.Arg(0), fs.Args()[1:])
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/inviqa/kafka-consumer-go/data/retry/model"
+)
+
+// Output formats.
+const (
+	formatTable = "table"
+	formatJSON  = "json"
+	formatCSV   = "csv"
+)
+
+var retryColumns = []string{"id", "topic", "key", "partition", "offset", "attempts", "state", "next_retry_at", "created_at", "updated_at", "last_error"}
+
+type output struct {
+	w      io.Writer
+	format string
+}
+
+func newOutput(w io.Writer, format string) (*output, error) {
+	switch format {
+	case formatTable, formatJSON, formatCSV:
+		return &output{w: w, format: format}, nil
+	default:
+		return nil, fmt.Errorf("unknown output format '%s', must be one of table, json or csv", format)
+	}
+}
+
+// retryRow returns the columns of v, in the order of retryColumns.
+func retryRow(v model.View) []string {
+	next := ""
+	if v.NextRetryAt != nil {
+		next = formatTime(*v.NextRetryAt)
+	}
+
+	return []string{
+		strconv.FormatInt(v.ID, 10),
+		v.Topic,
+		v.Key,
+		strconv.Itoa(int(v.Partition)),
+		strconv.FormatInt(v.Offset, 10),
+		strconv.Itoa(int(v.Attempts)),
+		v.State,
+		next,
+		formatTime(v.CreatedAt),
+		formatTime(v.UpdatedAt),
+		v.LastError,
+	}
+}
+
+func (o *output) retries(retries []model.Retry) error {
+	views := make([]model.View, 0, len(retries))
+	rows := make([][]string, 0, len(retries))
+	for _, r := range retries {
+		v := model.NewView(r)
+		views = append(views, v)
+		rows = append(rows, retryRow(v))
+	}
+
+	if o.format == formatJSON {
+		return o.json(views)
+	}
+	return o.rows(retryColumns, rows)
+}
+
+// retry outputs a single retry with its payload and headers. Tables and CSV are written with a
+// row for each field, as the payload is too long to fit in a column.
+func (o *output) retry(r model.Retry) error {
+	v := model.NewDetailedView(r)
+	if o.format == formatJSON {
+		return o.json(v)
+	}
+
+	var rows [][]string
+	for i, value := range retryRow(v) {
+		rows = append(rows, []string{retryColumns[i], value})
+	}
+
+	keys := make([]string, 0, len(v.Headers))
+	for k := range v.Headers {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		rows = append(rows, []string{"header." + k, v.Headers[k]})
+	}
+
+	payload := string(r.PayloadJSON)
+	if raw, ok := v.Payload.(json.RawMessage); ok {
+		if b, err := json.MarshalIndent(raw, "", "  "); err == nil {
+			payload = string(b)
+		}
+	}
+
+	if o.format == formatCSV {
+		return o.rows([]string{"field", "value"}, append(rows, []string{"payload", payload}))
+	}
+
+	if err := o.rows(nil, rows); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintf(o.w, "\npayload:\n%s\n", payload)
+	return err
+}
+
+// summary outputs the retry counts for each topic, followed by a total. The total number of
+// dead-lettered retries is given separately, as it is counted by the dead-letter repository.
+func (o *output) summary(summaries []model.TopicSummary, deadLettered uint) error {
+	if o.format == formatJSON {
+		if summaries == nil {
+			summaries = []model.TopicSummary{}
+		}
+		return o.json(struct {
+			Topics       []model.TopicSummary `json:"topics"`
+			DeadLettered uint                 `json:"deadlettered"`
+		}{summaries, deadLettered})
+	}
+
+	total := model.TopicSummary{Topic: "TOTAL"}
+	var rows [][]string
+	for _, s := range summaries {
+		rows = append(rows, summaryRow(s))
+		total.Pending += s.Pending
+		total.Errored += s.Errored
+		total.Successful += s.Successful
+	}
+	total.DeadLettered = int(deadLettered)
+	rows = append(rows, summaryRow(total))
+
+	return o.rows([]string{"topic", "pending", "errored", "deadlettered", "successful"}, rows)
+}
+
+func summaryRow(s model.TopicSummary) []string {
+	return []string{
+		s.Topic,
+		strconv.Itoa(s.Pending),
+		strconv.Itoa(s.Errored),
+		strconv.Itoa(s.DeadLettered),
+		strconv.Itoa(s.Successful),
+	}
+}
+
+// changed outputs the number of retries changed by an action.
+func (o *output) changed(action string, n int64) error {
+	switch o.format {
+	case formatJSON:
+		return o.json(struct {
+			Action  string `json:"action"`
+			Changed int64  `json:"changed"`
+		}{action, n})
+	case formatCSV:
+		return o.rows([]string{"action", "changed"}, [][]string{{action, strconv.FormatInt(n, 10)}})
+	default:
+		_, err := fmt.Fprintf(o.w, "%s: %d retries changed\n", action, n)
+		return err
+	}
+}
+
+func (o *output) message(msg string) error {
+	if o.format == formatJSON {
+		return o.json(struct {
+			Message string `json:"message"`
+		}{msg})
+	}
+	_, err := fmt.Fprintln(o.w, msg)
+	return err
+}
+
+func (o *output) json(v interface{}) error {
+	enc := json.NewEncoder(o.w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// rows writes the header and rows as CSV, or as an aligned table. The header is upper-cased in
+// tables, and is not written if it is nil.
+func (o *output) rows(header []string, rows [][]string) error {
+	if o.format == formatCSV {
+		cw := csv.NewWriter(o.w)
+		if header != nil {
+			_ = cw.Write(header)
+		}
+		_ = cw.WriteAll(rows)
+		return cw.Error()
+	}
+
+	tw := tabwriter.NewWriter(o.w, 0, 0, 2, ' ', 0)
+	if header != nil {
+		fmt.Fprintln(tw, strings.ToUpper(strings.Join(header, "\t")))
+	}
+	for _, r := range rows {
+		fmt.Fprintln(tw, strings.Join(r, "\t"))
+	}
+	return tw.Flush()
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(time.RFC3339)
+}
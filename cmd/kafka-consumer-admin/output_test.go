@@ -0,0 +1,109 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/go-test/deep"
+
+	"github.com/inviqa/kafka-consumer-go/data/retry/model"
+)
+
+func TestNewOutput(t *testing.T) {
+	for _, f := range []string{formatTable, formatJSON, formatCSV} {
+		if _, err := newOutput(&bytes.Buffer{}, f); err != nil {
+			t.Errorf("unexpected error for format '%s': %s", f, err)
+		}
+	}
+
+	if _, err := newOutput(&bytes.Buffer{}, "yaml"); err == nil {
+		t.Error("expected an error for an unknown format but got nil")
+	}
+}
+
+func TestOutput_retries(t *testing.T) {
+	created := time.Date(2022, 6, 1, 12, 0, 0, 0, time.UTC)
+	retries := []model.Retry{{ID: 1, Topic: "product", PayloadKey: []byte("SKU-1"), Attempts: 1, CreatedAt: created, UpdatedAt: created}}
+
+	t.Run("as a table", func(t *testing.T) {
+		buf := &bytes.Buffer{}
+		out, _ := newOutput(buf, formatTable)
+
+		if err := out.retries(retries); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+
+		exp := "ID  TOPIC    KEY    PARTITION  OFFSET  ATTEMPTS  STATE    NEXT_RETRY_AT  CREATED_AT            UPDATED_AT            LAST_ERROR\n" +
+			"1   product  SKU-1  0          0       1         pending                 2022-06-01T12:00:00Z  2022-06-01T12:00:00Z  \n"
+		if buf.String() != exp {
+			t.Errorf("expected output:\n%s\ngot:\n%s", exp, buf.String())
+		}
+	})
+
+	t.Run("as JSON", func(t *testing.T) {
+		buf := &bytes.Buffer{}
+		out, _ := newOutput(buf, formatJSON)
+
+		if err := out.retries(retries); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+
+		var got []map[string]interface{}
+		if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+			t.Fatalf("output is not valid JSON: %s", err)
+		}
+
+		exp := []map[string]interface{}{{
+			"id":         float64(1),
+			"topic":      "product",
+			"key":        "SKU-1",
+			"partition":  float64(0),
+			"offset":     float64(0),
+			"attempts":   float64(1),
+			"state":      "pending",
+			"created_at": "2022-06-01T12:00:00Z",
+			"updated_at": "2022-06-01T12:00:00Z",
+			"last_error": "",
+		}}
+		if diff := deep.Equal(exp, got); diff != nil {
+			t.Error(diff)
+		}
+	})
+}
+
+func TestOutput_retry(t *testing.T) {
+	t.Run("a JSON payload is nested in JSON output", func(t *testing.T) {
+		buf := &bytes.Buffer{}
+		out, _ := newOutput(buf, formatJSON)
+
+		r := model.Retry{ID: 1, PayloadJSON: []byte(`{"sku":"A1"}`), PayloadHeaders: []byte(`{"x-attempts":"2"}`)}
+		if err := out.retry(r); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+
+		var got struct {
+			Headers map[string]string
+			Payload map[string]string
+		}
+		if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+			t.Fatalf("output is not valid JSON: %s", err)
+		}
+		if got.Headers["x-attempts"] != "2" || got.Payload["sku"] != "A1" {
+			t.Errorf("unexpected output: %s", buf.String())
+		}
+	})
+
+	t.Run("other payloads are output as a string", func(t *testing.T) {
+		buf := &bytes.Buffer{}
+		out, _ := newOutput(buf, formatCSV)
+
+		if err := out.retry(model.Retry{ID: 1, PayloadJSON: []byte("not json")}); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if !bytes.HasSuffix(buf.Bytes(), []byte("payload,not json\n")) {
+			t.Errorf("unexpected output: %s", buf.String())
+		}
+	})
+}
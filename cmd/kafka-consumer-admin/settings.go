@@ -0,0 +1,132 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/inviqa/kafka-consumer-go/config"
+)
+
+// settings holds the flags used to build the consumer config. Each flag defaults to the
+// environment variable named in its usage, so the settings of a consumer service can be reused.
+type settings struct {
+	kafkaHost      string
+	kafkaGroup     string
+	sourceTopics   string
+	retryIntervals string
+	dbDriver       string
+	dbHost         string
+	dbPort         string
+	dbSchema       string
+	dbUser         string
+	dbPass         string
+	tlsEnable      bool
+	dbCACert       string
+	dbClientCert   string
+	dbClientKey    string
+}
+
+func newSettings(fs *flag.FlagSet) *settings {
+	s := &settings{}
+
+	str := func(p *string, name, env, usage string) {
+		fs.StringVar(p, name, os.Getenv(env), fmt.Sprintf("%s (env %s)", usage, env))
+	}
+	str(&s.kafkaHost, "kafka-host", "KAFKA_HOST", "comma separated Kafka hosts")
+	str(&s.kafkaGroup, "kafka-group", "KAFKA_GROUP", "Kafka consumer group")
+	str(&s.sourceTopics, "source-topics", "KAFKA_SOURCE_TOPICS", "comma separated source topics")
+	str(&s.retryIntervals, "retry-intervals", "KAFKA_RETRY_INTERVALS", "comma separated retry intervals, in seconds")
+	str(&s.dbDriver, "db-driver", "DB_DRIVER", "database driver, postgres or mysql, postgres if not set")
+	str(&s.dbHost, "db-host", "DB_HOST", "database host")
+	str(&s.dbPort, "db-port", "DB_PORT", "database port, 5432 if not set")
+	str(&s.dbSchema, "db-schema", "DB_SCHEMA", "database schema")
+	str(&s.dbUser, "db-user", "DB_USER", "database user")
+	// the password is not used as the flag default, so that it is not printed in the usage
+	fs.StringVar(&s.dbPass, "db-pass", "", "database password (env DB_PASS)")
+	str(&s.dbCACert, "db-ca-cert", "DB_TLS_CA_CERT", "database CA certificate path")
+	str(&s.dbClientCert, "db-client-cert", "DB_TLS_CLIENT_CERT", "database client certificate path")
+	str(&s.dbClientKey, "db-client-key", "DB_TLS_CLIENT_KEY", "database client key path")
+
+	tls, _ := strconv.ParseBool(os.Getenv("TLS_ENABLE"))
+	fs.BoolVar(&s.tlsEnable, "tls", tls, "connect to the database using TLS (env TLS_ENABLE)")
+
+	return s
+}
+
+// builder returns a config builder with the settings, configured to use the database for retries.
+func (s *settings) builder() (*config.Builder, error) {
+	intervals, err := intList(s.retryIntervals)
+	if err != nil {
+		return nil, fmt.Errorf("invalid retry intervals: %w", err)
+	}
+
+	pass := s.dbPass
+	if pass == "" {
+		pass = os.Getenv("DB_PASS")
+	}
+
+	b := config.NewBuilder().
+		SetKafkaHost(stringList(s.kafkaHost)).
+		SetKafkaGroup(s.kafkaGroup).
+		SetSourceTopics(stringList(s.sourceTopics)).
+		SetRetryIntervals(intervals).
+		UseDbForRetries(true).
+		SetDBHost(s.dbHost).
+		SetDBSchema(s.dbSchema).
+		SetDBUser(s.dbUser).
+		SetDBPass(pass).
+		EnableTLS(s.tlsEnable).
+		SetDBTLSCACert(s.dbCACert).
+		SetDBTLSClientCert(s.dbClientCert, s.dbClientKey)
+
+	if s.dbDriver != "" {
+		b.SetDBDriver(s.dbDriver)
+	}
+
+	if s.dbPort != "" {
+		port, err := strconv.Atoi(s.dbPort)
+		if err != nil {
+			return nil, fmt.Errorf("invalid database port: %w", err)
+		}
+		b.SetDBPort(port)
+	}
+
+	return b, nil
+}
+
+func stringList(s string) []string {
+	var l []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			l = append(l, v)
+		}
+	}
+	return l
+}
+
+func intList(s string) ([]int, error) {
+	var l []int
+	for _, v := range stringList(s) {
+		i, err := strconv.Atoi(v)
+		if err != nil {
+			return nil, err
+		}
+		l = append(l, i)
+	}
+	return l, nil
+}
+
+func int64List(s string) ([]int64, error) {
+	var l []int64
+	for _, v := range stringList(s) {
+		i, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		l = append(l, i)
+	}
+	return l, nil
+}
@@ -18,7 +18,7 @@ type collection interface {
 	close()
 }
 
-func connectToKafka(cfg *config.Config, saramaCfg *sarama.Config, logger log.Logger) (sarama.ConsumerGroup, error) {
+func connectToKafka(cfg *config.Config, saramaCfg *sarama.Config, logger log.StructuredLogger) (sarama.ConsumerGroup, error) {
 	var cl sarama.ConsumerGroup
 	var err error
 
@@ -34,7 +34,7 @@ func connectToKafka(cfg *config.Config, saramaCfg *sarama.Config, logger log.Log
 			return nil, fmt.Errorf("error occurred creating Kafka consumer group client: %w", err)
 		}
 
-		logger.Info("Kafka cluster is not reachable, retrying...")
+		log.Info(logger, "Kafka cluster is not reachable, retrying...")
 		time.Sleep(connectionInterval)
 	}
 
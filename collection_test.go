@@ -16,7 +16,7 @@ type testKafkaConnector struct {
 }
 
 // connectToKafka satisfies the kafkaConnector type and is used from tests
-func (t testKafkaConnector) connectToKafka(cfg *config.Config, saramaCfg *sarama.Config, logger log.Logger) (sarama.ConsumerGroup, error) {
+func (t testKafkaConnector) connectToKafka(cfg *config.Config, saramaCfg *sarama.Config, logger log.StructuredLogger) (sarama.ConsumerGroup, error) {
 	if t.willError {
 		return nil, errors.New("oops")
 	}
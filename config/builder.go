@@ -1,12 +1,17 @@
 package config
 
-import "time"
+import (
+	"time"
+
+	"github.com/Shopify/sarama"
+)
 
 type Builder struct {
 	kafkaHost           []string
 	kafkaGroup          string
 	sourceTopics        []string
 	retryIntervals      []int
+	retryPolicies       map[string]RetryPolicy
 	dBHost              string
 	dBPort              int
 	dBSchema            string
@@ -18,6 +23,13 @@ type Builder struct {
 	topicNameGenerator  topicNameGenerator
 	tlsEnable           bool
 	tlsSkipVerifyPeer   bool
+	kafkaTLS            TLSFiles
+	sasl                SASL
+	dBTLS               TLSFiles
+	workerCount         int
+	healthCheckAddr     string
+	saramaConfig        *sarama.Config
+	saramaConfigMutator func(*sarama.Config)
 }
 
 func NewBuilder() *Builder {
@@ -26,6 +38,7 @@ func NewBuilder() *Builder {
 		maintenanceInterval: defaultMaintenanceInterval,
 		dBPort:              5432,
 		dBDriver:            "postgres",
+		workerCount:         1,
 	}
 }
 
@@ -49,6 +62,16 @@ func (cb *Builder) SetRetryIntervals(intervals []int) *Builder {
 	return cb
 }
 
+// SetRetryPolicy sets the retry chain for the given source topic, instead of the intervals given
+// to SetRetryIntervals, which are used for source topics without a policy.
+func (cb *Builder) SetRetryPolicy(topic string, p RetryPolicy) *Builder {
+	if cb.retryPolicies == nil {
+		cb.retryPolicies = map[string]RetryPolicy{}
+	}
+	cb.retryPolicies[topic] = p
+	return cb
+}
+
 func (cb *Builder) SetDBHost(host string) *Builder {
 	cb.dBHost = host
 	return cb
@@ -74,6 +97,13 @@ func (cb *Builder) SetDBPass(pass string) *Builder {
 	return cb
 }
 
+// SetDBDriver sets the driver used to connect to the database for retries, which is one of
+// "postgres" (the default) or "mysql". Remember to also set the port when using MySQL.
+func (cb *Builder) SetDBDriver(driver string) *Builder {
+	cb.dBDriver = driver
+	return cb
+}
+
 func (cb *Builder) UseDbForRetries(useDbForRetries bool) *Builder {
 	cb.useDbForRetries = useDbForRetries
 	return cb
@@ -94,6 +124,81 @@ func (cb *Builder) SkipTLSVerifyPeer(tlsSkipVerifyPeer bool) *Builder {
 	return cb
 }
 
+// SetTLSCACert sets the path of a PEM encoded CA bundle used to verify the Kafka brokers when
+// TLS is enabled. The system CA pool is used if this is not set.
+func (cb *Builder) SetTLSCACert(path string) *Builder {
+	cb.kafkaTLS.CACert = path
+	return cb
+}
+
+// SetTLSClientCert sets the paths of a PEM encoded certificate and key that are presented to the
+// Kafka brokers when TLS is enabled, for mutual TLS.
+func (cb *Builder) SetTLSClientCert(certFile, keyFile string) *Builder {
+	cb.kafkaTLS.ClientCert = certFile
+	cb.kafkaTLS.ClientKey = keyFile
+	return cb
+}
+
+// SetSASL enables SASL authentication with the Kafka brokers using the given mechanism, which is
+// one of SASLPlain, SASLScramSHA256 or SASLScramSHA512. Use SetSASLTokenProvider for OAUTHBEARER.
+func (cb *Builder) SetSASL(mechanism SASLMechanism, user, pass string) *Builder {
+	cb.sasl = SASL{Mechanism: mechanism, User: user, Pass: pass}
+	return cb
+}
+
+// SetSASLTokenProvider enables SASL authentication with the Kafka brokers using the OAUTHBEARER
+// mechanism, with access tokens from the given provider.
+func (cb *Builder) SetSASLTokenProvider(tp sarama.AccessTokenProvider) *Builder {
+	cb.sasl = SASL{Mechanism: SASLOAuthBearer, TokenProvider: tp}
+	return cb
+}
+
+// SetDBTLSCACert sets the path of a PEM encoded CA bundle used to verify the database server
+// when TLS is enabled.
+func (cb *Builder) SetDBTLSCACert(path string) *Builder {
+	cb.dBTLS.CACert = path
+	return cb
+}
+
+// SetDBTLSClientCert sets the paths of a PEM encoded certificate and key that are presented to
+// the database server when TLS is enabled.
+func (cb *Builder) SetDBTLSClientCert(certFile, keyFile string) *Builder {
+	cb.dBTLS.ClientCert = certFile
+	cb.dBTLS.ClientKey = keyFile
+	return cb
+}
+
+// SetWorkerCount sets the number of workers that process messages concurrently for each
+// claimed partition. Messages with the same key are always processed in order by the same
+// worker. A count of 1 (the default) processes messages sequentially.
+func (cb *Builder) SetWorkerCount(count int) *Builder {
+	cb.workerCount = count
+	return cb
+}
+
+// SetHealthCheckAddr enables an HTTP server on the given address (e.g. ":8081"), which serves
+// liveness and readiness checks on /healthz and /readyz whilst the consumer is running.
+func (cb *Builder) SetHealthCheckAddr(addr string) *Builder {
+	cb.healthCheckAddr = addr
+	return cb
+}
+
+// SetSaramaConfig sets the Sarama config that the consumer group and the Kafka failure producer
+// are created from, instead of the one returned by NewSaramaConfig. This module still enables
+// the errors and successes channels that it relies on, along with any TLS and SASL settings
+// given to the builder, see Config.SaramaConfig.
+func (cb *Builder) SetSaramaConfig(srmCfg *sarama.Config) *Builder {
+	cb.saramaConfig = srmCfg
+	return cb
+}
+
+// SetSaramaConfigMutator sets a function that can change the Sarama config before it is used,
+// e.g. to set the version, rebalance strategy or fetch sizes, see Config.SaramaConfig.
+func (cb *Builder) SetSaramaConfigMutator(fn func(*sarama.Config)) *Builder {
+	cb.saramaConfigMutator = fn
+	return cb
+}
+
 func (cb *Builder) SetTopicNameGenerator(tng topicNameGenerator) *Builder {
 	cb.topicNameGenerator = tng
 	return cb
@@ -6,6 +6,8 @@ import (
 	"time"
 
 	"github.com/go-test/deep"
+
+	"github.com/inviqa/kafka-consumer-go/data"
 )
 
 func init() {
@@ -18,6 +20,7 @@ func TestNewBuilder(t *testing.T) {
 		maintenanceInterval: time.Hour * 1,
 		topicNameGenerator:  defaultTopicNameGenerator,
 		dBDriver:            "postgres",
+		workerCount:         1,
 	}
 
 	got := NewBuilder()
@@ -65,6 +68,9 @@ func TestBuilder_Config(t *testing.T) {
 					},
 				},
 			},
+			RetryPolicies: map[TopicKey]RetryPolicy{
+				"product": {Intervals: []int{120}},
+			},
 			db: Database{
 				Driver: "postgres",
 				Host:   "postgres",
@@ -72,11 +78,16 @@ func TestBuilder_Config(t *testing.T) {
 				Schema: "schema",
 				User:   "user",
 				Pass:   "pass",
+				TLS:    TLSFiles{CACert: "/certs/db-ca.pem", ClientCert: "/certs/db.pem", ClientKey: "/certs/db.key"},
 			},
+			KafkaTLS:            TLSFiles{CACert: "/certs/ca.pem", ClientCert: "/certs/client.pem", ClientKey: "/certs/client.key"},
+			SASL:                SASL{Mechanism: SASLScramSHA512, User: "kafka", Pass: "secret"},
 			MaintenanceInterval: time.Hour * 2,
 			TLSEnable:           true,
 			TLSSkipVerifyPeer:   true,
 			UseDBForRetryQueue:  true,
+			WorkerCount:         5,
+			HealthCheckAddr:     ":8081",
 			services:            map[string]interface{}{},
 		}
 
@@ -94,7 +105,14 @@ func TestBuilder_Config(t *testing.T) {
 			UseDbForRetries(true).
 			EnableTLS(true).
 			SkipTLSVerifyPeer(true).
+			SetTLSCACert("/certs/ca.pem").
+			SetTLSClientCert("/certs/client.pem", "/certs/client.key").
+			SetSASL(SASLScramSHA512, "kafka", "secret").
+			SetDBTLSCACert("/certs/db-ca.pem").
+			SetDBTLSClientCert("/certs/db.pem", "/certs/db.key").
 			SetMaintenanceInterval(time.Hour * 2).
+			SetWorkerCount(5).
+			SetHealthCheckAddr(":8081").
 			Config()
 		if err != nil {
 			t.Fatalf("unexpected error: %s", err)
@@ -126,6 +144,9 @@ func TestBuilder_Config(t *testing.T) {
 			DBRetries: map[string][]*DBTopicRetry{
 				"product": {},
 			},
+			RetryPolicies: map[TopicKey]RetryPolicy{
+				"product": {},
+			},
 			db: Database{
 				Driver: "postgres",
 				Host:   "postgres",
@@ -135,6 +156,7 @@ func TestBuilder_Config(t *testing.T) {
 				Pass:   "pass",
 			},
 			MaintenanceInterval: time.Hour * 1,
+			WorkerCount:         1,
 			services:            map[string]interface{}{},
 		}
 
@@ -186,6 +208,44 @@ func TestBuilder_Config(t *testing.T) {
 		}
 	})
 
+	t.Run("it returns an error if the database driver is not supported", func(t *testing.T) {
+		_, err := NewBuilder().
+			SetKafkaHost([]string{"broker1"}).
+			SetKafkaGroup("group").
+			SetSourceTopics([]string{"product"}).
+			SetDBDriver("sqlite3").
+			SetDBHost("postgres").
+			SetDBPass("pass").
+			SetDBUser("user").
+			SetDBSchema("schema").
+			Config()
+
+		if err == nil {
+			t.Error("expected an error but got nil")
+		}
+	})
+
+	t.Run("it uses the mysql database driver when set", func(t *testing.T) {
+		cfg, err := NewBuilder().
+			SetKafkaHost([]string{"broker1"}).
+			SetKafkaGroup("group").
+			SetSourceTopics([]string{"product"}).
+			SetDBDriver("mysql").
+			SetDBHost("mysql").
+			SetDBPort(3306).
+			SetDBPass("pass").
+			SetDBUser("user").
+			SetDBSchema("schema").
+			Config()
+
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if cfg.DBDialect() != data.DialectMySQL {
+			t.Errorf("expected the %s dialect, but got %s", data.DialectMySQL, cfg.DBDialect())
+		}
+	})
+
 	t.Run("it returns an error if no source topics are set", func(t *testing.T) {
 		_, err := NewBuilder().
 			SetKafkaHost([]string{"broker1"}).
@@ -1,14 +1,20 @@
 package config
 
 import (
+	"crypto/sha256"
 	"database/sql"
+	"encoding/hex"
 	"errors"
 	"fmt"
+	"net"
 	"net/url"
 	"strconv"
 	"strings"
 	"time"
 
+	"github.com/Shopify/sarama"
+	"github.com/go-sql-driver/mysql"
+
 	"github.com/inviqa/kafka-consumer-go/data"
 )
 
@@ -22,13 +28,25 @@ type Config struct {
 	ConsumableTopics []*KafkaTopic
 	TopicMap         map[TopicKey]*KafkaTopic
 	// DBRetries is indexed by the topic name, and represents retry intervals for processing retries in the DB
-	DBRetries           DBRetries
-	TLSEnable           bool
-	TLSSkipVerifyPeer   bool
+	DBRetries DBRetries
+	// RetryPolicies is indexed by the source topic name, and holds the policy used for each retry chain
+	RetryPolicies     map[TopicKey]RetryPolicy
+	TLSEnable         bool
+	TLSSkipVerifyPeer bool
+	// KafkaTLS holds the CA and client certificates used to connect to Kafka when TLS is enabled
+	KafkaTLS TLSFiles
+	// SASL holds the settings used to authenticate with Kafka, it is not used if no mechanism is set
+	SASL                SASL
 	db                  Database
 	UseDBForRetryQueue  bool
 	MaintenanceInterval time.Duration
+	// WorkerCount is the number of concurrent workers used to process messages for each claimed partition
+	WorkerCount int
+	// HealthCheckAddr is the address to serve health checks on, they are not served if this is empty
+	HealthCheckAddr     string
 	topicNameGenerator  topicNameGenerator
+	saramaConfig        *sarama.Config
+	saramaConfigMutator func(*sarama.Config)
 
 	// memoized services
 	services map[string]interface{}
@@ -39,6 +57,8 @@ type KafkaTopic struct {
 	Delay time.Duration
 	Key   TopicKey
 	Next  *KafkaTopic
+	// Jitter is the fraction that Delay is randomly varied by, see Backoff.Jitter
+	Jitter float64
 }
 
 type Database struct {
@@ -48,6 +68,8 @@ type Database struct {
 	User   string
 	Pass   string
 	Driver string
+	// TLS holds the CA and client certificates used to connect to the database when TLS is enabled
+	TLS TLSFiles
 }
 
 type TopicKey string
@@ -68,6 +90,152 @@ func (cfg *Config) NextTopicNameInChain(currentTopic string) (string, error) {
 	return next.Name, nil
 }
 
+// DeadLetterTopicNameInChain returns the name of the dead-letter topic at the end of the
+// chain that currentTopic belongs to.
+func (cfg *Config) DeadLetterTopicNameInChain(currentTopic string) (string, error) {
+	topic, ok := cfg.TopicMap[TopicKey(currentTopic)]
+	if !ok {
+		return "", fmt.Errorf("topic not found")
+	}
+
+	if topic.Next == nil {
+		return "", fmt.Errorf("there is no next topic in the chain")
+	}
+
+	for topic.Next != nil {
+		topic = topic.Next
+	}
+
+	return topic.Name, nil
+}
+
+// RetryTopicNameInChain returns the name of the topic that a message from currentTopic is sent to
+// once it has failed the given number of attempts. This is the retry topic of its next retry, or
+// the dead-letter topic if it has no retries left. Retries can share a retry topic, see
+// RetryPolicy.
+func (cfg *Config) RetryTopicNameInChain(currentTopic string, attempts int) (string, error) {
+	next, _, err := cfg.nextRetry(currentTopic, attempts)
+	if err != nil {
+		return "", err
+	}
+
+	return next.Name, nil
+}
+
+// RetryDelayInChain returns the delay, with jitter applied, before the next retry of a message
+// from currentTopic that has failed the given number of attempts. It is zero if the message has
+// no retries left.
+func (cfg *Config) RetryDelayInChain(currentTopic string, attempts int) time.Duration {
+	next, delay, err := cfg.nextRetry(currentTopic, attempts)
+	if err != nil || next.Next == nil {
+		return 0
+	}
+
+	return applyJitter(delay, next.Jitter)
+}
+
+// ClosestRetryTopicNameInChain returns the name of the retry topic, from fromTopic onwards in its
+// chain, with the delay closest to the given delay. When two retry topics are equally close, the
+// one with the longer delay is used. The dead-letter topic name is returned if fromTopic is the
+// dead-letter topic.
+func (cfg *Config) ClosestRetryTopicNameInChain(fromTopic string, delay time.Duration) (string, error) {
+	topic, ok := cfg.TopicMap[TopicKey(fromTopic)]
+	if !ok {
+		return "", fmt.Errorf("topic not found")
+	}
+
+	if cfg.TopicMap[topic.Key] == topic {
+		return "", fmt.Errorf("topic is not a retry or dead-letter topic")
+	}
+
+	closest := topic
+	for t := topic; t.Next != nil; t = t.Next {
+		if absDuration(t.Delay-delay) <= absDuration(closest.Delay-delay) {
+			closest = t
+		}
+	}
+
+	return closest.Name, nil
+}
+
+// nextRetry returns the topic and delay of the next retry of a message from currentTopic that has
+// failed the given number of attempts, or the dead-letter topic if it has no retries left.
+func (cfg *Config) nextRetry(currentTopic string, attempts int) (*KafkaTopic, time.Duration, error) {
+	topic, ok := cfg.TopicMap[TopicKey(currentTopic)]
+	if !ok {
+		return nil, 0, fmt.Errorf("topic not found")
+	}
+
+	if topic.Next == nil {
+		return nil, 0, fmt.Errorf("there is no next topic in the chain")
+	}
+
+	// the Nth retry follows the Nth failed attempt, but a message in a retry topic has had at least
+	// the first retry in that topic, which can be more than its failed attempts if a handler asked
+	// for a longer delay, see ClosestRetryTopicNameInChain
+	next := attempts
+	retries := cfg.retries(topic.Key)
+	for i, r := range retries {
+		if r.topic == topic {
+			if next < i+2 {
+				next = i + 2
+			}
+			break
+		}
+	}
+	if next < 1 {
+		next = 1
+	}
+
+	if next > len(retries) {
+		for topic.Next != nil {
+			topic = topic.Next
+		}
+		return topic, 0, nil
+	}
+
+	r := retries[next-1]
+	return r.topic, r.delay, nil
+}
+
+// chainRetry is the Kafka retry topic and delay of a retry.
+type chainRetry struct {
+	topic *KafkaTopic
+	delay time.Duration
+}
+
+// retries returns each retry in the chain of the given source topic. Chains without a retry
+// policy, e.g. those that were not created by the Builder, retry once in each of their retry
+// topics.
+func (cfg *Config) retries(key TopicKey) []chainRetry {
+	main, ok := cfg.TopicMap[key]
+	if !ok {
+		return nil
+	}
+
+	var topics []*KafkaTopic
+	for t := main.Next; t != nil && t.Next != nil; t = t.Next {
+		topics = append(topics, t)
+	}
+
+	policy, ok := cfg.RetryPolicies[key]
+	delays := policy.retryDelays()
+	topicDelays, retryTopic := policy.retryTopics(delays)
+	if !ok || len(topicDelays) != len(topics) {
+		retries := make([]chainRetry, len(topics))
+		for i, t := range topics {
+			retries[i] = chainRetry{topic: t, delay: t.Delay}
+		}
+		return retries
+	}
+
+	retries := make([]chainRetry, len(delays))
+	for i, d := range delays {
+		retries[i] = chainRetry{topic: topics[retryTopic[i]], delay: d}
+	}
+	return retries
+}
+
 func (cfg *Config) FindTopicKey(topicName string) TopicKey {
 	topic, ok := cfg.TopicMap[TopicKey(topicName)]
 	if !ok {
@@ -77,6 +245,62 @@ func (cfg *Config) FindTopicKey(topicName string) TopicKey {
 	return topic.Key
 }
 
+// TopicStage returns the name of the stage in the retry chain that the given topic belongs to.
+// This is "main" for a main topic, "retryN" for the Nth retry topic, "deadletter" for the
+// dead-letter topic, or "unknown" if the topic is not configured.
+func (cfg *Config) TopicStage(topicName string) string {
+	seq, ok := cfg.RetrySequence(topicName)
+	if !ok {
+		return "unknown"
+	}
+
+	switch {
+	case seq == 0:
+		return "main"
+	case cfg.TopicMap[TopicKey(topicName)].Next == nil:
+		return "deadletter"
+	default:
+		return RetryStage(seq)
+	}
+}
+
+// RetrySequence returns the position of the given topic in its retry chain, where the main
+// topic is 0 and the first retry topic is 1. The second return value is false if the topic is
+// not configured.
+func (cfg *Config) RetrySequence(topicName string) (uint8, bool) {
+	topic, ok := cfg.TopicMap[TopicKey(topicName)]
+	if !ok {
+		return 0, false
+	}
+
+	main, ok := cfg.TopicMap[topic.Key]
+	if !ok {
+		return 0, false
+	}
+
+	var seq uint8
+	for t := main; t != nil; t = t.Next {
+		if t == topic {
+			break
+		}
+		seq++
+	}
+
+	return seq, true
+}
+
+func absDuration(d time.Duration) time.Duration {
+	if d < 0 {
+		return -d
+	}
+	return d
+}
+
+// RetryStage returns the name of the stage in the retry chain for the given retry sequence.
+func RetryStage(sequence uint8) string {
+	return fmt.Sprintf("retry%d", sequence)
+}
+
 // MainTopics will return a slice containing the main topic names from
 // where messages are processed in Kafka. It will not include any of the
 // retry or dead-letter topic names.
@@ -99,15 +323,50 @@ func (cfg *Config) DB() (*sql.DB, error) {
 		return db.(*sql.DB), nil
 	}
 
-	db, err := data.NewDB(cfg.dsn())
+	dsn := cfg.dsn()
+	if cfg.DBDialect() == data.DialectMySQL {
+		var err error
+		if dsn, err = cfg.mysqlDSN(); err != nil {
+			return nil, err
+		}
+	}
+
+	db, err := data.NewDB(cfg.DBDialect(), dsn)
 	cfg.services["db"] = db
 	return db, err
 }
 
-func (cfg *Config) addTopicsFromSource(topics []string, retryIntervals []int) error {
+// DBDialect returns the SQL dialect of the database used for retries, based on the driver.
+func (cfg *Config) DBDialect() data.Dialect {
+	// the driver is validated when the config is loaded
+	d, _ := data.DialectForDriver(cfg.db.Driver)
+	return d
+}
+
+func (cfg *Config) addTopicsFromSource(topics []string, retryIntervals []int, policies map[string]RetryPolicy) error {
 	cfg.DBRetries = map[string][]*DBTopicRetry{}
+	cfg.RetryPolicies = map[TopicKey]RetryPolicy{}
+
+	sources := map[string]bool{}
+	for _, topic := range topics {
+		sources[topic] = true
+	}
+	for topic := range policies {
+		if !sources[topic] {
+			return fmt.Errorf("consumer/config: a retry policy was set for '%s', which is not a source topic", topic)
+		}
+	}
 
 	for _, topic := range topics {
+		policy, ok := policies[topic]
+		if !ok {
+			policy = RetryPolicy{Intervals: retryIntervals}
+		}
+		if err := policy.validate(); err != nil {
+			return fmt.Errorf("consumer/config: invalid retry policy for '%s': %w", topic, err)
+		}
+		cfg.RetryPolicies[TopicKey(topic)] = policy
+
 		// main topic
 		derivedTopics := []*KafkaTopic{
 			{
@@ -117,29 +376,29 @@ func (cfg *Config) addTopicsFromSource(topics []string, retryIntervals []int) er
 		}
 		cfg.DBRetries[topic] = []*DBTopicRetry{}
 
-		// retry topics
-		sequence := uint8(1)
-		for i, interval := range retryIntervals {
-			d, err := time.ParseDuration(strconv.Itoa(interval) + "s")
-			if err != nil {
-				return fmt.Errorf("consumer/config: could not parse delay in seconds %d in KAFKA_RETRY_INTERVALS env var: %v", interval, topics)
-			}
+		// retry topics, which can be shared by retries, see RetryPolicy.retryTopics
+		delays := policy.retryDelays()
+		topicDelays, _ := policy.retryTopics(delays)
+		for i, d := range topicDelays {
 			rt := &KafkaTopic{
-				Name:  cfg.topicNameGenerator(cfg.Group, topic, fmt.Sprintf("retry%d", i+1)),
-				Delay: d,
-				Key:   TopicKey(topic),
-			}
-
-			dbRetry := &DBTopicRetry{
-				Interval: d,
-				Sequence: sequence,
-				Key:      rt.Key,
+				Name:   cfg.topicNameGenerator(cfg.Group, topic, fmt.Sprintf("retry%d", i+1)),
+				Delay:  d,
+				Key:    TopicKey(topic),
+				Jitter: policy.jitter(),
 			}
 
 			derivedTopics[i].Next = rt
 			derivedTopics = append(derivedTopics, rt)
-			cfg.DBRetries[topic] = append(cfg.DBRetries[topic], dbRetry)
-			sequence++
+		}
+
+		// DB retries, one for each retry
+		for i, d := range delays {
+			cfg.DBRetries[topic] = append(cfg.DBRetries[topic], &DBTopicRetry{
+				Interval: d,
+				Sequence: uint8(i + 1),
+				Key:      TopicKey(topic),
+				Jitter:   policy.jitter(),
+			})
 		}
 
 		// deadLetter topic
@@ -164,16 +423,75 @@ func (cfg *Config) dsn() string {
 	}
 
 	return fmt.Sprintf(
-		"%s://%s@%s:%d/%s?sslmode=%s",
+		"%s://%s@%s:%d/%s?sslmode=%s%s",
 		cfg.db.Driver,
 		url.UserPassword(cfg.db.User, cfg.db.Pass),
 		cfg.db.Host,
 		cfg.db.Port,
 		cfg.db.Schema,
 		sslMode,
+		cfg.dsnTLSParams(),
 	)
 }
 
+// dsnTLSParams returns the DSN parameters for any configured database certificates, they are
+// only used when TLS is enabled.
+func (cfg *Config) dsnTLSParams() string {
+	if !cfg.TLSEnable {
+		return ""
+	}
+
+	var params string
+	for _, p := range []struct{ key, value string }{
+		{"sslrootcert", cfg.db.TLS.CACert},
+		{"sslcert", cfg.db.TLS.ClientCert},
+		{"sslkey", cfg.db.TLS.ClientKey},
+	} {
+		if p.value != "" {
+			params += "&" + p.key + "=" + url.QueryEscape(p.value)
+		}
+	}
+
+	return params
+}
+
+// mysqlDSN returns the DSN used to connect to a MySQL database. Times are read and written in
+// UTC, including those from NOW(), so that they can be compared with times from Go.
+func (cfg *Config) mysqlDSN() (string, error) {
+	mc := mysql.NewConfig()
+	mc.User = cfg.db.User
+	mc.Passwd = cfg.db.Pass
+	mc.Net = "tcp"
+	mc.Addr = net.JoinHostPort(cfg.db.Host, strconv.Itoa(cfg.db.Port))
+	mc.DBName = cfg.db.Schema
+	mc.ParseTime = true
+	mc.Params = map[string]string{"time_zone": "'+00:00'"}
+
+	if cfg.TLSEnable {
+		tlsCfg, err := newTLSConfig(cfg.db.TLS, false)
+		if err != nil {
+			return "", fmt.Errorf("consumer/config: unable to configure database TLS: %w", err)
+		}
+		tlsCfg.ServerName = cfg.db.Host
+
+		name := cfg.mysqlTLSConfigName()
+		if err := mysql.RegisterTLSConfig(name, tlsCfg); err != nil {
+			return "", fmt.Errorf("consumer/config: unable to configure database TLS: %w", err)
+		}
+		mc.TLSConfig = name
+	}
+
+	return mc.FormatDSN(), nil
+}
+
+// mysqlTLSConfigName returns the name that the TLS config for MySQL is registered with. TLS
+// configs are registered globally, so the name is derived from the database and certificates,
+// so that configs for different databases in the same process do not replace each other.
+func (cfg *Config) mysqlTLSConfigName() string {
+	h := sha256.Sum256([]byte(fmt.Sprintf("%s:%d/%s|%s|%s|%s", cfg.db.Host, cfg.db.Port, cfg.db.Schema, cfg.db.TLS.CACert, cfg.db.TLS.ClientCert, cfg.db.TLS.ClientKey)))
+	return "kafka-consumer-" + hex.EncodeToString(h[:8])
+}
+
 func (cfg *Config) addTopics(topics []*KafkaTopic) {
 	cfg.ConsumableTopics = append(cfg.ConsumableTopics, topics[:len(topics)-1]...)
 
@@ -190,6 +508,9 @@ func (cfg *Config) loadFromBuilder(b *Builder) error {
 	cfg.Group = b.kafkaGroup
 	cfg.TLSEnable = b.tlsEnable
 	cfg.TLSSkipVerifyPeer = b.tlsSkipVerifyPeer
+	cfg.KafkaTLS = b.kafkaTLS
+	cfg.SASL = b.sasl
+	cfg.db.TLS = b.dBTLS
 	cfg.UseDBForRetryQueue = b.useDbForRetries
 	cfg.db.Host = b.dBHost
 	cfg.db.User = b.dBUser
@@ -198,7 +519,11 @@ func (cfg *Config) loadFromBuilder(b *Builder) error {
 	cfg.db.Port = b.dBPort
 	cfg.db.Driver = b.dBDriver
 	cfg.MaintenanceInterval = b.maintenanceInterval
+	cfg.WorkerCount = b.workerCount
+	cfg.HealthCheckAddr = b.healthCheckAddr
 	cfg.topicNameGenerator = b.topicNameGenerator
+	cfg.saramaConfig = b.saramaConfig
+	cfg.saramaConfigMutator = b.saramaConfigMutator
 
 	retryIntervals := b.retryIntervals
 	sourceTopics := b.sourceTopics
@@ -214,7 +539,11 @@ func (cfg *Config) loadFromBuilder(b *Builder) error {
 		return errors.New("consumer/config: you must define a kafka group")
 	}
 
-	if err := cfg.addTopicsFromSource(sourceTopics, retryIntervals); err != nil {
+	if _, err := data.DialectForDriver(cfg.db.Driver); err != nil {
+		return fmt.Errorf("consumer/config: %w", err)
+	}
+
+	if err := cfg.addTopicsFromSource(sourceTopics, retryIntervals, b.retryPolicies); err != nil {
 		return fmt.Errorf("consumer/config: error loading config with topic names from builder: %w", err)
 	}
 
@@ -222,6 +551,10 @@ func (cfg *Config) loadFromBuilder(b *Builder) error {
 		cfg.MaintenanceInterval = defaultMaintenanceInterval
 	}
 
+	if cfg.WorkerCount < 1 {
+		cfg.WorkerCount = 1
+	}
+
 	return nil
 }
 
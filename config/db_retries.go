@@ -16,6 +16,8 @@ type DBTopicRetry struct {
 	// sequence in the retry flow.
 	Sequence uint8
 	Key      TopicKey
+	// Jitter is the fraction that Interval is randomly varied by, see Backoff.Jitter
+	Jitter float64
 }
 
 // MakeRetryErrored will increment the Attempts field on the retry, and then mark it errored
@@ -41,9 +43,23 @@ func (dr DBRetries) MakeRetrySuccessful(retry model.Retry) model.Retry {
 	return retry
 }
 
+// NextRetryDelay returns the delay before a retry of the topic, which has made the given number
+// of attempts, is next retried, with jitter applied. Each retry gets its own delay, so that
+// retries are spread out, rather than all being retried when the retry sequence is next
+// polled. Zero is returned if the retry sequence has no jitter, in which case its interval is
+// used instead.
+func (dr DBRetries) NextRetryDelay(topic string, attempts uint8) time.Duration {
+	for _, rc := range dr[topic] {
+		if rc.Sequence == attempts && rc.Jitter > 0 {
+			return rc.NextInterval()
+		}
+	}
+	return 0
+}
+
 func (dr DBRetries) maxAttemptsForTopic(topic string) uint8 {
 	retries, ok := dr[topic]
-	if !ok {
+	if !ok || len(retries) == 0 {
 		return 0
 	}
 	last := retries[len(retries)-1]
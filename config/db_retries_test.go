@@ -2,6 +2,7 @@ package config
 
 import (
 	"testing"
+	"time"
 
 	"github.com/go-test/deep"
 
@@ -82,3 +83,25 @@ func TestDBRetries_MakeRetrySuccessful(t *testing.T) {
 		}
 	})
 }
+
+func TestDBRetries_NextRetryDelay(t *testing.T) {
+	retries := DBRetries{
+		"foo": []*DBTopicRetry{
+			{Interval: time.Second * 10, Sequence: 1, Key: "foo", Jitter: 0.2},
+			{Interval: time.Second * 20, Sequence: 2, Key: "foo"},
+		},
+	}
+
+	for i := 0; i < 100; i++ {
+		if got := retries.NextRetryDelay("foo", 1); got < time.Second*8 || got > time.Second*12 {
+			t.Fatalf("expected a delay between 8s and 12s, but got %s", got)
+		}
+	}
+
+	if got := retries.NextRetryDelay("foo", 2); got != 0 {
+		t.Errorf("expected no delay for a retry sequence without jitter, but got %s", got)
+	}
+	if got := retries.NextRetryDelay("bar", 1); got != 0 {
+		t.Errorf("expected no delay for an unknown topic, but got %s", got)
+	}
+}
@@ -0,0 +1,235 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+const (
+	defaultBackoffMultiplier = 2
+	// maxBackoffRetryTopics is the most Kafka retry topics that the retries of a backoff are
+	// spread across, see RetryPolicy.retryTopics
+	maxBackoffRetryTopics = 10
+	// maxRetryAttempts is limited by the retry sequence, which is a uint8, and the dead-letter
+	// stage comes after the last retry, so it must fit as well
+	maxRetryAttempts = math.MaxUint8 - 1
+)
+
+// jitterRand is seeded separately from the global source, so that each process varies its
+// delays differently.
+var jitterRand = struct {
+	sync.Mutex
+	*rand.Rand
+}{Rand: rand.New(rand.NewSource(time.Now().UnixNano()))} // #nosec G404
+
+// RetryPolicy configures the retry chain for a source topic, see Builder.SetRetryPolicy.
+type RetryPolicy struct {
+	// Intervals are the delays, in seconds, before each retry of a failed message. Each must be
+	// more than zero. They are not used if Backoff is set.
+	Intervals []int
+	// MaxAttempts is the number of retries. If this is more than the number of intervals then
+	// the last interval is repeated, and if it is fewer then only the first MaxAttempts intervals
+	// are used. If it is zero then there is one retry for each interval. It is required when
+	// Backoff is set, and cannot be set without Intervals otherwise.
+	MaxAttempts int
+	// DisableDeadLetter discards messages that fail their final retry, or fail permanently,
+	// instead of sending them to the dead-letter topic or marking them as dead-lettered in the DB.
+	DisableDeadLetter bool
+	// Backoff calculates the delay before each retry, instead of Intervals.
+	Backoff *Backoff
+}
+
+// Backoff calculates exponentially increasing delays between retries.
+type Backoff struct {
+	// Initial is the delay before the first retry.
+	Initial time.Duration
+	// Multiplier is applied to the delay after each retry. It defaults to 2.
+	Multiplier float64
+	// Max caps the delay before a retry, there is no cap if it is zero.
+	Max time.Duration
+	// Jitter is the fraction, between 0 and 1, that each delay is randomly varied by, so that
+	// consumers in different processes do not retry at the same moment. For example, a jitter
+	// of 0.2 varies a delay of 10 seconds between 8 and 12 seconds.
+	Jitter float64
+}
+
+func (p RetryPolicy) validate() error {
+	if p.MaxAttempts > maxRetryAttempts {
+		return fmt.Errorf("max attempts cannot be more than %d", maxRetryAttempts)
+	}
+	if p.Backoff == nil {
+		if len(p.Intervals) > maxRetryAttempts {
+			return fmt.Errorf("there cannot be more than %d intervals", maxRetryAttempts)
+		}
+		if p.MaxAttempts > 0 && len(p.Intervals) == 0 {
+			return errors.New("intervals or a backoff must be set when using max attempts")
+		}
+		// a retry topic without a delay would be indistinguishable from a main topic
+		for _, interval := range p.Intervals {
+			if interval <= 0 {
+				return fmt.Errorf("retry intervals must be more than zero, got %d", interval)
+			}
+		}
+		return nil
+	}
+
+	b := p.Backoff
+	switch {
+	case p.MaxAttempts <= 0:
+		return errors.New("max attempts must be set when using a backoff")
+	case b.Initial <= 0:
+		return errors.New("the initial backoff delay must be more than zero")
+	case b.Multiplier != 0 && b.Multiplier < 1:
+		return errors.New("the backoff multiplier cannot be less than 1")
+	case b.Max < 0:
+		return errors.New("the maximum backoff delay cannot be negative")
+	case b.Jitter < 0 || b.Jitter > 1:
+		return errors.New("the backoff jitter must be between 0 and 1")
+	}
+
+	return nil
+}
+
+// retryDelays returns the delay before each retry in the policy.
+func (p RetryPolicy) retryDelays() []time.Duration {
+	if p.Backoff != nil {
+		return p.Backoff.delays(p.MaxAttempts)
+	}
+
+	intervals := p.Intervals
+	if p.MaxAttempts > 0 && len(intervals) > 0 {
+		intervals = make([]int, p.MaxAttempts)
+		for i := range intervals {
+			if i < len(p.Intervals) {
+				intervals[i] = p.Intervals[i]
+			} else {
+				intervals[i] = p.Intervals[len(p.Intervals)-1]
+			}
+		}
+	}
+
+	var delays []time.Duration
+	for _, interval := range intervals {
+		delays = append(delays, time.Duration(interval)*time.Second)
+	}
+
+	return delays
+}
+
+// retryTopics returns the delays of the Kafka retry topics for the policy, and the index of the
+// retry topic used by each of the given retry delays. Each interval has its own retry topic, and
+// retries after the last interval reuse its topic. Backoff retries with the same delay share a
+// retry topic, and when there are more than maxBackoffRetryTopics different delays, each retry
+// uses the topic with the longest delay that is not longer than its own. Messages are held until
+// the time in their x-retry-due-at header, so they are still retried after their own delay.
+func (p RetryPolicy) retryTopics(delays []time.Duration) ([]time.Duration, []int) {
+	retryTopic := make([]int, len(delays))
+
+	if p.Backoff == nil {
+		topicDelays := delays
+		if len(p.Intervals) < len(delays) {
+			topicDelays = delays[:len(p.Intervals)]
+		}
+		for i := range retryTopic {
+			retryTopic[i] = i
+			if i >= len(topicDelays) {
+				retryTopic[i] = len(topicDelays) - 1
+			}
+		}
+		return topicDelays, retryTopic
+	}
+
+	// backoff delays never decrease, so each different delay follows the one before it
+	var distinct []time.Duration
+	for _, d := range delays {
+		if len(distinct) == 0 || d != distinct[len(distinct)-1] {
+			distinct = append(distinct, d)
+		}
+	}
+
+	topicDelays := distinct
+	if len(distinct) > maxBackoffRetryTopics {
+		topicDelays = make([]time.Duration, maxBackoffRetryTopics)
+		for i := range topicDelays {
+			topicDelays[i] = distinct[i*len(distinct)/maxBackoffRetryTopics]
+		}
+	}
+
+	for i, d := range delays {
+		for retryTopic[i]+1 < len(topicDelays) && topicDelays[retryTopic[i]+1] <= d {
+			retryTopic[i]++
+		}
+	}
+
+	return topicDelays, retryTopic
+}
+
+// jitter returns the jitter fraction of the policy, which is zero unless Backoff is set.
+func (p RetryPolicy) jitter() float64 {
+	if p.Backoff == nil {
+		return 0
+	}
+	return p.Backoff.Jitter
+}
+
+func (b Backoff) delays(attempts int) []time.Duration {
+	multiplier := b.Multiplier
+	if multiplier == 0 {
+		multiplier = defaultBackoffMultiplier
+	}
+
+	delays := make([]time.Duration, attempts)
+	d := float64(b.Initial)
+	for i := range delays {
+		if b.Max > 0 && d > float64(b.Max) {
+			d = float64(b.Max)
+		}
+		// without a maximum the delay is capped at the longest duration, rather than overflowing
+		if d >= math.MaxInt64 {
+			delays[i] = math.MaxInt64
+			continue
+		}
+		delays[i] = time.Duration(d)
+		d *= multiplier
+	}
+
+	return delays
+}
+
+// RetryPolicy returns the retry policy of the source topic that the given topic belongs to. The
+// zero value is returned if the topic is not configured.
+func (cfg *Config) RetryPolicy(topicName string) RetryPolicy {
+	return cfg.RetryPolicies[cfg.FindTopicKey(topicName)]
+}
+
+// NextDelay returns the delay before messages in the topic are consumed, with jitter applied.
+func (t *KafkaTopic) NextDelay() time.Duration {
+	return applyJitter(t.Delay, t.Jitter)
+}
+
+// NextInterval returns the interval before retries at this sequence are processed, with jitter
+// applied.
+func (r *DBTopicRetry) NextInterval() time.Duration {
+	return applyJitter(r.Interval, r.Jitter)
+}
+
+// applyJitter returns a random duration within the given fraction either side of d.
+func applyJitter(d time.Duration, fraction float64) time.Duration {
+	if fraction <= 0 || d <= 0 {
+		return d
+	}
+
+	jitterRand.Lock()
+	r := jitterRand.Float64()
+	jitterRand.Unlock()
+
+	jittered := float64(d) * (1 + fraction*(2*r-1))
+	if jittered >= math.MaxInt64 {
+		return math.MaxInt64
+	}
+	return time.Duration(jittered)
+}
@@ -0,0 +1,328 @@
+package config
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/go-test/deep"
+
+	"github.com/inviqa/kafka-consumer-go/data/retry/model"
+)
+
+func TestRetryPolicy_retryDelays(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy RetryPolicy
+		want   []time.Duration
+	}{
+		{name: "no intervals", policy: RetryPolicy{}, want: nil},
+		{name: "one retry per interval", policy: RetryPolicy{Intervals: []int{1, 5}}, want: []time.Duration{time.Second, time.Second * 5}},
+		{name: "last interval repeated", policy: RetryPolicy{Intervals: []int{1, 5}, MaxAttempts: 4}, want: []time.Duration{time.Second, time.Second * 5, time.Second * 5, time.Second * 5}},
+		{name: "intervals truncated", policy: RetryPolicy{Intervals: []int{1, 5, 10}, MaxAttempts: 2}, want: []time.Duration{time.Second, time.Second * 5}},
+		{
+			name:   "exponential backoff",
+			policy: RetryPolicy{MaxAttempts: 4, Backoff: &Backoff{Initial: time.Second, Multiplier: 3}},
+			want:   []time.Duration{time.Second, time.Second * 3, time.Second * 9, time.Second * 27},
+		},
+		{
+			name:   "exponential backoff with the default multiplier and a maximum delay",
+			policy: RetryPolicy{MaxAttempts: 5, Backoff: &Backoff{Initial: time.Millisecond * 500, Max: time.Second * 3}},
+			want:   []time.Duration{time.Millisecond * 500, time.Second, time.Second * 2, time.Second * 3, time.Second * 3},
+		},
+		{
+			name:   "exponential backoff without a maximum delay does not overflow",
+			policy: RetryPolicy{MaxAttempts: 3, Backoff: &Backoff{Initial: time.Second << 32, Multiplier: 1 << 30}},
+			want:   []time.Duration{time.Second << 32, math.MaxInt64, math.MaxInt64},
+		},
+		{
+			name:   "backoff ignores intervals",
+			policy: RetryPolicy{Intervals: []int{60}, MaxAttempts: 1, Backoff: &Backoff{Initial: time.Second}},
+			want:   []time.Duration{time.Second},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if diff := deep.Equal(tt.want, tt.policy.retryDelays()); diff != nil {
+				t.Error(diff)
+			}
+		})
+	}
+}
+
+func TestRetryPolicy_retryTopics(t *testing.T) {
+	tests := []struct {
+		name           string
+		policy         RetryPolicy
+		wantDelays     []time.Duration
+		wantRetryTopic []int
+	}{
+		{name: "no retries", policy: RetryPolicy{}, wantDelays: nil, wantRetryTopic: []int{}},
+		{
+			name:           "a topic for each interval",
+			policy:         RetryPolicy{Intervals: []int{1, 5, 5}},
+			wantDelays:     []time.Duration{time.Second, time.Second * 5, time.Second * 5},
+			wantRetryTopic: []int{0, 1, 2},
+		},
+		{
+			name:           "retries after the last interval reuse its topic",
+			policy:         RetryPolicy{Intervals: []int{1, 5}, MaxAttempts: 4},
+			wantDelays:     []time.Duration{time.Second, time.Second * 5},
+			wantRetryTopic: []int{0, 1, 1, 1},
+		},
+		{
+			name:           "backoff retries with the same delay share a topic",
+			policy:         RetryPolicy{MaxAttempts: 5, Backoff: &Backoff{Initial: time.Second, Max: time.Second * 4}},
+			wantDelays:     []time.Duration{time.Second, time.Second * 2, time.Second * 4},
+			wantRetryTopic: []int{0, 1, 2, 2, 2},
+		},
+		{
+			name:   "backoff retries are grouped into the most retry topics",
+			policy: RetryPolicy{MaxAttempts: 12, Backoff: &Backoff{Initial: time.Second}},
+			wantDelays: []time.Duration{
+				time.Second, time.Second * 2, time.Second * 4, time.Second * 8, time.Second * 16,
+				time.Second * 64, time.Second * 128, time.Second * 256, time.Second * 512, time.Second * 1024,
+			},
+			wantRetryTopic: []int{0, 1, 2, 3, 4, 4, 5, 6, 7, 8, 9, 9},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			delays, retryTopic := tt.policy.retryTopics(tt.policy.retryDelays())
+			if diff := deep.Equal(tt.wantDelays, delays); diff != nil {
+				t.Error(diff)
+			}
+			if diff := deep.Equal(tt.wantRetryTopic, retryTopic); diff != nil {
+				t.Error(diff)
+			}
+		})
+	}
+}
+
+func TestRetryPolicy_validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  RetryPolicy
+		wantErr bool
+	}{
+		{name: "intervals", policy: RetryPolicy{Intervals: []int{1}}},
+		{name: "valid backoff", policy: RetryPolicy{MaxAttempts: 15, Backoff: &Backoff{Initial: time.Second, Multiplier: 1.5, Max: time.Hour, Jitter: 0.2}}},
+		{name: "most attempts", policy: RetryPolicy{Intervals: []int{1}, MaxAttempts: 254}},
+		{name: "too many attempts", policy: RetryPolicy{Intervals: []int{1}, MaxAttempts: 255}, wantErr: true},
+		{name: "too many intervals", policy: RetryPolicy{Intervals: make([]int, 255)}, wantErr: true},
+		{name: "max attempts without intervals", policy: RetryPolicy{MaxAttempts: 3}, wantErr: true},
+		{name: "zero interval", policy: RetryPolicy{Intervals: []int{0, 5}}, wantErr: true},
+		{name: "negative interval", policy: RetryPolicy{Intervals: []int{-1}}, wantErr: true},
+		{name: "backoff without max attempts", policy: RetryPolicy{Backoff: &Backoff{Initial: time.Second}}, wantErr: true},
+		{name: "backoff without initial delay", policy: RetryPolicy{MaxAttempts: 1, Backoff: &Backoff{}}, wantErr: true},
+		{name: "backoff multiplier below 1", policy: RetryPolicy{MaxAttempts: 1, Backoff: &Backoff{Initial: time.Second, Multiplier: 0.5}}, wantErr: true},
+		{name: "negative maximum delay", policy: RetryPolicy{MaxAttempts: 1, Backoff: &Backoff{Initial: time.Second, Max: -1}}, wantErr: true},
+		{name: "jitter above 1", policy: RetryPolicy{MaxAttempts: 1, Backoff: &Backoff{Initial: time.Second, Jitter: 1.5}}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.policy.validate(); (err != nil) != tt.wantErr {
+				t.Errorf("validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestApplyJitter(t *testing.T) {
+	d := time.Second * 10
+
+	if got := applyJitter(d, 0); got != d {
+		t.Errorf("expected no jitter to be applied, but got %s", got)
+	}
+
+	for i := 0; i < 100; i++ {
+		if got := applyJitter(d, 0.2); got < time.Second*8 || got > time.Second*12 {
+			t.Fatalf("expected a delay between 8s and 12s, but got %s", got)
+		}
+	}
+
+	if got := applyJitter(math.MaxInt64, 1); got < 0 {
+		t.Errorf("expected the longest delay not to overflow when jitter is applied, but got %s", got)
+	}
+
+	topic := &KafkaTopic{Delay: d}
+	if got := topic.NextDelay(); got != d {
+		t.Errorf("expected the topic delay without jitter, but got %s", got)
+	}
+	retry := &DBTopicRetry{Interval: d, Jitter: 1}
+	if got := retry.NextInterval(); got < 0 || got > d*2 {
+		t.Errorf("expected an interval between 0s and 20s, but got %s", got)
+	}
+}
+
+func TestBuilder_Config_WithRetryPolicies(t *testing.T) {
+	t.Run("each source topic gets its own retry chain", func(t *testing.T) {
+		payments := RetryPolicy{Intervals: []int{1}, MaxAttempts: 3, DisableDeadLetter: true}
+		cfg, err := NewBuilder().
+			SetKafkaHost([]string{"broker1"}).
+			SetKafkaGroup("group").
+			SetSourceTopics([]string{"payment", "catalogue"}).
+			SetRetryIntervals([]int{3600}).
+			SetRetryPolicy("payment", payments).
+			Config()
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+
+		var paymentChain []string
+		for topic := cfg.TopicMap["payment"]; topic != nil; topic = topic.Next {
+			paymentChain = append(paymentChain, topic.Name)
+		}
+		expChain := []string{"payment", "retry1.group.payment", "deadLetter.group.payment"}
+		if diff := deep.Equal(expChain, paymentChain); diff != nil {
+			t.Error(diff)
+		}
+
+		expPaymentRetries := []*DBTopicRetry{
+			{Interval: time.Second, Sequence: 1, Key: "payment"},
+			{Interval: time.Second, Sequence: 2, Key: "payment"},
+			{Interval: time.Second, Sequence: 3, Key: "payment"},
+		}
+		if diff := deep.Equal(expPaymentRetries, cfg.DBRetries["payment"]); diff != nil {
+			t.Error(diff)
+		}
+
+		expCatalogueRetries := []*DBTopicRetry{
+			{Interval: time.Hour, Sequence: 1, Key: "catalogue"},
+		}
+		if diff := deep.Equal(expCatalogueRetries, cfg.DBRetries["catalogue"]); diff != nil {
+			t.Error(diff)
+		}
+
+		if diff := deep.Equal(payments, cfg.RetryPolicy("retry1.group.payment")); diff != nil {
+			t.Error(diff)
+		}
+		if cfg.RetryPolicy("catalogue").DisableDeadLetter {
+			t.Error("expected the catalogue topic to use the default retry policy")
+		}
+	})
+
+	t.Run("a backoff policy expands into retry topics and DB retries with jitter", func(t *testing.T) {
+		cfg, err := NewBuilder().
+			SetKafkaHost([]string{"broker1"}).
+			SetKafkaGroup("group").
+			SetSourceTopics([]string{"payment"}).
+			SetRetryPolicy("payment", RetryPolicy{
+				MaxAttempts: 3,
+				Backoff:     &Backoff{Initial: time.Second, Max: time.Second * 3, Jitter: 0.1},
+			}).
+			Config()
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+
+		expDelays := []time.Duration{time.Second, time.Second * 2, time.Second * 3}
+		var delays []time.Duration
+		for topic := cfg.TopicMap["payment"].Next; topic.Next != nil; topic = topic.Next {
+			delays = append(delays, topic.Delay)
+			if topic.Jitter != 0.1 {
+				t.Errorf("expected topic %s to have a jitter of 0.1, but got %v", topic.Name, topic.Jitter)
+			}
+		}
+		if diff := deep.Equal(expDelays, delays); diff != nil {
+			t.Error(diff)
+		}
+
+		expRetries := []*DBTopicRetry{
+			{Interval: time.Second, Sequence: 1, Key: "payment", Jitter: 0.1},
+			{Interval: time.Second * 2, Sequence: 2, Key: "payment", Jitter: 0.1},
+			{Interval: time.Second * 3, Sequence: 3, Key: "payment", Jitter: 0.1},
+		}
+		if diff := deep.Equal(expRetries, cfg.DBRetries["payment"]); diff != nil {
+			t.Error(diff)
+		}
+	})
+
+	t.Run("a backoff with many attempts shares a bounded set of retry topics", func(t *testing.T) {
+		cfg, err := NewBuilder().
+			SetKafkaHost([]string{"broker1"}).
+			SetKafkaGroup("group").
+			SetSourceTopics([]string{"payment"}).
+			SetRetryPolicy("payment", RetryPolicy{MaxAttempts: 100, Backoff: &Backoff{Initial: time.Millisecond}}).
+			Config()
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+
+		if got := len(cfg.ConsumableTopics); got != maxBackoffRetryTopics+1 {
+			t.Errorf("expected the main topic and %d retry topics, but got %d topics", maxBackoffRetryTopics, got)
+		}
+		if got := len(cfg.DBRetries["payment"]); got != 100 {
+			t.Errorf("expected a DB retry for each of the 100 attempts, but got %d", got)
+		}
+	})
+
+	t.Run("the most retries are still followed by the dead-letter stage", func(t *testing.T) {
+		cfg, err := NewBuilder().
+			SetKafkaHost([]string{"broker1"}).
+			SetKafkaGroup("group").
+			SetSourceTopics([]string{"payment"}).
+			SetRetryPolicy("payment", RetryPolicy{Intervals: []int{1}, MaxAttempts: maxRetryAttempts}).
+			Config()
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+
+		dlTopic, err := cfg.DeadLetterTopicNameInChain("payment")
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if got := cfg.TopicStage(dlTopic); got != "deadletter" {
+			t.Errorf("expected the dead-letter topic to be in the deadletter stage, but got %s", got)
+		}
+
+		retry := cfg.DBRetries.MakeRetryErrored(model.Retry{Topic: "payment", Attempts: maxRetryAttempts - 1})
+		if retry.Deadlettered {
+			t.Error("expected the retry not to be dead-lettered before its last attempt")
+		}
+		retry = cfg.DBRetries.MakeRetryErrored(retry)
+		if !retry.Deadlettered || retry.Attempts != maxRetryAttempts+1 {
+			t.Errorf("expected the retry to be dead-lettered after %d attempts, but got %+v", maxRetryAttempts+1, retry)
+		}
+	})
+
+	t.Run("it errors if a policy is invalid", func(t *testing.T) {
+		_, err := NewBuilder().
+			SetKafkaHost([]string{"broker1"}).
+			SetKafkaGroup("group").
+			SetSourceTopics([]string{"payment"}).
+			SetRetryPolicy("payment", RetryPolicy{Backoff: &Backoff{Initial: time.Second}}).
+			Config()
+		if err == nil {
+			t.Error("expected an error but got nil")
+		}
+	})
+
+	t.Run("it errors if a policy is set for a topic that is not a source topic", func(t *testing.T) {
+		_, err := NewBuilder().
+			SetKafkaHost([]string{"broker1"}).
+			SetKafkaGroup("group").
+			SetSourceTopics([]string{"payment"}).
+			SetRetryPolicy("missing", RetryPolicy{Intervals: []int{1}}).
+			Config()
+		if err == nil {
+			t.Error("expected an error but got nil")
+		}
+	})
+}
+
+func TestBackoff_delays_WithManyAttempts(t *testing.T) {
+	delays := Backoff{Initial: time.Second}.delays(254)
+
+	for i := 1; i < len(delays); i++ {
+		if delays[i] < delays[i-1] {
+			t.Fatalf("expected delays to never decrease, but delay %d is %s after %s", i+1, delays[i], delays[i-1])
+		}
+	}
+	if got := delays[len(delays)-1]; got != math.MaxInt64 {
+		t.Errorf("expected the last delay to be capped at the longest duration, but got %s", got)
+	}
+}
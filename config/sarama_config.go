@@ -1,12 +1,51 @@
 package config
 
 import (
+	"crypto/sha256"
+	"crypto/sha512"
 	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
 	"os"
 
 	"github.com/Shopify/sarama"
+	"github.com/xdg-go/scram"
 )
 
+var (
+	scramSHA256 scram.HashGeneratorFcn = sha256.New
+	scramSHA512 scram.HashGeneratorFcn = sha512.New
+)
+
+// SASLMechanism is the mechanism used to authenticate with Kafka brokers using SASL.
+type SASLMechanism string
+
+const (
+	SASLPlain       SASLMechanism = sarama.SASLTypePlaintext
+	SASLScramSHA256 SASLMechanism = sarama.SASLTypeSCRAMSHA256
+	SASLScramSHA512 SASLMechanism = sarama.SASLTypeSCRAMSHA512
+	SASLOAuthBearer SASLMechanism = sarama.SASLTypeOAuth
+)
+
+// SASL holds the settings used to authenticate with Kafka brokers. SASL is not used if the
+// Mechanism is empty.
+type SASL struct {
+	Mechanism SASLMechanism
+	User      string
+	Pass      string
+	// TokenProvider provides access tokens for the OAUTHBEARER mechanism
+	TokenProvider sarama.AccessTokenProvider
+}
+
+// TLSFiles holds the paths of PEM encoded files used to establish TLS connections. Any of them
+// may be empty, in which case the system CA pool is used and no client certificate is sent.
+type TLSFiles struct {
+	CACert     string
+	ClientCert string
+	ClientKey  string
+}
+
 func NewSaramaConfig(tlsEnable bool, tlsSkipVerify bool) *sarama.Config {
 	cfg := sarama.NewConfig()
 
@@ -27,3 +66,134 @@ func NewSaramaConfig(tlsEnable bool, tlsSkipVerify bool) *sarama.Config {
 
 	return cfg
 }
+
+// SaramaConfig returns the Sarama config used by the consumer group, the Kafka failure producer
+// and admin clients. It starts from the base config given to the builder, or NewSaramaConfig if
+// there isn't one, and then applies the mutator given to the builder. The settings that this
+// module relies on, and the configured TLS and SASL settings, are applied last, and an error is
+// returned if the resulting config is not valid.
+func (cfg *Config) SaramaConfig() (*sarama.Config, error) {
+	srmCfg := cfg.baseSaramaConfig()
+	if cfg.saramaConfigMutator != nil {
+		cfg.saramaConfigMutator(srmCfg)
+	}
+
+	// the consumer reads errors from the consumer group, and the failure producer is synchronous
+	srmCfg.Consumer.Return.Errors = true
+	srmCfg.Producer.Return.Successes = true
+
+	if cfg.TLSEnable {
+		srmCfg.Net.TLS.Enable = true
+		tlsCfg, err := newTLSConfig(cfg.KafkaTLS, cfg.TLSSkipVerifyPeer)
+		if err != nil {
+			return nil, fmt.Errorf("consumer/config: unable to configure Kafka TLS: %w", err)
+		}
+		srmCfg.Net.TLS.Config = tlsCfg
+	}
+
+	if err := applySASL(srmCfg, cfg.SASL); err != nil {
+		return nil, fmt.Errorf("consumer/config: unable to configure Kafka SASL: %w", err)
+	}
+
+	if err := srmCfg.Validate(); err != nil {
+		return nil, fmt.Errorf("consumer/config: invalid Sarama config: %w", err)
+	}
+
+	return srmCfg, nil
+}
+
+func (cfg *Config) baseSaramaConfig() *sarama.Config {
+	if cfg.saramaConfig == nil {
+		return NewSaramaConfig(false, false)
+	}
+
+	// copy the base config so that it is not modified by the mutator or the required settings
+	srmCfg := *cfg.saramaConfig
+	if srmCfg.ClientID == "" || srmCfg.ClientID == sarama.NewConfig().ClientID {
+		srmCfg.ClientID, _ = os.Hostname()
+	}
+
+	return &srmCfg
+}
+
+func newTLSConfig(files TLSFiles, skipVerify bool) (*tls.Config, error) {
+	// #nosec G402
+	tlsCfg := &tls.Config{InsecureSkipVerify: skipVerify}
+
+	if files.CACert != "" {
+		pem, err := os.ReadFile(files.CACert)
+		if err != nil {
+			return nil, fmt.Errorf("could not read CA certificate: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in CA certificate file %s", files.CACert)
+		}
+		tlsCfg.RootCAs = pool
+	}
+
+	if files.ClientCert != "" || files.ClientKey != "" {
+		cert, err := tls.LoadX509KeyPair(files.ClientCert, files.ClientKey)
+		if err != nil {
+			return nil, fmt.Errorf("could not load client certificate: %w", err)
+		}
+		tlsCfg.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsCfg, nil
+}
+
+func applySASL(srmCfg *sarama.Config, s SASL) error {
+	if s.Mechanism == "" {
+		return nil
+	}
+
+	srmCfg.Net.SASL.Enable = true
+	srmCfg.Net.SASL.Mechanism = sarama.SASLMechanism(s.Mechanism)
+	srmCfg.Net.SASL.User = s.User
+	srmCfg.Net.SASL.Password = s.Pass
+
+	switch s.Mechanism {
+	case SASLPlain:
+	case SASLScramSHA256:
+		srmCfg.Net.SASL.SCRAMClientGeneratorFunc = func() sarama.SCRAMClient {
+			return &scramClient{hashGen: scramSHA256}
+		}
+	case SASLScramSHA512:
+		srmCfg.Net.SASL.SCRAMClientGeneratorFunc = func() sarama.SCRAMClient {
+			return &scramClient{hashGen: scramSHA512}
+		}
+	case SASLOAuthBearer:
+		if s.TokenProvider == nil {
+			return errors.New("a token provider is required for the OAUTHBEARER mechanism")
+		}
+		srmCfg.Net.SASL.TokenProvider = s.TokenProvider
+	default:
+		return fmt.Errorf("unsupported SASL mechanism %s", s.Mechanism)
+	}
+
+	return nil
+}
+
+// scramClient implements sarama.SCRAMClient for the SCRAM-SHA-256 and SCRAM-SHA-512 mechanisms.
+type scramClient struct {
+	hashGen scram.HashGeneratorFcn
+	conv    *scram.ClientConversation
+}
+
+func (c *scramClient) Begin(user, pass, authzID string) error {
+	client, err := c.hashGen.NewClient(user, pass, authzID)
+	if err != nil {
+		return err
+	}
+	c.conv = client.NewConversation()
+	return nil
+}
+
+func (c *scramClient) Step(challenge string) (string, error) {
+	return c.conv.Step(challenge)
+}
+
+func (c *scramClient) Done() bool {
+	return c.conv.Done()
+}
@@ -1,8 +1,20 @@
 package config
 
 import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
 )
 
 func TestNewSaramaConfig(t *testing.T) {
@@ -16,3 +28,224 @@ func TestNewSaramaConfig(t *testing.T) {
 		t.Error("clientId not set on Sarama config")
 	}
 }
+
+func TestConfig_SaramaConfig(t *testing.T) {
+	t.Run("without TLS or SASL", func(t *testing.T) {
+		cfg := &Config{}
+		got, err := cfg.SaramaConfig()
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if got.Net.TLS.Enable || got.Net.SASL.Enable {
+			t.Error("expected TLS and SASL to be disabled")
+		}
+	})
+
+	t.Run("with TLS certificates", func(t *testing.T) {
+		certFile, keyFile := writeTestCertificate(t)
+		cfg := &Config{
+			TLSEnable: true,
+			KafkaTLS:  TLSFiles{CACert: certFile, ClientCert: certFile, ClientKey: keyFile},
+		}
+
+		got, err := cfg.SaramaConfig()
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if !got.Net.TLS.Enable {
+			t.Error("expected TLS to be enabled")
+		}
+		if got.Net.TLS.Config.RootCAs == nil {
+			t.Error("expected the CA certificate to be loaded")
+		}
+		if len(got.Net.TLS.Config.Certificates) != 1 {
+			t.Errorf("expected 1 client certificate, but got %d", len(got.Net.TLS.Config.Certificates))
+		}
+	})
+
+	t.Run("with a missing CA certificate", func(t *testing.T) {
+		cfg := &Config{
+			TLSEnable: true,
+			KafkaTLS:  TLSFiles{CACert: filepath.Join(t.TempDir(), "missing.pem")},
+		}
+		if _, err := cfg.SaramaConfig(); err == nil {
+			t.Error("expected an error but got nil")
+		}
+	})
+
+	t.Run("with SASL mechanisms", func(t *testing.T) {
+		tests := []struct {
+			mechanism SASLMechanism
+			scram     bool
+		}{
+			{mechanism: SASLPlain},
+			{mechanism: SASLScramSHA256, scram: true},
+			{mechanism: SASLScramSHA512, scram: true},
+		}
+
+		for _, tt := range tests {
+			cfg := &Config{SASL: SASL{Mechanism: tt.mechanism, User: "user", Pass: "pass"}}
+			got, err := cfg.SaramaConfig()
+			if err != nil {
+				t.Fatalf("unexpected error for %s: %s", tt.mechanism, err)
+			}
+			if !got.Net.SASL.Enable || got.Net.SASL.Mechanism != sarama.SASLMechanism(tt.mechanism) {
+				t.Errorf("expected SASL %s to be enabled, but got %v", tt.mechanism, got.Net.SASL)
+			}
+			if got.Net.SASL.User != "user" || got.Net.SASL.Password != "pass" {
+				t.Errorf("expected SASL credentials to be set for %s", tt.mechanism)
+			}
+			if tt.scram != (got.Net.SASL.SCRAMClientGeneratorFunc != nil) {
+				t.Errorf("unexpected SCRAM client generator for %s", tt.mechanism)
+			}
+		}
+	})
+
+	t.Run("with OAUTHBEARER", func(t *testing.T) {
+		tp := &testTokenProvider{}
+		got, err := (&Config{SASL: SASL{Mechanism: SASLOAuthBearer, TokenProvider: tp}}).SaramaConfig()
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if got.Net.SASL.TokenProvider != tp {
+			t.Error("expected the token provider to be set")
+		}
+
+		if _, err := (&Config{SASL: SASL{Mechanism: SASLOAuthBearer}}).SaramaConfig(); err == nil {
+			t.Error("expected an error without a token provider, but got nil")
+		}
+	})
+
+	t.Run("with an unsupported SASL mechanism", func(t *testing.T) {
+		if _, err := (&Config{SASL: SASL{Mechanism: "GSSAPI"}}).SaramaConfig(); err == nil {
+			t.Error("expected an error but got nil")
+		}
+	})
+}
+
+func TestScramClient(t *testing.T) {
+	c := &scramClient{hashGen: scramSHA256}
+	if err := c.Begin("user", "pass", ""); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	first, err := c.Step("")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !strings.HasPrefix(first, "n,,n=user,r=") {
+		t.Errorf("unexpected client-first message: %s", first)
+	}
+	if c.Done() {
+		t.Error("expected the conversation not to be done")
+	}
+}
+
+type testTokenProvider struct{}
+
+func (testTokenProvider) Token() (*sarama.AccessToken, error) {
+	return &sarama.AccessToken{Token: "token"}, nil
+}
+
+// writeTestCertificate writes a self-signed certificate and its key to a temporary directory.
+func writeTestCertificate(t *testing.T) (certFile, keyFile string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("unable to generate key: %s", err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("unable to create certificate: %s", err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("unable to marshal key: %s", err)
+	}
+
+	dir := t.TempDir()
+	certFile = filepath.Join(dir, "cert.pem")
+	keyFile = filepath.Join(dir, "key.pem")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	return certFile, keyFile
+}
+
+func TestConfig_SaramaConfig_Overrides(t *testing.T) {
+	newConfig := func(b *Builder) *Config {
+		t.Helper()
+		cfg, err := b.SetKafkaHost([]string{"broker1"}).SetKafkaGroup("group").SetSourceTopics([]string{"product"}).Config()
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		return cfg
+	}
+
+	t.Run("it uses the base config, with the required settings on top", func(t *testing.T) {
+		base := sarama.NewConfig()
+		base.Version = sarama.V2_8_0_0
+		base.Consumer.Offsets.Initial = sarama.OffsetNewest
+		base.Consumer.Group.Rebalance.Strategy = sarama.BalanceStrategySticky
+		base.Consumer.Return.Errors = false
+		base.Producer.Return.Successes = false
+
+		got, err := newConfig(NewBuilder().SetSaramaConfig(base)).SaramaConfig()
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+
+		if got.Version != sarama.V2_8_0_0 || got.Consumer.Offsets.Initial != sarama.OffsetNewest || got.Consumer.Group.Rebalance.Strategy != sarama.BalanceStrategySticky {
+			t.Error("expected the settings from the base config to be used")
+		}
+		if !got.Consumer.Return.Errors || !got.Producer.Return.Successes {
+			t.Error("expected the required settings to be applied")
+		}
+		if expClient, _ := os.Hostname(); got.ClientID != expClient {
+			t.Errorf("expected the default client ID to be replaced with the hostname, but got %s", got.ClientID)
+		}
+		if base.Consumer.Return.Errors || base.Producer.Return.Successes {
+			t.Error("expected the base config not to be modified")
+		}
+	})
+
+	t.Run("it applies the mutator after the defaults", func(t *testing.T) {
+		got, err := newConfig(NewBuilder().SetSaramaConfigMutator(func(c *sarama.Config) {
+			c.Version = sarama.V3_0_0_0
+			c.Consumer.IsolationLevel = sarama.ReadCommitted
+			c.Consumer.Fetch.Max = 1024
+		})).SaramaConfig()
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+
+		if got.Version != sarama.V3_0_0_0 || got.Consumer.IsolationLevel != sarama.ReadCommitted || got.Consumer.Fetch.Max != 1024 {
+			t.Error("expected the mutator to be applied")
+		}
+		if got.Consumer.Offsets.Initial != sarama.OffsetOldest {
+			t.Error("expected the defaults from NewSaramaConfig to be used")
+		}
+	})
+
+	t.Run("it errors if the resulting config is invalid", func(t *testing.T) {
+		_, err := newConfig(NewBuilder().SetSaramaConfigMutator(func(c *sarama.Config) {
+			c.Consumer.Fetch.Default = 0
+		})).SaramaConfig()
+		if err == nil {
+			t.Error("expected an error but got nil")
+		}
+	})
+}
@@ -1,32 +1,55 @@
 package consumer
 
 import (
-	"fmt"
+	"context"
+	"time"
 
 	"github.com/Shopify/sarama"
 
 	"github.com/inviqa/kafka-consumer-go/config"
 	"github.com/inviqa/kafka-consumer-go/data/failure/model"
 	"github.com/inviqa/kafka-consumer-go/log"
+	"github.com/inviqa/kafka-consumer-go/prometheus"
 )
 
 type consumer struct {
 	failureCh chan<- model.Failure
 	cfg       *config.Config
 	handlers  HandlerMap
-	logger    log.Logger
+	logger    log.StructuredLogger
+	opts      *options
+
+	// inFlight counts messages being processed by workers, which may outlive ConsumeClaim
+	inFlight inFlightCounter
 }
 
-func newConsumer(fch chan<- model.Failure, cfg *config.Config, hs HandlerMap, l log.Logger) sarama.ConsumerGroupHandler {
+func newConsumer(fch chan<- model.Failure, cfg *config.Config, hs HandlerMap, l log.StructuredLogger, opts *options) sarama.ConsumerGroupHandler {
+	if opts == nil {
+		opts = newOptions()
+	}
+
 	return &consumer{
 		failureCh: fch,
 		cfg:       cfg,
 		handlers:  hs,
 		logger:    l,
+		opts:      opts,
 	}
 }
 
 func (c *consumer) ConsumeClaim(session sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
+	if claim.InitialOffset() >= 0 {
+		prometheus.SetConsumerLag(claim.Topic(), claim.Partition(), claim.HighWaterMarkOffset()-claim.InitialOffset())
+	}
+
+	if bh, ok := c.opts.batchHandlers.handlerForTopic(c.cfg.FindTopicKey(claim.Topic())); ok {
+		return c.consumeClaimInBatches(session, claim, bh)
+	}
+
+	if c.cfg.WorkerCount > 1 {
+		return c.consumeClaimConcurrently(session, claim)
+	}
+
 	for {
 		select {
 		case message := <-claim.Messages():
@@ -34,45 +57,273 @@ func (c *consumer) ConsumeClaim(session sarama.ConsumerGroupSession, claim saram
 				return nil
 			}
 
-			c.logger.Debugf("processing message from Kafka")
+			if !c.waitUntilDue(session.Context(), message) {
+				return nil
+			}
+
+			log.Debug(c.logger, "processing message from Kafka", c.messageFields(message)...)
 
-			k := c.cfg.FindTopicKey(message.Topic)
-			h, ok := c.handlers.handlerForTopic(k)
-			if !ok {
-				return fmt.Errorf("consumer: handler not found for topic: %s", k)
+			c.handleMessage(session.Context(), c.handlerForMessage(message), message)
+			c.markMessageProcessed(session, claim, message)
+		case <-session.Context().Done():
+			log.Debug(c.logger, "consumer: session context finished, returning", claimFields(claim)...)
+			return nil
+		}
+	}
+}
+
+// consumeClaimConcurrently processes messages from the claim using a pool of workers, where
+// messages with the same key are processed in order by the same worker. Offsets are only
+// marked once all messages before them in the partition have finished processing. Messages
+// that are still in-flight when this returns are waited for in Cleanup.
+func (c *consumer) consumeClaimConcurrently(session sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
+	pool := newKeyedWorkerPool(c.cfg.WorkerCount)
+	defer pool.close()
+
+	tracker := newOffsetTracker(func(msg *sarama.ConsumerMessage) {
+		c.markMessageProcessed(session, claim, msg)
+	})
+
+	for {
+		select {
+		case message := <-claim.Messages():
+			if message == nil {
+				return nil
 			}
 
-			if err := h(session.Context(), message); err != nil {
-				c.sendToFailureChannel(message, err)
+			if !c.waitUntilDue(session.Context(), message) {
+				return nil
 			}
 
-			c.markMessageProcessed(session, message)
+			log.Debug(c.logger, "processing message from Kafka", c.messageFields(message)...)
+
+			h := c.handlerForMessage(message)
+			tm := tracker.add(message)
+			c.inFlight.add()
+			pool.submit(message.Key, func() {
+				defer c.inFlight.done()
+				c.handleMessage(session.Context(), h, message)
+				tracker.complete(tm)
+			})
 		case <-session.Context().Done():
-			c.logger.Debug("consumer: session context finished, returning")
+			log.Debug(c.logger, "consumer: session context finished, waiting for in-flight messages before returning", claimFields(claim)...)
 			return nil
 		}
 	}
 }
 
-func (c *consumer) markMessageProcessed(session sarama.ConsumerGroupSession, msg *sarama.ConsumerMessage) {
-	c.logger.Debugf("marking messages as processed")
+// consumeClaimInBatches collects messages from the claim and passes them to the batch handler
+// once the configured batch size is reached, or the flush interval elapses. Messages in a batch
+// are only marked as processed once the whole batch has been handled.
+func (c *consumer) consumeClaimInBatches(session sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim, h BatchHandler) error {
+	ticker := time.NewTicker(c.opts.batchFlushInterval)
+	defer ticker.Stop()
+
+	var batch []*sarama.ConsumerMessage
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		c.handleBatch(session.Context(), h, batch)
+		for _, msg := range batch {
+			c.markMessageProcessed(session, claim, msg)
+		}
+		batch = nil
+	}
+
+	for {
+		select {
+		case message := <-claim.Messages():
+			if message == nil {
+				flush()
+				return nil
+			}
+
+			if !c.isDue(message) {
+				// handle what has been collected so far, rather than holding it while waiting
+				flush()
+				if !c.waitUntilDue(session.Context(), message) {
+					return nil
+				}
+			}
+
+			log.Debug(c.logger, "adding message from Kafka to batch", c.messageFields(message)...)
+
+			batch = append(batch, message)
+			if len(batch) >= c.opts.batchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		case <-session.Context().Done():
+			// messages in an unprocessed batch are not marked, so they will be consumed again
+			log.Debug(c.logger, "consumer: session context finished, returning", claimFields(claim)...)
+			return nil
+		}
+	}
+}
+
+func (c *consumer) handleBatch(ctx context.Context, h BatchHandler, batch []*sarama.ConsumerMessage) {
+	topic, stage := metricLabels(c.cfg, batch[0].Topic)
+	prometheus.IncMessagesConsumed(topic, stage, len(batch))
+
+	ctx, span := c.opts.startBatchSpan(ctx, batch)
+	start := time.Now()
+	err := callBatchHandler(ctx, c.logger, h, batch)
+	prometheus.ObserveHandlerDuration(topic, stage, time.Since(start))
+	endSpan(span, err)
+	incHandlerPanics(topic, stage, err)
+
+	failures := batchFailures(batch, err)
+	prometheus.IncHandlerFailures(topic, stage, len(failures))
+	prometheus.IncHandlerSuccesses(topic, stage, len(batch)-len(failures))
+
+	for _, msg := range batch {
+		if err, failed := failures[msg]; failed {
+			c.sendToFailureChannel(msg, err)
+		}
+	}
+}
+
+func (c *consumer) handlerForMessage(message *sarama.ConsumerMessage) Handler {
+	return resolveHandler(c.handlers, c.cfg.FindTopicKey(message.Topic), c.opts, c.logger)
+}
+
+func (c *consumer) handleMessage(ctx context.Context, h Handler, message *sarama.ConsumerMessage) {
+	topic, stage := metricLabels(c.cfg, message.Topic)
+	prometheus.IncMessagesConsumed(topic, stage, 1)
+
+	ctx, span := c.opts.startHandlerSpan(ctx, message)
+	start := time.Now()
+	err := callHandler(ctx, c.logger, h, message)
+	prometheus.ObserveHandlerDuration(topic, stage, time.Since(start))
+	endSpan(span, err)
+	incHandlerPanics(topic, stage, err)
+
+	if err != nil {
+		prometheus.IncHandlerFailures(topic, stage, 1)
+		c.sendToFailureChannel(message, err)
+		return
+	}
+	prometheus.IncHandlerSuccesses(topic, stage, 1)
+}
+
+// markMessageProcessed marks the message as processed in the session, and records the lag of
+// the partition that the message came from, based on the claim's high-water mark.
+func (c *consumer) markMessageProcessed(session sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim, msg *sarama.ConsumerMessage) {
+	log.Debug(c.logger, "marking message as processed", c.messageFields(msg)...)
 	session.MarkMessage(msg, "")
+	prometheus.SetConsumerLag(msg.Topic, msg.Partition, claim.HighWaterMarkOffset()-(msg.Offset+1))
+}
+
+// waitUntilDue blocks until message is due to be retried, so that its partition is paused
+// instead of the message being handled early. It returns false if the session ends first, in
+// which case the message is not handled and will be consumed again.
+func (c *consumer) waitUntilDue(ctx context.Context, message *sarama.ConsumerMessage) bool {
+	due, ok := c.dueAt(message)
+	if !ok {
+		return true
+	}
+
+	wait := time.Until(due)
+	if wait <= 0 {
+		return true
+	}
+
+	log.Debug(c.logger, "pausing partition until message is due for retry", append(c.messageFields(message), log.F("due_at", due))...)
+	t := time.NewTimer(wait)
+	defer t.Stop()
+
+	select {
+	case <-t.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+func (c *consumer) isDue(message *sarama.ConsumerMessage) bool {
+	due, ok := c.dueAt(message)
+	return !ok || !time.Now().Before(due)
+}
+
+// dueAt returns the earliest time that message should be handled. This is the time in its
+// HeaderDueAt header or, for messages published without one, the delay of its retry topic
+// after the message timestamp. The second return value is false if the message has no due time.
+func (c *consumer) dueAt(message *sarama.ConsumerMessage) (time.Time, bool) {
+	for _, h := range message.Headers {
+		if h != nil && string(h.Key) == model.HeaderDueAt {
+			if due, ok := model.DueAtFromHeader(string(h.Value)); ok {
+				return due, true
+			}
+		}
+	}
+
+	topic, ok := c.cfg.TopicMap[config.TopicKey(message.Topic)]
+	if !ok || topic.Delay == 0 || message.Timestamp.IsZero() {
+		return time.Time{}, false
+	}
+	return message.Timestamp.Add(topic.Delay), true
+}
+
+// failedAttempts returns the number of processing attempts of message that have failed, including
+// the one that has just failed, based on its HeaderAttempts header.
+func failedAttempts(message *sarama.ConsumerMessage) int {
+	for _, h := range message.Headers {
+		if h != nil && string(h.Key) == model.HeaderAttempts {
+			return model.AttemptsFromHeader(string(h.Value)) + 1
+		}
+	}
+	return 1
 }
 
 func (c *consumer) sendToFailureChannel(message *sarama.ConsumerMessage, err error) {
-	nextTopic, nextErr := c.cfg.NextTopicNameInChain(message.Topic)
+	nextTopic, nextErr := c.cfg.RetryTopicNameInChain(message.Topic, failedAttempts(message))
+	if model.IsPermanent(err) {
+		// permanent failures skip any remaining retries and go straight to the dead-letter topic
+		nextTopic, nextErr = c.cfg.DeadLetterTopicNameInChain(message.Topic)
+	} else if delay, ok := model.RetryDelay(err); ok && nextErr == nil {
+		// the handler asked for a delay, so skip ahead to the retry topic that best matches it
+		nextTopic, nextErr = c.cfg.ClosestRetryTopicNameInChain(nextTopic, delay)
+	}
 	if nextErr != nil {
-		c.logger.Errorf("no next topic to send failure to (deadletter topic being consumed?)")
+		log.Error(c.logger, "no next topic to send failure to (deadletter topic being consumed?)", c.messageFields(message)...)
+		return
+	}
+
+	if c.cfg.TopicStage(nextTopic) == "deadletter" && c.cfg.RetryPolicy(message.Topic).DisableDeadLetter {
+		topic, stage := metricLabels(c.cfg, message.Topic)
+		log.Info(c.logger, "discarding failed message instead of dead-lettering it", append(c.messageFields(message), log.Err(err))...)
+		prometheus.IncDiscarded(topic, stage)
 		return
 	}
 
 	c.failureCh <- model.FailureFromSaramaMessage(err, nextTopic, message)
 }
 
-func (c *consumer) Setup(sarama.ConsumerGroupSession) error {
+func (c *consumer) Setup(session sarama.ConsumerGroupSession) error {
+	c.opts.status.partitionsAssigned(session.Claims())
+	if h := c.opts.rebalanceHooks.OnPartitionsAssigned; h != nil {
+		h(session.Claims())
+	}
 	return nil
 }
 
-func (c *consumer) Cleanup(sarama.ConsumerGroupSession) error {
+// Cleanup waits, for up to the revoke timeout, for in-flight messages to finish processing
+// before the partitions of the session are revoked.
+func (c *consumer) Cleanup(session sarama.ConsumerGroupSession) error {
+	if !c.inFlight.wait(c.opts.revokeTimeout) {
+		log.Error(c.logger, "consumer: timed out waiting for in-flight messages before partitions were revoked", log.F("timeout", c.opts.revokeTimeout))
+	}
+	if h := c.opts.rebalanceHooks.OnPartitionsRevoked; h != nil {
+		h(session.Claims())
+	}
+
+	c.opts.status.partitionsRevoked(session.Claims())
+	for topic, partitions := range session.Claims() {
+		for _, p := range partitions {
+			prometheus.DeleteConsumerLag(topic, p)
+		}
+	}
 	return nil
 }
@@ -2,8 +2,10 @@ package consumer
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"sync"
+	"time"
 
 	"github.com/Shopify/sarama"
 
@@ -14,44 +16,201 @@ import (
 	"github.com/inviqa/kafka-consumer-go/log"
 )
 
-func Start(cfg *config.Config, ctx context.Context, hs HandlerMap, logger log.Logger) error {
-	if logger == nil {
-		logger = log.NullLogger{}
+var (
+	// ErrAlreadyRunning is returned from Consumer.Run when the consumer is already running.
+	ErrAlreadyRunning = errors.New("consumer: already running")
+	// ErrCloseTimeout is returned from Consumer.Close when the consumer did not stop in time.
+	ErrCloseTimeout = errors.New("consumer: timed out waiting for the consumer to stop")
+)
+
+// collectionFactory creates the collection of consumers that a Consumer runs, it is replaced in tests.
+type collectionFactory func(cfg *config.Config, hs HandlerMap, opts *options) (collection, error)
+
+// Consumer consumes messages from the configured Kafka topics, passing them to the registered
+// handlers and sending failed messages for retry. Create one with New, and then call Run.
+type Consumer struct {
+	cfg           *config.Config
+	handlers      HandlerMap
+	opts          *options
+	newCollection collectionFactory
+
+	mu     sync.Mutex
+	cancel context.CancelFunc
+	done   chan struct{}
+	err    error
+	db     pinger
+}
+
+// New creates a Consumer for the given configuration and handlers. An error is returned if any
+// of the configured topics do not have a handler, see WithUnhandledPolicy.
+func New(cfg *config.Config, hs HandlerMap, opts ...Option) (*Consumer, error) {
+	o := newOptions(opts...)
+	hs = hs.withMiddleware(o.middleware)
+	o.batchHandlers = o.batchHandlers.withMiddleware(o.batchMiddleware)
+	if o.defaultHandler != nil {
+		o.defaultHandler = applyMiddleware(o.defaultHandler, o.middleware)
 	}
 
-	wg := &sync.WaitGroup{}
-	fch := make(chan model.Failure)
-	srmCfg := config.NewSaramaConfig(cfg.TLSEnable, cfg.TLSSkipVerifyPeer)
+	if err := validateHandlers(cfg, hs, o); err != nil {
+		return nil, err
+	}
 
-	var cons collection
-	var err error
+	return &Consumer{
+		cfg:           cfg,
+		handlers:      hs,
+		opts:          o,
+		newCollection: newCollection,
+	}, nil
+}
 
-	if cfg.UseDBForRetryQueue {
-		cons, err = setupKafkaConsumerDbCollection(cfg, logger, fch, hs, srmCfg)
+// Start creates a consumer and runs it until the context is cancelled. It is equivalent to
+// calling New followed by Run. The logger is used unless another is set by one of the options.
+func Start(cfg *config.Config, ctx context.Context, hs HandlerMap, logger log.Logger, opts ...Option) error {
+	c, err := New(cfg, hs, withDefaultLogger(logger, opts)...)
+	if err != nil {
+		return err
+	}
+
+	return c.Run(ctx)
+}
+
+// withDefaultLogger returns opts with the logger set before them, so that any logger set by the
+// options replaces it.
+func withDefaultLogger(logger log.Logger, opts []Option) []Option {
+	return append([]Option{WithLogger(logger)}, opts...)
+}
+
+// Run starts consuming, and blocks until the context is cancelled or Close is called. An error
+// is returned if the consumer could not be started, in which case it is also available from Err.
+func (c *Consumer) Run(ctx context.Context) error {
+	c.mu.Lock()
+	if c.done != nil {
+		c.mu.Unlock()
+		return ErrAlreadyRunning
+	}
+	ctx, c.cancel = context.WithCancel(ctx)
+	c.done = make(chan struct{})
+	c.err = nil
+	c.mu.Unlock()
+
+	err := c.run(ctx)
+
+	c.mu.Lock()
+	c.cancel()
+	c.err = err
+	close(c.done)
+	c.done = nil
+	c.mu.Unlock()
+
+	return err
+}
+
+func (c *Consumer) run(ctx context.Context) error {
+	if c.cfg.HealthCheckAddr != "" {
+		stop, err := c.serveHealthChecks(c.cfg.HealthCheckAddr)
 		if err != nil {
+			c.opts.status.recordError(err)
 			return err
 		}
-	} else {
-		kafkaProducer, err := newKafkaFailureProducerWithDefaults(cfg, fch, logger)
+		defer stop()
+	}
+
+	if c.cfg.UseDBForRetryQueue {
+		db, err := c.cfg.DB()
 		if err != nil {
-			return fmt.Errorf("could not start Kafka failure producer: %w", err)
+			err = fmt.Errorf("could not connect to DB: %w", err)
+			c.opts.status.recordError(err)
+			return err
 		}
-		cons = newKafkaConsumerCollection(cfg, kafkaProducer, fch, hs, srmCfg, logger, defaultKafkaConnector)
+		c.mu.Lock()
+		c.db = db
+		c.mu.Unlock()
+	}
+
+	cons, err := c.newCollection(c.cfg, c.handlers, c.opts)
+	if err != nil {
+		c.opts.status.recordError(err)
+		return err
 	}
 
+	wg := &sync.WaitGroup{}
 	if err := cons.start(ctx, wg); err != nil {
-		return fmt.Errorf("unable to start consumers: %w", err)
+		err = fmt.Errorf("unable to start consumers: %w", err)
+		c.opts.status.recordError(err)
+		return err
 	}
 	defer cons.close()
 
-	logger.Info("kafka consumer started")
+	c.opts.status.setRunning(true)
+	defer c.opts.status.setRunning(false)
+
+	log.Info(c.opts.logger, "kafka consumer started")
 
 	wg.Wait()
 
 	return nil
 }
 
-func setupKafkaConsumerDbCollection(cfg *config.Config, logger log.Logger, fch chan model.Failure, hs HandlerMap, srmCfg *sarama.Config) (collection, error) {
+// Close stops the consumer, waiting up to the given timeout for in-flight messages and retries
+// to finish processing. ErrCloseTimeout is returned if the consumer has not stopped in time.
+// Calling Close on a consumer that is not running does nothing.
+func (c *Consumer) Close(timeout time.Duration) error {
+	c.mu.Lock()
+	done := c.done
+	if done == nil {
+		c.mu.Unlock()
+		return nil
+	}
+	c.cancel()
+	c.mu.Unlock()
+
+	t := time.NewTimer(timeout)
+	defer t.Stop()
+
+	select {
+	case <-done:
+		return nil
+	case <-t.C:
+		return ErrCloseTimeout
+	}
+}
+
+// Err returns the error that caused the last call to Run to return, or nil if it is still
+// running or stopped without error.
+func (c *Consumer) Err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.err
+}
+
+// Status returns a snapshot of the current state of the consumer.
+func (c *Consumer) Status() Status {
+	return c.opts.status.snapshot()
+}
+
+func newCollection(cfg *config.Config, hs HandlerMap, opts *options) (collection, error) {
+	srmCfg, err := cfg.SaramaConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	fch := make(chan model.Failure)
+
+	if cfg.UseDBForRetryQueue {
+		return setupKafkaConsumerDbCollection(cfg, opts.logger, fch, hs, srmCfg, opts)
+	}
+
+	kafkaProducer, err := newKafkaFailureProducerWithDefaults(cfg, fch, opts.logger)
+	if err != nil {
+		return nil, fmt.Errorf("could not start Kafka failure producer: %w", err)
+	}
+	kafkaProducer.setStatusTracker(opts.status)
+
+	return newKafkaConsumerCollection(cfg, kafkaProducer, fch, hs, srmCfg, opts.logger, defaultKafkaConnector, opts), nil
+}
+
+func setupKafkaConsumerDbCollection(cfg *config.Config, logger log.StructuredLogger, fch chan model.Failure, hs HandlerMap, srmCfg *sarama.Config, opts *options) (collection, error) {
 	db, err := cfg.DB()
 	if err != nil {
 		return nil, fmt.Errorf("could not connect to DB: %w", err)
@@ -62,8 +221,9 @@ func setupKafkaConsumerDbCollection(cfg *config.Config, logger log.Logger, fch c
 	}
 
 	repo := retry.NewManagerWithDefaults(cfg.DBRetries, db)
-	dbProducer := newDatabaseProducer(repo, fch, logger)
-	cons := newKafkaConsumerDbCollection(cfg, dbProducer, repo, fch, hs, srmCfg, logger, defaultKafkaConnector)
+	dbProducer := newDatabaseProducer(cfg, repo, fch, logger)
+	dbProducer.setStatusTracker(opts.status)
+	cons := newKafkaConsumerDbCollection(cfg, dbProducer, repo, fch, hs, srmCfg, logger, defaultKafkaConnector, opts)
 	cons.setMaintenanceInterval(cfg.MaintenanceInterval)
 
 	return cons, nil
@@ -0,0 +1,220 @@
+package consumer
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/go-test/deep"
+
+	"github.com/inviqa/kafka-consumer-go/config"
+	"github.com/inviqa/kafka-consumer-go/log"
+)
+
+type fakeCollection struct {
+	startErr error
+	stopWait time.Duration
+	closed   bool
+}
+
+func (f *fakeCollection) start(ctx context.Context, wg *sync.WaitGroup) error {
+	if f.startErr != nil {
+		return f.startErr
+	}
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		<-ctx.Done()
+		time.Sleep(f.stopWait)
+	}()
+
+	return nil
+}
+
+func (f *fakeCollection) close() {
+	f.closed = true
+}
+
+func newTestRunner(t *testing.T, col *fakeCollection, colErr error) *Consumer {
+	t.Helper()
+
+	hs := HandlerMap{"product": func(ctx context.Context, msg *sarama.ConsumerMessage) error {
+		return nil
+	}}
+	c, err := New(newTestConfig(), hs)
+	if err != nil {
+		t.Fatalf("unexpected error creating consumer: %s", err)
+	}
+	c.newCollection = func(cfg *config.Config, hs HandlerMap, opts *options) (collection, error) {
+		if colErr != nil {
+			return nil, colErr
+		}
+		return col, nil
+	}
+
+	return c
+}
+
+func TestNew(t *testing.T) {
+	t.Run("error is returned when a topic has no handler", func(t *testing.T) {
+		if _, err := New(newTestConfig(), HandlerMap{}); err == nil {
+			t.Error("expected an error but got nil")
+		}
+	})
+
+	t.Run("batch middleware is applied to batch handlers", func(t *testing.T) {
+		var calls []string
+		bhs := BatchHandlerMap{"product": func(ctx context.Context, msgs []*sarama.ConsumerMessage) error {
+			calls = append(calls, "handler")
+			return nil
+		}}
+		mw := func(next BatchHandler) BatchHandler {
+			return func(ctx context.Context, msgs []*sarama.ConsumerMessage) error {
+				calls = append(calls, "middleware")
+				return next(ctx, msgs)
+			}
+		}
+
+		c, err := New(newTestConfig(), HandlerMap{}, WithBatchHandlers(bhs, 0, 0), WithBatchMiddleware(mw))
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+
+		if err := c.opts.batchHandlers["product"](context.Background(), nil); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if diff := deep.Equal([]string{"middleware", "handler"}, calls); diff != nil {
+			t.Error(diff)
+		}
+	})
+}
+
+func TestWithDefaultLogger(t *testing.T) {
+	t.Run("the default logger is used when no logger option is given", func(t *testing.T) {
+		o := newOptions(withDefaultLogger(log.StdOutLogger{}, nil)...)
+		if _, ok := o.logger.(log.NullLogger); ok {
+			t.Error("expected the default logger to be used")
+		}
+	})
+
+	t.Run("a logger option replaces the default logger", func(t *testing.T) {
+		l := log.NewJSONLogger(io.Discard, log.LevelInfo)
+		o := newOptions(withDefaultLogger(log.StdOutLogger{}, []Option{WithStructuredLogger(l)})...)
+		if o.logger != l {
+			t.Errorf("expected the logger from the options to be used, but got %T", o.logger)
+		}
+	})
+}
+
+func TestConsumer_Run(t *testing.T) {
+	t.Run("it runs until closed", func(t *testing.T) {
+		col := &fakeCollection{}
+		c := newTestRunner(t, col, nil)
+
+		errCh := make(chan error)
+		go func() {
+			errCh <- c.Run(context.Background())
+		}()
+
+		waitForRunning(t, c)
+
+		if err := c.Close(time.Second); err != nil {
+			t.Errorf("unexpected error closing consumer: %s", err)
+		}
+		if err := <-errCh; err != nil {
+			t.Errorf("unexpected error from Run: %s", err)
+		}
+		if c.Err() != nil {
+			t.Errorf("expected no error, but got %s", c.Err())
+		}
+		if !col.closed {
+			t.Error("expected the collection to be closed")
+		}
+		if c.Status().Running {
+			t.Error("expected the consumer to not be running")
+		}
+	})
+
+	t.Run("it runs until the context is cancelled", func(t *testing.T) {
+		c := newTestRunner(t, &fakeCollection{}, nil)
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		if err := c.Run(ctx); err != nil {
+			t.Errorf("unexpected error from Run: %s", err)
+		}
+	})
+
+	t.Run("start errors are returned", func(t *testing.T) {
+		c := newTestRunner(t, &fakeCollection{startErr: errors.New("oops")}, nil)
+
+		if err := c.Run(context.Background()); err == nil {
+			t.Fatal("expected an error but got nil")
+		}
+		if c.Err() == nil {
+			t.Error("expected Err() to return the start error")
+		}
+		if c.Status().LastError == nil {
+			t.Error("expected the start error to be recorded in the status")
+		}
+	})
+
+	t.Run("collection errors are returned", func(t *testing.T) {
+		exp := errors.New("oops")
+		c := newTestRunner(t, nil, exp)
+
+		if err := c.Run(context.Background()); err != exp {
+			t.Errorf("expected error %v, but got %v", exp, err)
+		}
+	})
+
+	t.Run("it cannot be run twice at once", func(t *testing.T) {
+		c := newTestRunner(t, &fakeCollection{}, nil)
+		go c.Run(context.Background())
+		waitForRunning(t, c)
+		defer c.Close(time.Second)
+
+		if err := c.Run(context.Background()); err != ErrAlreadyRunning {
+			t.Errorf("expected ErrAlreadyRunning, but got %v", err)
+		}
+	})
+}
+
+func TestConsumer_Close(t *testing.T) {
+	t.Run("closing a consumer that is not running", func(t *testing.T) {
+		c := newTestRunner(t, &fakeCollection{}, nil)
+		if err := c.Close(time.Second); err != nil {
+			t.Errorf("unexpected error: %s", err)
+		}
+	})
+
+	t.Run("timeout is returned when the consumer does not stop in time", func(t *testing.T) {
+		c := newTestRunner(t, &fakeCollection{stopWait: time.Millisecond * 200}, nil)
+		go c.Run(context.Background())
+		waitForRunning(t, c)
+
+		if err := c.Close(time.Millisecond); err != ErrCloseTimeout {
+			t.Errorf("expected ErrCloseTimeout, but got %v", err)
+		}
+		if err := c.Close(time.Second); err != nil {
+			t.Errorf("unexpected error waiting for the consumer to stop: %s", err)
+		}
+	})
+}
+
+func waitForRunning(t *testing.T, c *Consumer) {
+	t.Helper()
+
+	deadline := time.Now().Add(time.Second)
+	for !c.Status().Running {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for the consumer to start")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
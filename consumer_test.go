@@ -3,6 +3,8 @@ package consumer
 import (
 	"context"
 	"errors"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -35,9 +37,10 @@ func TestNewConsumer(t *testing.T) {
 		cfg:       cfg,
 		handlers:  hs,
 		logger:    l,
+		opts:      newOptions(),
 	}
 
-	if diff := deep.Equal(exp, newConsumer(fch, cfg, hs, l)); diff != nil {
+	if diff := deep.Equal(exp, newConsumer(fch, cfg, hs, l, nil)); diff != nil {
 		t.Error(diff)
 	}
 }
@@ -51,7 +54,7 @@ func TestConsumer_ConsumeClaim(t *testing.T) {
 	}
 	l := log.NullLogger{}
 
-	con := newConsumer(fch, cfg, hs, l)
+	con := newConsumer(fch, cfg, hs, l, nil)
 
 	gs := saramatest.NewMockConsumerGroupSession()
 	gc := saramatest.NewMockConsumerGroupClaim()
@@ -100,7 +103,7 @@ func TestConsumer_ConsumeClaim_WithFailure(t *testing.T) {
 	gc.PublishMessage(msg1)
 	gc.CloseChannel()
 
-	con := newConsumer(fch, cfg, hs, log.NullLogger{})
+	con := newConsumer(fch, cfg, hs, log.NullLogger{}, nil)
 	if err := con.ConsumeClaim(gs, gc); err != nil {
 		t.Fatalf("unexpected error occurred: %s", err)
 	}
@@ -144,6 +147,552 @@ func TestConsumer_ConsumeClaim_WithFailure(t *testing.T) {
 	}
 }
 
+func TestConsumer_ConsumeClaim_WithWorkers(t *testing.T) {
+	cfg := newTestConfig()
+	cfg.WorkerCount = 4
+
+	var mu sync.Mutex
+	var handled []int64
+	hs := HandlerMap{
+		"product": func(ctx context.Context, msg *sarama.ConsumerMessage) error {
+			// messages for the slow key take longer, so messages after them finish first
+			if string(msg.Key) == "slow" {
+				time.Sleep(time.Millisecond * 20)
+			}
+			mu.Lock()
+			handled = append(handled, msg.Offset)
+			mu.Unlock()
+			return nil
+		},
+	}
+
+	gs := saramatest.NewMockConsumerGroupSession()
+	gc := saramatest.NewMockConsumerGroupClaim()
+
+	var msgs []*sarama.ConsumerMessage
+	for i, key := range []string{"slow", "fast1", "slow", "fast2", "fast1"} {
+		msg := &sarama.ConsumerMessage{Topic: "product", Key: []byte(key), Offset: int64(i)}
+		msgs = append(msgs, msg)
+		gc.PublishMessage(msg)
+	}
+	gc.CloseChannel()
+
+	con := newConsumer(make(chan model.Failure), cfg, hs, log.NullLogger{}, nil)
+	if err := con.ConsumeClaim(gs, gc); err != nil {
+		t.Fatalf("unexpected error occurred: %s", err)
+	}
+	// in-flight messages are waited for when the partitions are revoked
+	if err := con.Cleanup(gs); err != nil {
+		t.Fatalf("unexpected error occurred: %s", err)
+	}
+
+	if len(handled) != len(msgs) {
+		t.Fatalf("expected %d messages to be handled, but got %d", len(msgs), len(handled))
+	}
+
+	if diff := deep.Equal(msgs, gs.MarkedMessages()); diff != nil {
+		t.Errorf("messages were not marked in offset order: %v", diff)
+	}
+
+	var slowOffsets []int64
+	for _, o := range handled {
+		if o == 0 || o == 2 {
+			slowOffsets = append(slowOffsets, o)
+		}
+	}
+	if diff := deep.Equal([]int64{0, 2}, slowOffsets); diff != nil {
+		t.Errorf("messages with the same key were not processed in order: %v", diff)
+	}
+}
+
+func TestConsumer_ConsumeClaim_WithBatchHandler(t *testing.T) {
+	fch := make(chan model.Failure, 10)
+	cfg := newTestConfig()
+
+	msg1 := &sarama.ConsumerMessage{Topic: "product", Offset: 1, Value: []byte(`{"sku":"1"}`)}
+	msg2 := &sarama.ConsumerMessage{Topic: "product", Offset: 2, Value: []byte(`{"sku":"2"}`)}
+	msg3 := &sarama.ConsumerMessage{Topic: "product", Offset: 3, Value: []byte(`{"sku":"3"}`)}
+
+	var batchSizes []int
+	bhs := BatchHandlerMap{
+		"product": func(ctx context.Context, msgs []*sarama.ConsumerMessage) error {
+			batchSizes = append(batchSizes, len(msgs))
+			be := NewBatchError()
+			for _, msg := range msgs {
+				if msg == msg2 {
+					be.Fail(msg, errors.New("oops"))
+				}
+			}
+			if be.Failed() > 0 {
+				return be
+			}
+			return nil
+		},
+	}
+
+	gs := saramatest.NewMockConsumerGroupSession()
+	gc := saramatest.NewMockConsumerGroupClaim()
+	gc.SetTopic("product")
+	gc.PublishMessage(msg1)
+	gc.PublishMessage(msg2)
+	gc.PublishMessage(msg3)
+	gc.CloseChannel()
+
+	con := newConsumer(fch, cfg, HandlerMap{}, log.NullLogger{}, newOptions(WithBatchHandlers(bhs, 2, time.Minute)))
+	if err := con.ConsumeClaim(gs, gc); err != nil {
+		t.Fatalf("unexpected error occurred: %s", err)
+	}
+
+	if diff := deep.Equal([]int{2, 1}, batchSizes); diff != nil {
+		t.Errorf("unexpected batch sizes: %v", diff)
+	}
+
+	if diff := deep.Equal([]*sarama.ConsumerMessage{msg1, msg2, msg3}, gs.MarkedMessages()); diff != nil {
+		t.Errorf("messages were not marked in order: %v", diff)
+	}
+
+	if len(fch) != 1 {
+		t.Fatalf("expected 1 message in failure channel, got %d", len(fch))
+	}
+
+	if got := <-fch; got.KafkaOffset != 2 {
+		t.Errorf("expected the failure for offset 2 to be sent for retry, but got offset %d", got.KafkaOffset)
+	}
+}
+
+func TestConsumer_ConsumeClaim_WithBatchHandlerFlushInterval(t *testing.T) {
+	cfg := newTestConfig()
+	msg1 := &sarama.ConsumerMessage{Topic: "product", Offset: 1}
+
+	handled := make(chan int, 1)
+	bhs := BatchHandlerMap{
+		"product": func(ctx context.Context, msgs []*sarama.ConsumerMessage) error {
+			handled <- len(msgs)
+			return nil
+		},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	gs := saramatest.NewMockConsumerGroupSession()
+	gs.SetContext(ctx)
+	gc := saramatest.NewMockConsumerGroupClaim()
+	gc.SetTopic("product")
+	gc.PublishMessage(msg1)
+
+	con := newConsumer(make(chan model.Failure), cfg, HandlerMap{}, log.NullLogger{}, newOptions(WithBatchHandlers(bhs, 10, time.Millisecond*10)))
+	go func() {
+		_ = con.ConsumeClaim(gs, gc)
+	}()
+
+	select {
+	case got := <-handled:
+		if got != 1 {
+			t.Errorf("expected a batch of 1 message, but got %d", got)
+		}
+	case <-time.After(time.Second):
+		t.Error("batch was not flushed after the flush interval")
+	}
+}
+
+func TestConsumer_ConsumeClaim_WithPermanentFailure(t *testing.T) {
+	fch := make(chan model.Failure, 1)
+	hs := HandlerMap{
+		"product": func(ctx context.Context, msg *sarama.ConsumerMessage) error {
+			return Permanent(errors.New("invalid payload"))
+		},
+	}
+
+	gs := saramatest.NewMockConsumerGroupSession()
+	gc := saramatest.NewMockConsumerGroupClaim()
+	gc.PublishMessage(&sarama.ConsumerMessage{Topic: "product"})
+	gc.CloseChannel()
+
+	con := newConsumer(fch, newTestConfig(), hs, log.NullLogger{}, nil)
+	if err := con.ConsumeClaim(gs, gc); err != nil {
+		t.Fatalf("unexpected error occurred: %s", err)
+	}
+
+	select {
+	case got := <-fch:
+		if got.NextTopic != "deadLetter.kafkaGroup.product" {
+			t.Errorf("expected permanent failure to be sent to the dead-letter topic, but got '%s'", got.NextTopic)
+		}
+		if !got.Permanent {
+			t.Error("expected failure to be marked as permanent")
+		}
+	case <-time.After(time.Millisecond * 100):
+		t.Error("expected a failure for the message, but got none")
+	}
+}
+
+func TestConsumer_ConsumeClaim_WithRetryAfter(t *testing.T) {
+	cfg, err := config.NewBuilder().
+		SetKafkaHost([]string{"localhost"}).
+		SetKafkaGroup("kafkaGroup").
+		SetSourceTopics([]string{"product"}).
+		SetRetryIntervals([]int{1, 60, 600}).
+		Config()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	fch := make(chan model.Failure, 1)
+	hs := HandlerMap{
+		"product": func(ctx context.Context, msg *sarama.ConsumerMessage) error {
+			return RetryAfter(errors.New("rate limited"), time.Second*45)
+		},
+	}
+
+	gs := saramatest.NewMockConsumerGroupSession()
+	gc := saramatest.NewMockConsumerGroupClaim()
+	gc.PublishMessage(&sarama.ConsumerMessage{Topic: "product"})
+	gc.CloseChannel()
+
+	con := newConsumer(fch, cfg, hs, log.NullLogger{}, nil)
+	if err := con.ConsumeClaim(gs, gc); err != nil {
+		t.Fatalf("unexpected error occurred: %s", err)
+	}
+
+	select {
+	case got := <-fch:
+		if got.NextTopic != "retry2.kafkaGroup.product" {
+			t.Errorf("expected failure to be sent to the closest retry topic, but got '%s'", got.NextTopic)
+		}
+		if got.RetryAfter != time.Second*45 {
+			t.Errorf("expected failure to be retried after 45s, but got %s", got.RetryAfter)
+		}
+	case <-time.After(time.Millisecond * 100):
+		t.Error("expected a failure for the message, but got none")
+	}
+}
+
+func TestConsumer_ConsumeClaim_WithSharedRetryTopic(t *testing.T) {
+	cfg, err := config.NewBuilder().
+		SetKafkaHost([]string{"localhost"}).
+		SetKafkaGroup("kafkaGroup").
+		SetSourceTopics([]string{"product"}).
+		SetRetryPolicy("product", config.RetryPolicy{Intervals: []int{1}, MaxAttempts: 3}).
+		Config()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	tests := []struct {
+		name     string
+		attempts string
+		want     string
+	}{
+		{name: "retries share the retry topic", attempts: "2", want: "retry1.kafkaGroup.product"},
+		{name: "dead-lettered after the last retry", attempts: "3", want: "deadLetter.kafkaGroup.product"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fch := make(chan model.Failure, 1)
+			hs := HandlerMap{
+				"product": func(ctx context.Context, msg *sarama.ConsumerMessage) error {
+					return errors.New("oops")
+				},
+			}
+
+			gs := saramatest.NewMockConsumerGroupSession()
+			gc := saramatest.NewMockConsumerGroupClaim()
+			gc.PublishMessage(&sarama.ConsumerMessage{
+				Topic:   "retry1.kafkaGroup.product",
+				Headers: []*sarama.RecordHeader{{Key: []byte(HeaderAttempts), Value: []byte(tt.attempts)}},
+			})
+			gc.CloseChannel()
+
+			con := newConsumer(fch, cfg, hs, log.NullLogger{}, nil)
+			if err := con.ConsumeClaim(gs, gc); err != nil {
+				t.Fatalf("unexpected error occurred: %s", err)
+			}
+
+			select {
+			case got := <-fch:
+				if got.NextTopic != tt.want {
+					t.Errorf("expected failure to be sent to '%s', but got '%s'", tt.want, got.NextTopic)
+				}
+			case <-time.After(time.Millisecond * 100):
+				t.Error("expected a failure for the message, but got none")
+			}
+		})
+	}
+}
+
+func TestConsumer_ConsumeClaim_WaitsUntilRetryIsDue(t *testing.T) {
+	dueHeader := func(due time.Time) []*sarama.RecordHeader {
+		return []*sarama.RecordHeader{{Key: []byte(HeaderDueAt), Value: []byte(due.UTC().Format(time.RFC3339Nano))}}
+	}
+
+	t.Run("message is handled once it is due", func(t *testing.T) {
+		var handledAt time.Time
+		hs := HandlerMap{"product": func(ctx context.Context, msg *sarama.ConsumerMessage) error {
+			handledAt = time.Now()
+			return nil
+		}}
+
+		due := time.Now().Add(time.Millisecond * 100)
+		gs := saramatest.NewMockConsumerGroupSession()
+		gc := saramatest.NewMockConsumerGroupClaim()
+		msg := &sarama.ConsumerMessage{Topic: "retry.kafkaGroup.product", Headers: dueHeader(due)}
+		gc.PublishMessage(msg)
+		gc.CloseChannel()
+
+		con := newConsumer(make(chan model.Failure, 1), newTestConfig(), hs, log.NullLogger{}, nil)
+		if err := con.ConsumeClaim(gs, gc); err != nil {
+			t.Fatalf("unexpected error occurred: %s", err)
+		}
+
+		if handledAt.Before(due) {
+			t.Errorf("expected the message to be handled after %s, but it was handled at %s", due, handledAt)
+		}
+		if !gs.MessageWasMarked(msg) {
+			t.Error("expected the message to be marked as processed")
+		}
+	})
+
+	t.Run("message is not handled if the session ends before it is due", func(t *testing.T) {
+		handled := false
+		hs := HandlerMap{"product": func(ctx context.Context, msg *sarama.ConsumerMessage) error {
+			handled = true
+			return nil
+		}}
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*50)
+		defer cancel()
+		gs := saramatest.NewMockConsumerGroupSession()
+		gs.SetContext(ctx)
+		gc := saramatest.NewMockConsumerGroupClaim()
+		gc.PublishMessage(&sarama.ConsumerMessage{Topic: "retry.kafkaGroup.product", Headers: dueHeader(time.Now().Add(time.Hour))})
+
+		con := newConsumer(make(chan model.Failure, 1), newTestConfig(), hs, log.NullLogger{}, nil)
+		if err := con.ConsumeClaim(gs, gc); err != nil {
+			t.Fatalf("unexpected error occurred: %s", err)
+		}
+
+		if handled {
+			t.Error("expected the message not to be handled")
+		}
+		if len(gs.MarkedMessages()) != 0 {
+			t.Error("expected the message not to be marked as processed")
+		}
+	})
+
+	t.Run("message without a due time uses its timestamp and the topic delay", func(t *testing.T) {
+		cfg := newTestConfig()
+		cfg.TopicMap["retry.kafkaGroup.product"].Delay = time.Hour
+
+		con := newConsumer(make(chan model.Failure, 1), cfg, HandlerMap{}, log.NullLogger{}, nil).(*consumer)
+		ts := time.Now().Add(time.Minute * -10)
+		due, ok := con.dueAt(&sarama.ConsumerMessage{Topic: "retry.kafkaGroup.product", Timestamp: ts})
+		if !ok || !due.Equal(ts.Add(time.Hour)) {
+			t.Errorf("expected the message to be due at %s, but got %s (%v)", ts.Add(time.Hour), due, ok)
+		}
+
+		if _, ok := con.dueAt(&sarama.ConsumerMessage{Topic: "product", Timestamp: ts}); ok {
+			t.Error("expected messages from a main topic to have no due time")
+		}
+	})
+}
+
+func TestConsumer_ConsumeClaim_WithDeadLetterDisabled(t *testing.T) {
+	fch := make(chan model.Failure, 1)
+	cfg := newTestConfig()
+	cfg.RetryPolicies = map[config.TopicKey]config.RetryPolicy{
+		"product": {Intervals: []int{1}, DisableDeadLetter: true},
+	}
+	hs := HandlerMap{"product": func(ctx context.Context, msg *sarama.ConsumerMessage) error {
+		return errors.New("oops")
+	}}
+
+	gs := saramatest.NewMockConsumerGroupSession()
+	gc := saramatest.NewMockConsumerGroupClaim()
+	gc.PublishMessage(&sarama.ConsumerMessage{Topic: "retry.kafkaGroup.product"})
+	gc.CloseChannel()
+
+	labels := map[string]string{"topic": "product", "stage": "retry1"}
+	before := metricValue(t, "kafka_consumer_messages_discarded_total", labels)
+
+	con := newConsumer(fch, cfg, hs, log.NullLogger{}, nil)
+	if err := con.ConsumeClaim(gs, gc); err != nil {
+		t.Fatalf("unexpected error occurred: %s", err)
+	}
+
+	if len(fch) != 0 {
+		t.Errorf("expected the failure to be discarded, but it was sent to %s", (<-fch).NextTopic)
+	}
+	if got := metricValue(t, "kafka_consumer_messages_discarded_total", labels); got != before+1 {
+		t.Errorf("expected %v discarded messages, but got %v", before+1, got)
+	}
+	if len(gs.MarkedMessages()) != 1 {
+		t.Error("expected the discarded message to be marked as processed")
+	}
+}
+
+func TestConsumer_ConsumeClaim_WithoutHandler(t *testing.T) {
+	t.Run("unhandled messages are skipped and marked", func(t *testing.T) {
+		fch := make(chan model.Failure, 1)
+		gs := saramatest.NewMockConsumerGroupSession()
+		gc := saramatest.NewMockConsumerGroupClaim()
+		msg1 := &sarama.ConsumerMessage{Topic: "product"}
+		gc.PublishMessage(msg1)
+		gc.CloseChannel()
+
+		con := newConsumer(fch, newTestConfig(), HandlerMap{}, log.NullLogger{}, newOptions(WithUnhandledPolicy(SkipUnhandled)))
+		if err := con.ConsumeClaim(gs, gc); err != nil {
+			t.Fatalf("unexpected error occurred: %s", err)
+		}
+
+		if !gs.MessageWasMarked(msg1) {
+			t.Error("msg1 was not marked as processed")
+		}
+
+		if len(fch) != 0 {
+			t.Errorf("expected no failures, but got %d", len(fch))
+		}
+	})
+
+	t.Run("unhandled messages are dead-lettered", func(t *testing.T) {
+		fch := make(chan model.Failure, 1)
+		gs := saramatest.NewMockConsumerGroupSession()
+		gc := saramatest.NewMockConsumerGroupClaim()
+		gc.PublishMessage(&sarama.ConsumerMessage{Topic: "product"})
+		gc.CloseChannel()
+
+		con := newConsumer(fch, newTestConfig(), HandlerMap{}, log.NullLogger{}, newOptions(WithUnhandledPolicy(DeadLetterUnhandled)))
+		if err := con.ConsumeClaim(gs, gc); err != nil {
+			t.Fatalf("unexpected error occurred: %s", err)
+		}
+
+		select {
+		case got := <-fch:
+			if got.NextTopic != "deadLetter.kafkaGroup.product" {
+				t.Errorf("expected unhandled message to be sent to the dead-letter topic, but got '%s'", got.NextTopic)
+			}
+		case <-time.After(time.Millisecond * 100):
+			t.Error("expected a failure for the unhandled message, but got none")
+		}
+	})
+}
+
+func TestConsumer_ConsumeClaim_WithPanic(t *testing.T) {
+	fch := make(chan model.Failure, 1)
+	hs := HandlerMap{
+		"product": func(ctx context.Context, msg *sarama.ConsumerMessage) error {
+			panic("something really bad happened")
+		},
+	}
+
+	main := map[string]string{"topic": "product", "stage": "main"}
+	panicsBefore := metricValue(t, "kafka_consumer_handler_panics_total", main)
+
+	gs := saramatest.NewMockConsumerGroupSession()
+	gc := saramatest.NewMockConsumerGroupClaim()
+	msg1 := &sarama.ConsumerMessage{Topic: "product", Offset: 10}
+	gc.PublishMessage(msg1)
+	gc.CloseChannel()
+
+	logger := &recordingLogger{}
+	con := newConsumer(fch, newTestConfig(), hs, logger, nil)
+	if err := con.ConsumeClaim(gs, gc); err != nil {
+		t.Fatalf("unexpected error occurred: %s", err)
+	}
+
+	if !gs.MessageWasMarked(msg1) {
+		t.Error("msg1 was not marked as processed")
+	}
+	if got := metricValue(t, "kafka_consumer_handler_panics_total", main); got != panicsBefore+1 {
+		t.Errorf("expected %v handler panics, but got %v", panicsBefore+1, got)
+	}
+
+	var logged int
+	for _, e := range logger.entries {
+		if e.msg != "recovered from panic in handler" {
+			continue
+		}
+		logged++
+		for _, f := range e.fields {
+			if f.Key == "stack" && !strings.Contains(f.Value.(string), "goroutine") {
+				t.Errorf("expected the stack trace to be logged, but got '%s'", f.Value)
+			}
+		}
+	}
+	if logged != 1 {
+		t.Errorf("expected the panic to be logged once, but it was logged %d times", logged)
+	}
+
+	select {
+	case got := <-fch:
+		if got.NextTopic != "retry.kafkaGroup.product" {
+			t.Errorf("expected failure to be sent to the next topic, but got '%s'", got.NextTopic)
+		}
+		if got.Reason != "consumer: handler panicked: something really bad happened" {
+			t.Errorf("expected failure reason to contain the panic without the stack trace, but got '%s'", got.Reason)
+		}
+	case <-time.After(time.Millisecond * 100):
+		t.Error("expected a failure for the panicking handler, but got none")
+	}
+}
+
+func TestConsumer_ConsumeClaim_RecordsMetrics(t *testing.T) {
+	fch := make(chan model.Failure, 1)
+	handler := &mockConsumerHandler{}
+	handler.willFail()
+
+	main := map[string]string{"topic": "product", "stage": "main"}
+	consumedBefore := metricValue(t, "kafka_consumer_messages_consumed_total", main)
+	failuresBefore := metricValue(t, "kafka_consumer_handler_failures_total", main)
+
+	gs := saramatest.NewMockConsumerGroupSession()
+	gc := saramatest.NewMockConsumerGroupClaim()
+	gc.PublishMessage(&sarama.ConsumerMessage{Topic: "product"})
+	gc.CloseChannel()
+
+	con := newConsumer(fch, newTestConfig(), HandlerMap{"product": handler.handle}, log.NullLogger{}, nil)
+	if err := con.ConsumeClaim(gs, gc); err != nil {
+		t.Fatalf("unexpected error occurred: %s", err)
+	}
+
+	if got := metricValue(t, "kafka_consumer_messages_consumed_total", main); got != consumedBefore+1 {
+		t.Errorf("expected %v messages consumed, but got %v", consumedBefore+1, got)
+	}
+	if got := metricValue(t, "kafka_consumer_handler_failures_total", main); got != failuresBefore+1 {
+		t.Errorf("expected %v handler failures, but got %v", failuresBefore+1, got)
+	}
+}
+
+func TestConsumer_ConsumeClaim_RecordsLag(t *testing.T) {
+	gs := saramatest.NewMockConsumerGroupSession()
+	gs.SetClaims(map[string][]int32{"retry.kafkaGroup.product": {3}})
+	gc := saramatest.NewMockConsumerGroupClaim()
+	gc.SetTopic("retry.kafkaGroup.product")
+	gc.SetHighWaterMarkOffset(10)
+	gc.PublishMessage(&sarama.ConsumerMessage{Topic: "retry.kafkaGroup.product", Partition: 3, Offset: 4})
+	gc.CloseChannel()
+
+	hs := HandlerMap{"product": func(ctx context.Context, msg *sarama.ConsumerMessage) error {
+		return nil
+	}}
+	con := newConsumer(make(chan model.Failure), newTestConfig(), hs, log.NullLogger{}, nil)
+	if err := con.ConsumeClaim(gs, gc); err != nil {
+		t.Fatalf("unexpected error occurred: %s", err)
+	}
+
+	labels := map[string]string{"topic": "retry.kafkaGroup.product", "partition": "3"}
+	if got := metricValue(t, "kafka_consumer_lag", labels); got != 5 {
+		t.Errorf("expected a lag of 5, but got %v", got)
+	}
+
+	if err := con.Cleanup(gs); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if got := metricValue(t, "kafka_consumer_lag", labels); got != 0 {
+		t.Errorf("expected the lag to be removed on cleanup, but got %v", got)
+	}
+}
+
 func newTestConfig() *config.Config {
 	deadLetterProduct := &config.KafkaTopic{
 		Name: "deadLetter.kafkaGroup.product",
@@ -199,3 +748,24 @@ func (m *mockConsumerHandler) handle(ctx context.Context, msg *sarama.ConsumerMe
 func (m *mockConsumerHandler) willFail() {
 	m.fail = true
 }
+
+func TestConsumer_SetupAndCleanup(t *testing.T) {
+	opts := newOptions()
+	con := newConsumer(make(chan model.Failure), newTestConfig(), HandlerMap{}, log.NullLogger{}, opts)
+	sess := saramatest.NewMockConsumerGroupSession()
+	sess.SetClaims(map[string][]int32{"product": {0, 1}})
+
+	if err := con.Setup(sess); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if diff := deep.Equal(map[string][]int32{"product": {0, 1}}, opts.status.snapshot().AssignedPartitions); diff != nil {
+		t.Error(diff)
+	}
+
+	if err := con.Cleanup(sess); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if got := opts.status.snapshot().AssignedPartitions; len(got) != 0 {
+		t.Errorf("expected no assigned partitions after cleanup, but got %v", got)
+	}
+}
@@ -4,14 +4,14 @@ import (
 	"database/sql"
 	"fmt"
 	"time"
-
-	_ "github.com/jackc/pgx/v4/stdlib"
 )
 
 const retryAttempts = 10
 
-func NewDB(dsn string) (*sql.DB, error) {
-	db, err := sql.Open("pgx", dsn)
+// NewDB connects to the database with the given DSN, using the driver for the dialect, and
+// waits for it to become available.
+func NewDB(dialect Dialect, dsn string) (*sql.DB, error) {
+	db, err := sql.Open(dialect.driverName(), dsn)
 
 	if err != nil {
 		return nil, fmt.Errorf("unable to connect to the database: %w", err)
@@ -0,0 +1,88 @@
+package data
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/go-sql-driver/mysql"
+	_ "github.com/jackc/pgx/v4/stdlib"
+)
+
+// Dialect is the SQL dialect of the database used for retries.
+type Dialect string
+
+const (
+	DialectPostgres Dialect = "postgres"
+	DialectMySQL    Dialect = "mysql"
+)
+
+// DialectForDriver returns the dialect for the database driver set in the config builder, which
+// is one of "postgres" (or "postgresql") and "mysql".
+func DialectForDriver(driver string) (Dialect, error) {
+	switch driver {
+	case "postgres", "postgresql":
+		return DialectPostgres, nil
+	case "mysql":
+		return DialectMySQL, nil
+	default:
+		return "", fmt.Errorf("unsupported database driver '%s', must be one of postgres or mysql", driver)
+	}
+}
+
+// DialectOf returns the dialect of the database that db is connected to, based on its driver.
+// Databases opened with an unknown driver are assumed to be Postgres.
+func DialectOf(db *sql.DB) Dialect {
+	if _, ok := db.Driver().(*mysql.MySQLDriver); ok {
+		return DialectMySQL
+	}
+	return DialectPostgres
+}
+
+// driverName returns the name of the database/sql driver used to connect to the database.
+func (d Dialect) driverName() string {
+	if d == DialectMySQL {
+		return "mysql"
+	}
+	return "pgx"
+}
+
+// Rebind returns query, written with Postgres placeholders ($1, $2, ...), in the dialect. As
+// MySQL placeholders (?) are positional, args are returned in the order that they are bound,
+// so a Postgres placeholder may be used more than once, and in any order, in query.
+func (d Dialect) Rebind(query string, args []interface{}) (string, []interface{}) {
+	if d != DialectMySQL {
+		return query, args
+	}
+
+	var b strings.Builder
+	var bound []interface{}
+	inString := false
+	for i := 0; i < len(query); i++ {
+		c := query[i]
+		if c == '\'' {
+			inString = !inString
+		}
+		if c != '$' || inString {
+			b.WriteByte(c)
+			continue
+		}
+
+		j := i + 1
+		for j < len(query) && query[j] >= '0' && query[j] <= '9' {
+			j++
+		}
+		n, err := strconv.Atoi(query[i+1 : j])
+		if err != nil || n < 1 || n > len(args) {
+			b.WriteByte(c)
+			continue
+		}
+
+		b.WriteByte('?')
+		bound = append(bound, args[n-1])
+		i = j - 1
+	}
+
+	return b.String(), bound
+}
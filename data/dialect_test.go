@@ -0,0 +1,104 @@
+package data
+
+import (
+	"database/sql"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/go-test/deep"
+)
+
+func TestDialectForDriver(t *testing.T) {
+	tests := []struct {
+		driver  string
+		want    Dialect
+		wantErr bool
+	}{
+		{driver: "postgres", want: DialectPostgres},
+		{driver: "postgresql", want: DialectPostgres},
+		{driver: "mysql", want: DialectMySQL},
+		{driver: "sqlite3", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := DialectForDriver(tt.driver)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("DialectForDriver(%s) error = %v, wantErr %v", tt.driver, err, tt.wantErr)
+		}
+		if got != tt.want {
+			t.Errorf("DialectForDriver(%s) = %s, want %s", tt.driver, got, tt.want)
+		}
+	}
+}
+
+func TestDialectOf(t *testing.T) {
+	db, _, _ := sqlmock.New()
+	if got := DialectOf(db); got != DialectPostgres {
+		t.Errorf("expected an unknown driver to be %s, but got %s", DialectPostgres, got)
+	}
+
+	// opening does not connect, so no server is needed
+	db, err := sql.Open(DialectMySQL.driverName(), "user:pass@tcp(localhost:3306)/retries")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if got := DialectOf(db); got != DialectMySQL {
+		t.Errorf("expected %s, but got %s", DialectMySQL, got)
+	}
+}
+
+func TestDialect_Rebind(t *testing.T) {
+	tests := []struct {
+		name      string
+		dialect   Dialect
+		query     string
+		args      []interface{}
+		wantQuery string
+		wantArgs  []interface{}
+	}{
+		{
+			name:      "postgres queries are unchanged",
+			dialect:   DialectPostgres,
+			query:     `UPDATE t SET a = $2 WHERE id = $1`,
+			args:      []interface{}{1, "a"},
+			wantQuery: `UPDATE t SET a = $2 WHERE id = $1`,
+			wantArgs:  []interface{}{1, "a"},
+		},
+		{
+			name:      "mysql placeholders are positional",
+			dialect:   DialectMySQL,
+			query:     `UPDATE t SET a = $2, b = $10 WHERE id = $1`,
+			args:      []interface{}{1, "a", 3, 4, 5, 6, 7, 8, 9, "b"},
+			wantQuery: `UPDATE t SET a = ?, b = ? WHERE id = ?`,
+			wantArgs:  []interface{}{"a", "b", 1},
+		},
+		{
+			name:      "mysql placeholders that are reused are bound each time",
+			dialect:   DialectMySQL,
+			query:     `INSERT INTO t(a, b, c) VALUES($1, $2, $2)`,
+			args:      []interface{}{"a", true},
+			wantQuery: `INSERT INTO t(a, b, c) VALUES(?, ?, ?)`,
+			wantArgs:  []interface{}{"a", true, true},
+		},
+		{
+			name:      "mysql strings and invalid placeholders are not rebound",
+			dialect:   DialectMySQL,
+			query:     `SELECT '$1', $ FROM t WHERE a = $1 AND b = $3`,
+			args:      []interface{}{"a"},
+			wantQuery: `SELECT '$1', $ FROM t WHERE a = ? AND b = $3`,
+			wantArgs:  []interface{}{"a"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotQuery, gotArgs := tt.dialect.Rebind(tt.query, tt.args)
+			if gotQuery != tt.wantQuery {
+				t.Errorf("expected query %s, but got %s", tt.wantQuery, gotQuery)
+			}
+			if diff := deep.Equal(tt.wantArgs, gotArgs); diff != nil {
+				t.Error(diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,51 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// PermanentError wraps an error that will never succeed on retry, e.g. a message that cannot be
+// decoded. Messages that fail with a PermanentError skip any remaining retries and are sent
+// straight to the dead-letter stage.
+type PermanentError struct {
+	Err error
+}
+
+func (e *PermanentError) Error() string {
+	return fmt.Sprintf("permanent failure: %s", e.Err)
+}
+
+func (e *PermanentError) Unwrap() error {
+	return e.Err
+}
+
+// RetryAfterError wraps an error that should be retried after Delay has elapsed.
+type RetryAfterError struct {
+	Err   error
+	Delay time.Duration
+}
+
+func (e *RetryAfterError) Error() string {
+	return fmt.Sprintf("retry after %s: %s", e.Delay, e.Err)
+}
+
+func (e *RetryAfterError) Unwrap() error {
+	return e.Err
+}
+
+// IsPermanent reports whether err, or any error that it wraps, is a *PermanentError.
+func IsPermanent(err error) bool {
+	var pe *PermanentError
+	return errors.As(err, &pe)
+}
+
+// RetryDelay returns the delay requested by a *RetryAfterError in err's chain, if there is one.
+func RetryDelay(err error) (time.Duration, bool) {
+	var re *RetryAfterError
+	if !errors.As(err, &re) {
+		return 0, false
+	}
+	return re.Delay, true
+}
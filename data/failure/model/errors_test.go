@@ -0,0 +1,52 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestIsPermanent(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "nil error", err: nil},
+		{name: "plain error", err: errors.New("oops")},
+		{name: "permanent error", err: &PermanentError{Err: errors.New("oops")}, want: true},
+		{name: "wrapped permanent error", err: fmt.Errorf("wrapped: %w", &PermanentError{Err: errors.New("oops")}), want: true},
+		{name: "retry after error", err: &RetryAfterError{Err: errors.New("oops"), Delay: time.Second}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsPermanent(tt.err); got != tt.want {
+				t.Errorf("IsPermanent() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	t.Run("delay is returned from retry after error", func(t *testing.T) {
+		d, ok := RetryDelay(fmt.Errorf("wrapped: %w", &RetryAfterError{Err: errors.New("oops"), Delay: time.Minute}))
+		if !ok || d != time.Minute {
+			t.Errorf("expected delay of 1m, got %s (ok: %v)", d, ok)
+		}
+	})
+
+	t.Run("no delay for other errors", func(t *testing.T) {
+		if _, ok := RetryDelay(errors.New("oops")); ok {
+			t.Error("expected no delay to be returned")
+		}
+	})
+}
+
+func TestPermanentError_Unwrap(t *testing.T) {
+	inner := errors.New("oops")
+	if !errors.Is(&PermanentError{Err: inner}, inner) {
+		t.Error("expected permanent error to unwrap to the inner error")
+	}
+}
@@ -2,10 +2,32 @@ package model
 
 import (
 	"encoding/json"
+	"sort"
+	"strconv"
+	"time"
 
 	"github.com/Shopify/sarama"
 )
 
+// Headers added to messages that are republished to a Kafka retry or dead-letter topic.
+const (
+	// HeaderOriginalTopic is the main topic that the message was first consumed from.
+	HeaderOriginalTopic = "x-original-topic"
+	// HeaderOriginalPartition is the partition of the main topic that the message was first consumed from.
+	HeaderOriginalPartition = "x-original-partition"
+	// HeaderOriginalOffset is the offset of the message in the main topic.
+	HeaderOriginalOffset = "x-original-offset"
+	// HeaderFailureReason is the error returned by the handler for the latest failed attempt.
+	HeaderFailureReason = "x-failure-reason"
+	// HeaderAttempts is the number of processing attempts that have failed so far.
+	HeaderAttempts = "x-attempts"
+	// HeaderFirstFailureAt is the time of the first failed attempt, in RFC 3339 format.
+	HeaderFirstFailureAt = "x-first-failure-at"
+	// HeaderDueAt is the earliest time that the message should be retried, in RFC 3339 format.
+	// It is not set for messages published to a dead-letter topic.
+	HeaderDueAt = "x-retry-due-at"
+)
+
 type Failure struct {
 	Reason         string
 	Topic          string
@@ -15,12 +37,18 @@ type Failure struct {
 	MessageHeaders []byte
 	KafkaPartition int32
 	KafkaOffset    int64
+	// Permanent is true when the failure will not be resolved by a retry, see PermanentError
+	Permanent bool
+	// RetryAfter is the delay requested by the handler before the message is retried, see RetryAfterError
+	RetryAfter time.Duration
 }
 
 // FailureFromSaramaMessage will create a Failure value from the provided values.
 // NOTE: In the future, if we drop support for kafka retry topics, the nextTopic
 // parameter will be removed.
 func FailureFromSaramaMessage(err error, nextTopic string, sm *sarama.ConsumerMessage) Failure {
+	retryAfter, _ := RetryDelay(err)
+
 	return Failure{
 		Reason:         err.Error(),
 		Topic:          sm.Topic,
@@ -30,9 +58,113 @@ func FailureFromSaramaMessage(err error, nextTopic string, sm *sarama.ConsumerMe
 		MessageHeaders: saramaRecordHeadersToJson(sm.Headers),
 		KafkaPartition: sm.Partition,
 		KafkaOffset:    sm.Offset,
+		Permanent:      IsPermanent(err),
+		RetryAfter:     retryAfter,
+	}
+}
+
+// SaramaRecordHeaders returns the headers of the original message, so that they can be
+// preserved when the message is republished for retry. They are sorted by key.
+func (f Failure) SaramaRecordHeaders() []sarama.RecordHeader {
+	return sortedRecordHeaders(f.headerMap())
+}
+
+// RetryRecordHeaders returns the headers of the original message, along with the failure
+// metadata headers (see HeaderAttempts), for republishing the message to a Kafka retry or
+// dead-letter topic. The original topic, partition, offset and first failure time are kept
+// from earlier failures, and failedAt is used as the first failure time if there were none.
+// The HeaderDueAt header is set to dueAt, or removed if dueAt is zero. They are sorted by key.
+func (f Failure) RetryRecordHeaders(failedAt, dueAt time.Time) []sarama.RecordHeader {
+	hm := f.headerMap()
+	if hm == nil {
+		hm = map[string]string{}
+	}
+
+	setHeaderDefault(hm, HeaderOriginalTopic, f.Topic)
+	setHeaderDefault(hm, HeaderOriginalPartition, strconv.FormatInt(int64(f.KafkaPartition), 10))
+	setHeaderDefault(hm, HeaderOriginalOffset, strconv.FormatInt(f.KafkaOffset, 10))
+	setHeaderDefault(hm, HeaderFirstFailureAt, failedAt.UTC().Format(time.RFC3339Nano))
+	hm[HeaderFailureReason] = f.Reason
+	hm[HeaderAttempts] = strconv.Itoa(AttemptsFromHeader(hm[HeaderAttempts]) + 1)
+	if dueAt.IsZero() {
+		delete(hm, HeaderDueAt)
+	} else {
+		hm[HeaderDueAt] = dueAt.UTC().Format(time.RFC3339Nano)
+	}
+
+	return sortedRecordHeaders(hm)
+}
+
+// Attempts returns the number of processing attempts that have failed, including this one, based
+// on the HeaderAttempts header of the original message.
+func (f Failure) Attempts() int {
+	return AttemptsFromHeader(f.headerMap()[HeaderAttempts]) + 1
+}
+
+// IsFailureHeader reports whether key is one of the failure metadata headers added by
+// RetryRecordHeaders.
+func IsFailureHeader(key string) bool {
+	switch key {
+	case HeaderOriginalTopic, HeaderOriginalPartition, HeaderOriginalOffset, HeaderFailureReason,
+		HeaderAttempts, HeaderFirstFailureAt, HeaderDueAt:
+		return true
+	}
+	return false
+}
+
+// AttemptsFromHeader returns the number of failed processing attempts recorded in the value of
+// a HeaderAttempts header, or 0 if the value is empty or invalid.
+func AttemptsFromHeader(v string) int {
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 {
+		return 0
+	}
+	return n
+}
+
+// DueAtFromHeader returns the time in the value of a HeaderDueAt header. The second return
+// value is false if the value is empty or invalid.
+func DueAtFromHeader(v string) (time.Time, bool) {
+	t, err := time.Parse(time.RFC3339Nano, v)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return t, true
+}
+
+func (f Failure) headerMap() map[string]string {
+	var headerMap map[string]string
+	if err := json.Unmarshal(f.MessageHeaders, &headerMap); err != nil {
+		return nil
+	}
+	return headerMap
+}
+
+func setHeaderDefault(headerMap map[string]string, key, value string) {
+	if _, ok := headerMap[key]; !ok {
+		headerMap[key] = value
 	}
 }
 
+func sortedRecordHeaders(headerMap map[string]string) []sarama.RecordHeader {
+	if len(headerMap) == 0 {
+		return nil
+	}
+
+	keys := make([]string, 0, len(headerMap))
+	for k := range headerMap {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	headers := make([]sarama.RecordHeader, 0, len(keys))
+	for _, k := range keys {
+		headers = append(headers, sarama.RecordHeader{Key: []byte(k), Value: []byte(headerMap[k])})
+	}
+
+	return headers
+}
+
 func saramaRecordHeadersToJson(headers []*sarama.RecordHeader) []byte {
 	headerMap := map[string]string{}
 
@@ -2,7 +2,9 @@ package model
 
 import (
 	"errors"
+	"fmt"
 	"testing"
+	"time"
 
 	"github.com/Shopify/sarama"
 	"github.com/go-test/deep"
@@ -39,4 +41,114 @@ func TestFailureFromSaramaMessage(t *testing.T) {
 			t.Error(diff)
 		}
 	})
+
+	t.Run("failure created from permanent error", func(t *testing.T) {
+		err := &PermanentError{Err: errors.New("something bad happened")}
+		got := FailureFromSaramaMessage(err, "deadLetter.product", exampleMsg)
+		if !got.Permanent {
+			t.Error("expected failure to be permanent, but it was not")
+		}
+	})
+
+	t.Run("failure created from retry after error", func(t *testing.T) {
+		err := fmt.Errorf("wrapped: %w", &RetryAfterError{Err: errors.New("rate limited"), Delay: time.Minute})
+		got := FailureFromSaramaMessage(err, "retry1.product", exampleMsg)
+		if got.RetryAfter != time.Minute {
+			t.Errorf("expected failure to be retried after 1m, but got %s", got.RetryAfter)
+		}
+	})
+}
+
+func TestFailure_SaramaRecordHeaders(t *testing.T) {
+	t.Run("headers are returned sorted by key", func(t *testing.T) {
+		f := Failure{MessageHeaders: []byte(`{"traceparent":"00-abc-def-01","foo":"bar"}`)}
+		exp := []sarama.RecordHeader{
+			{Key: []byte("foo"), Value: []byte("bar")},
+			{Key: []byte("traceparent"), Value: []byte("00-abc-def-01")},
+		}
+
+		if diff := deep.Equal(exp, f.SaramaRecordHeaders()); diff != nil {
+			t.Error(diff)
+		}
+	})
+
+	t.Run("no headers are returned when there are none", func(t *testing.T) {
+		for _, h := range [][]byte{nil, []byte(`{}`), []byte(`invalid`)} {
+			if got := (Failure{MessageHeaders: h}).SaramaRecordHeaders(); got != nil {
+				t.Errorf("expected no headers for %q, but got %v", h, got)
+			}
+		}
+	})
+}
+
+func TestFailure_RetryRecordHeaders(t *testing.T) {
+	failedAt := time.Date(2022, 6, 1, 12, 30, 0, 0, time.UTC)
+
+	t.Run("metadata headers are added to the original headers", func(t *testing.T) {
+		f := Failure{
+			Reason:         "something bad happened",
+			Topic:          "product",
+			KafkaPartition: 2,
+			KafkaOffset:    300,
+			MessageHeaders: []byte(`{"traceparent":"00-abc-def-01"}`),
+		}
+		exp := []sarama.RecordHeader{
+			{Key: []byte("traceparent"), Value: []byte("00-abc-def-01")},
+			{Key: []byte(HeaderAttempts), Value: []byte("1")},
+			{Key: []byte(HeaderFailureReason), Value: []byte("something bad happened")},
+			{Key: []byte(HeaderFirstFailureAt), Value: []byte("2022-06-01T12:30:00Z")},
+			{Key: []byte(HeaderOriginalOffset), Value: []byte("300")},
+			{Key: []byte(HeaderOriginalPartition), Value: []byte("2")},
+			{Key: []byte(HeaderOriginalTopic), Value: []byte("product")},
+		}
+
+		if diff := deep.Equal(exp, f.RetryRecordHeaders(failedAt, time.Time{})); diff != nil {
+			t.Error(diff)
+		}
+	})
+
+	t.Run("metadata from earlier failures is kept and the attempts are incremented", func(t *testing.T) {
+		f := Failure{
+			Reason:         "still failing",
+			Topic:          "retry1.group.product",
+			KafkaPartition: 0,
+			KafkaOffset:    12,
+			MessageHeaders: []byte(`{"x-attempts":"1","x-failure-reason":"something bad happened","x-first-failure-at":"2022-06-01T12:00:00Z","x-original-offset":"300","x-original-partition":"2","x-original-topic":"product","x-retry-due-at":"2022-06-01T12:01:00Z"}`),
+		}
+		exp := []sarama.RecordHeader{
+			{Key: []byte(HeaderAttempts), Value: []byte("2")},
+			{Key: []byte(HeaderFailureReason), Value: []byte("still failing")},
+			{Key: []byte(HeaderFirstFailureAt), Value: []byte("2022-06-01T12:00:00Z")},
+			{Key: []byte(HeaderOriginalOffset), Value: []byte("300")},
+			{Key: []byte(HeaderOriginalPartition), Value: []byte("2")},
+			{Key: []byte(HeaderOriginalTopic), Value: []byte("product")},
+			{Key: []byte(HeaderDueAt), Value: []byte("2022-06-01T12:35:00.5Z")},
+		}
+
+		if diff := deep.Equal(exp, f.RetryRecordHeaders(failedAt, failedAt.Add(time.Millisecond*300500))); diff != nil {
+			t.Error(diff)
+		}
+	})
+}
+
+func TestDueAtFromHeader(t *testing.T) {
+	got, ok := DueAtFromHeader("2022-06-01T12:35:00.5Z")
+	if !ok || !got.Equal(time.Date(2022, 6, 1, 12, 35, 0, 500000000, time.UTC)) {
+		t.Errorf("unexpected due time %s (%v)", got, ok)
+	}
+
+	if _, ok := DueAtFromHeader("tomorrow"); ok {
+		t.Error("expected an invalid due time to not be returned")
+	}
+}
+
+func TestIsFailureHeader(t *testing.T) {
+	for _, k := range []string{HeaderOriginalTopic, HeaderOriginalPartition, HeaderOriginalOffset, HeaderFailureReason, HeaderAttempts, HeaderFirstFailureAt, HeaderDueAt} {
+		if !IsFailureHeader(k) {
+			t.Errorf("expected '%s' to be a failure header", k)
+		}
+	}
+	if IsFailureHeader("traceparent") {
+		t.Error("expected 'traceparent' not to be a failure header")
+	}
 }
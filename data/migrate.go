@@ -6,20 +6,30 @@ import (
 	"fmt"
 
 	"github.com/golang-migrate/migrate/v4"
+	"github.com/golang-migrate/migrate/v4/database"
+	"github.com/golang-migrate/migrate/v4/database/mysql"
 	"github.com/golang-migrate/migrate/v4/database/postgres"
 	"github.com/golang-migrate/migrate/v4/source/iofs"
 )
 
-//go:embed migrations/*.sql
+const migrationsTable = "kafka_consumer_migrations"
+
+// migrationFiles holds a directory of migrations for each dialect. Each MySQL migration must be
+// a single statement, as multiple statements are not enabled in the MySQL DSN.
+//
+//go:embed migrations/postgres/*.sql migrations/mysql/*.sql
 var migrationFiles embed.FS
 
+// MigrateDatabase applies the migrations for the dialect of db, see DialectOf.
 func MigrateDatabase(db *sql.DB, schema string) error {
-	databaseDriver, err := postgres.WithInstance(db, &postgres.Config{MigrationsTable: "kafka_consumer_migrations"})
+	dialect := DialectOf(db)
+
+	databaseDriver, err := migrationDriver(db, dialect)
 	if err != nil {
 		return fmt.Errorf("unable to create migration instance from database: %w", err)
 	}
 
-	d, err := iofs.New(migrationFiles, "migrations")
+	d, err := iofs.New(migrationFiles, "migrations/"+string(dialect))
 	if err != nil {
 		return fmt.Errorf("unable to load migration files from embedded filesystem: %w", err)
 	}
@@ -35,3 +45,10 @@ func MigrateDatabase(db *sql.DB, schema string) error {
 
 	return nil
 }
+
+func migrationDriver(db *sql.DB, dialect Dialect) (database.Driver, error) {
+	if dialect == DialectMySQL {
+		return mysql.WithInstance(db, &mysql.Config{MigrationsTable: migrationsTable})
+	}
+	return postgres.WithInstance(db, &postgres.Config{MigrationsTable: migrationsTable})
+}
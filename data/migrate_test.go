@@ -0,0 +1,39 @@
+package data
+
+import (
+	"io/fs"
+	"strings"
+	"testing"
+
+	"github.com/go-test/deep"
+)
+
+func TestMigrationFiles(t *testing.T) {
+	names := func(dialect Dialect) []string {
+		entries, err := fs.ReadDir(migrationFiles, "migrations/"+string(dialect))
+		if err != nil {
+			t.Fatalf("unable to read %s migrations: %s", dialect, err)
+		}
+
+		var n []string
+		for _, e := range entries {
+			n = append(n, e.Name())
+		}
+		return n
+	}
+
+	// each migration is needed in every dialect, so that their schemas stay the same
+	if diff := deep.Equal(names(DialectPostgres), names(DialectMySQL)); diff != nil {
+		t.Errorf("the postgres and mysql migrations are different: %v", diff)
+	}
+
+	for _, name := range names(DialectMySQL) {
+		b, err := fs.ReadFile(migrationFiles, "migrations/mysql/"+name)
+		if err != nil {
+			t.Fatalf("unable to read mysql migration %s: %s", name, err)
+		}
+		if statements := strings.Count(strings.TrimSpace(string(b)), ";"); statements != 1 {
+			t.Errorf("mysql migration %s must be a single statement, but has %d", name, statements)
+		}
+	}
+}
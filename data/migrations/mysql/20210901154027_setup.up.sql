@@ -0,0 +1,19 @@
+CREATE TABLE IF NOT EXISTS kafka_consumer_retries(
+    id BIGINT NOT NULL AUTO_INCREMENT PRIMARY KEY,
+    topic VARCHAR (255) NOT NULL,
+    batch_id CHAR(36) NULL,
+    retry_started_at DATETIME NULL,
+    retry_finished_at DATETIME NULL,
+    payload_json LONGTEXT NOT NULL,
+    payload_headers LONGTEXT NOT NULL,
+    payload_key VARCHAR(255) NOT NULL,
+    kafka_offset BIGINT NOT NULL,
+    kafka_partition INT NOT NULL,
+    attempts SMALLINT NOT NULL DEFAULT 1,
+    deadlettered BOOLEAN NOT NULL DEFAULT false,
+    successful BOOLEAN NOT NULL DEFAULT false,
+    errored BOOLEAN NOT NULL DEFAULT false,
+    last_error VARCHAR (255) NOT NULL DEFAULT '',
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+) DEFAULT CHARSET = utf8mb4 COLLATE = utf8mb4_bin;
@@ -0,0 +1 @@
+ALTER TABLE kafka_consumer_retries DROP INDEX topic_attempts_idx, DROP INDEX batch_id_idx;
@@ -0,0 +1 @@
+ALTER TABLE kafka_consumer_retries ADD INDEX topic_attempts_idx (topic, attempts), ADD INDEX batch_id_idx (batch_id);
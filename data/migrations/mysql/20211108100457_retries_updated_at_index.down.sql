@@ -0,0 +1 @@
+DROP INDEX retries_updated_at_idx ON kafka_consumer_retries;
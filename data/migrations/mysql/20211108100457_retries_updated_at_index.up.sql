@@ -0,0 +1 @@
+CREATE INDEX retries_updated_at_idx ON kafka_consumer_retries (updated_at);
@@ -0,0 +1 @@
+ALTER TABLE kafka_consumer_retries MODIFY last_error VARCHAR(255) NOT NULL DEFAULT '';
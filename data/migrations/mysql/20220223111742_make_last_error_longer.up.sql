@@ -0,0 +1 @@
+ALTER TABLE kafka_consumer_retries MODIFY last_error TEXT NOT NULL;
@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS kafka_consumer_retries_audit(
+    id BIGINT NOT NULL AUTO_INCREMENT PRIMARY KEY,
+    retry_id BIGINT NOT NULL,
+    action VARCHAR (32) NOT NULL,
+    topic VARCHAR (255) NOT NULL,
+    last_error TEXT NOT NULL,
+    actor VARCHAR (255) NOT NULL DEFAULT '',
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    INDEX audit_retry_id_idx (retry_id)
+) DEFAULT CHARSET = utf8mb4 COLLATE = utf8mb4_bin;
@@ -0,0 +1 @@
+ALTER TABLE kafka_consumer_retries DROP COLUMN next_retry_at;
@@ -0,0 +1 @@
+ALTER TABLE kafka_consumer_retries ADD COLUMN next_retry_at timestamp NULL;
@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS kafka_consumer_retries_audit(
+    id SERIAL PRIMARY KEY,
+    retry_id INT NOT NULL,
+    action VARCHAR (32) NOT NULL,
+    topic VARCHAR (255) NOT NULL,
+    last_error TEXT NOT NULL DEFAULT '',
+    actor VARCHAR (255) NOT NULL DEFAULT '',
+    created_at timestamp DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS audit_retry_id_idx ON kafka_consumer_retries_audit (retry_id);
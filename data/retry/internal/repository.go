@@ -9,31 +9,56 @@ import (
 
 	"github.com/google/uuid"
 
+	"github.com/inviqa/kafka-consumer-go/data"
 	failuremodel "github.com/inviqa/kafka-consumer-go/data/failure/model"
 	"github.com/inviqa/kafka-consumer-go/data/retry/model"
 )
 
 const (
 	consideredStaleAfter = time.Minute * 10
+	// changeBatchSize is the most retries that are changed by each statement when retries are
+	// requeued, purged or retried now, so that their IDs do not exceed the parameter limit
+	changeBatchSize = 1000
 )
 
 var (
-	columns = []string{"id", "topic", "payload_json", "payload_headers", "payload_key", "kafka_offset", "kafka_partition", "attempts"}
+	likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+	columns     = []string{"id", "topic", "payload_json", "payload_headers", "payload_key", "kafka_offset", "kafka_partition", "attempts"}
+	// detailColumns are the columns of a retry that are shown when inspecting the retry store
+	detailColumns = append(columns, "deadlettered", "errored", "successful", "last_error", "next_retry_at", "created_at", "updated_at")
+	// stateConditions are the conditions that select the retries in each state, see model.StatePending
+	stateConditions = map[string]string{
+		model.StatePending:      "successful = false AND deadlettered = false AND errored = false",
+		model.StateErrored:      "successful = false AND deadlettered = false AND errored = true",
+		model.StateDeadLettered: "successful = false AND deadlettered = true",
+		model.StateSuccessful:   "successful = true",
+	}
 )
 
 type Repository struct {
-	db *sql.DB
+	db      *sql.DB
+	dialect data.Dialect
+}
+
+// querier is satisfied by *sql.DB and *sql.Tx.
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
 }
 
-func NewRepository(db *sql.DB) Repository {
+// NewRepository returns a repository for the retries in db. Queries are written for Postgres,
+// and are rebound to the given dialect before they are run.
+func NewRepository(db *sql.DB, dialect data.Dialect) Repository {
 	return Repository{
-		db: db,
+		db:      db,
+		dialect: dialect,
 	}
 }
 
 func (r Repository) PublishFailure(ctx context.Context, f failuremodel.Failure) error {
-	q := `INSERT INTO kafka_consumer_retries(topic, payload_json, payload_headers, kafka_offset, kafka_partition, payload_key) VALUES($1, $2, $3, $4, $5, $6);`
-	_, err := r.db.ExecContext(ctx, q, f.Topic, f.Message, f.MessageHeaders, f.KafkaOffset, f.KafkaPartition, string(f.MessageKey))
+	q := `INSERT INTO kafka_consumer_retries(topic, payload_json, payload_headers, kafka_offset, kafka_partition, payload_key, last_error, errored, deadlettered, next_retry_at) VALUES($1, $2, $3, $4, $5, $6, $7, $8, $8, $9);`
+	_, err := r.exec(ctx, r.db, q, f.Topic, f.Message, f.MessageHeaders, f.KafkaOffset, f.KafkaPartition, string(f.MessageKey), f.Reason, f.Permanent, nextRetryAt(f.RetryAfter))
 	if err != nil {
 		return fmt.Errorf("data/retries: error publishing failure to the database: %w", err)
 	}
@@ -50,17 +75,26 @@ func (r Repository) GetMessagesForRetry(ctx context.Context, topic string, seque
 }
 
 func (r Repository) DeleteSuccessful(ctx context.Context, olderThan time.Time) error {
-	_, err := r.db.ExecContext(ctx, `DELETE FROM kafka_consumer_retries WHERE successful = true AND updated_at <= $1;`, olderThan)
+	_, err := r.exec(ctx, r.db, `DELETE FROM kafka_consumer_retries WHERE successful = true AND updated_at <= $1;`, olderThan)
 
 	return err
 }
 
+func (r Repository) DeleteRetry(ctx context.Context, retry model.Retry) error {
+	_, err := r.exec(ctx, r.db, `DELETE FROM kafka_consumer_retries WHERE id = $1;`, retry.ID)
+	if err != nil {
+		return fmt.Errorf("data/retries: error deleting a retry: %w", err)
+	}
+
+	return nil
+}
+
 func (r Repository) MarkRetrySuccessful(ctx context.Context, retry model.Retry) error {
 	q := `UPDATE kafka_consumer_retries
 		SET attempts = $1, last_error = '', retry_finished_at = NOW(), errored = false, successful = true, updated_at = NOW()
 		WHERE id = $2;`
 
-	_, err := r.db.ExecContext(ctx, q, retry.Attempts, retry.ID)
+	_, err := r.exec(ctx, r.db, q, retry.Attempts, retry.ID)
 	if err != nil {
 		return fmt.Errorf("data/retries: error marking a retry as successful: %w", err)
 	}
@@ -70,10 +104,11 @@ func (r Repository) MarkRetrySuccessful(ctx context.Context, retry model.Retry)
 
 func (r Repository) MarkRetryErrored(ctx context.Context, retry model.Retry, retryErr error) error {
 	q := `UPDATE kafka_consumer_retries
-		SET batch_id = NULL, attempts = $1, last_error = $2, retry_finished_at = NOW(), errored = $3, deadlettered = $4, updated_at = NOW()
-		WHERE id = $5;`
+		SET batch_id = NULL, attempts = $1, last_error = $2, retry_finished_at = NOW(), errored = $3, deadlettered = $4, next_retry_at = $5, updated_at = NOW()
+		WHERE id = $6;`
 
-	_, err := r.db.ExecContext(ctx, q, retry.Attempts, retryErr.Error(), retry.Errored, retry.Deadlettered, retry.ID)
+	next := sql.NullTime{Time: retry.NextRetryAt, Valid: !retry.NextRetryAt.IsZero()}
+	_, err := r.exec(ctx, r.db, q, retry.Attempts, retryErr.Error(), retry.Errored, retry.Deadlettered, next, retry.ID)
 	if err != nil {
 		return fmt.Errorf("data/retries: error marking a retry as errored: %w", err)
 	}
@@ -81,24 +116,353 @@ func (r Repository) MarkRetryErrored(ctx context.Context, retry model.Retry, ret
 	return nil
 }
 
+// RequeueDeadLettered resets the dead-lettered retries that match the filter, so that they go
+// through the retry chain again from the first retry, and records an audit entry for each of
+// them. It returns the number of retries that were requeued.
+func (r Repository) RequeueDeadLettered(ctx context.Context, filter model.DeadLetterFilter, actor string) (int64, error) {
+	return r.changeDeadLettered(ctx, filter, model.AuditActionRequeue, actor, func(tx *sql.Tx, in string, args []interface{}) error {
+		q := fmt.Sprintf(`UPDATE kafka_consumer_retries
+			SET batch_id = NULL, attempts = 1, errored = false, deadlettered = false, retry_started_at = NULL,
+				retry_finished_at = NULL, next_retry_at = $1, updated_at = NOW()
+			WHERE id IN (%s);`, in)
+
+		// #nosec G201
+		_, err := r.exec(ctx, tx, q, append([]interface{}{time.Now()}, args...)...)
+		return err
+	})
+}
+
+// PurgeDeadLettered deletes the dead-lettered retries that match the filter, and records an
+// audit entry for each of them. It returns the number of retries that were deleted.
+func (r Repository) PurgeDeadLettered(ctx context.Context, filter model.DeadLetterFilter, actor string) (int64, error) {
+	return r.changeDeadLettered(ctx, filter, model.AuditActionPurge, actor, func(tx *sql.Tx, in string, args []interface{}) error {
+		// #nosec G201
+		_, err := r.exec(ctx, tx, fmt.Sprintf(`DELETE FROM kafka_consumer_retries WHERE id IN (%s);`, in), args...)
+		return err
+	})
+}
+
+// changeDeadLettered locks the dead-lettered retries that match the filter, records an audit
+// entry for each of them, and then calls change with an IN clause for their IDs, whose
+// placeholders start at $2, all in a single transaction.
+func (r Repository) changeDeadLettered(ctx context.Context, filter model.DeadLetterFilter, action, actor string, change func(tx *sql.Tx, in string, args []interface{}) error) (int64, error) {
+	where, args := deadLetterFilterWhere(filter)
+	return r.changeRetries(ctx, where, args, action, actor, change)
+}
+
+// changeRetries locks the retries that match the where conditions, records an audit entry for
+// each of them, and then calls change with an IN clause for their IDs, whose placeholders start
+// at $2, all in a single transaction. The retries are changed in batches of changeBatchSize.
+func (r Repository) changeRetries(ctx context.Context, where string, whereArgs []interface{}, action, actor string, change func(tx *sql.Tx, in string, args []interface{}) error) (int64, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("data/retries: error starting transaction to %s retries: %w", action, err)
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	var changed, after int64
+	for {
+		ids, err := r.lockRetries(ctx, tx, where, whereArgs, after)
+		if err != nil {
+			return 0, fmt.Errorf("data/retries: error finding retries to %s: %w", action, err)
+		}
+		if len(ids) == 0 {
+			break
+		}
+
+		in, args := inClause(ids, 3)
+		auditSql := fmt.Sprintf(`INSERT INTO kafka_consumer_retries_audit(retry_id, topic, action, last_error, actor)
+			SELECT id, topic, $1, last_error, $2 FROM kafka_consumer_retries WHERE id IN (%s);`, in)
+
+		// #nosec G201
+		if _, err := r.exec(ctx, tx, auditSql, append([]interface{}{action, actor}, args...)...); err != nil {
+			return 0, fmt.Errorf("data/retries: error recording audit entries to %s retries: %w", action, err)
+		}
+
+		in, args = inClause(ids, 2)
+		if err := change(tx, in, args); err != nil {
+			return 0, fmt.Errorf("data/retries: error trying to %s retries: %w", action, err)
+		}
+
+		changed += int64(len(ids))
+		if len(ids) < changeBatchSize {
+			break
+		}
+		after = ids[len(ids)-1]
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("data/retries: error committing transaction to %s retries: %w", action, err)
+	}
+
+	return changed, nil
+}
+
+// lockRetries locks the next batch of retries that match the where conditions, whose IDs come
+// after the given ID, and returns their IDs in order.
+func (r Repository) lockRetries(ctx context.Context, tx *sql.Tx, where string, args []interface{}, after int64) ([]int64, error) {
+	q := fmt.Sprintf(`SELECT id FROM kafka_consumer_retries WHERE %s AND id > $%d ORDER BY id LIMIT %d FOR UPDATE;`, where, len(args)+1, changeBatchSize)
+
+	// #nosec G201
+	rows, err := r.query(ctx, tx, q, append(append([]interface{}{}, args...), after)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
+
+// RetryNow makes the retries that are waiting to be retried due straight away, instead of
+// after the interval of their retry sequence. They can be limited to a source topic, and to
+// the given IDs, and an audit entry is recorded for each of them. It returns the number of
+// retries that were changed.
+func (r Repository) RetryNow(ctx context.Context, topic string, ids []int64, actor string) (int64, error) {
+	conds := []string{"deadlettered = false", "successful = false"}
+	var args []interface{}
+	if topic != "" {
+		args = append(args, topic)
+		conds = append(conds, fmt.Sprintf("topic = $%d", len(args)))
+	}
+	if len(ids) > 0 {
+		in, idArgs := inClause(ids, len(args)+1)
+		args = append(args, idArgs...)
+		conds = append(conds, fmt.Sprintf("id IN (%s)", in))
+	}
+
+	return r.changeRetries(ctx, strings.Join(conds, " AND "), args, model.AuditActionRetryNow, actor, func(tx *sql.Tx, in string, args []interface{}) error {
+		// #nosec G201
+		_, err := r.exec(ctx, tx, fmt.Sprintf(`UPDATE kafka_consumer_retries SET next_retry_at = $1 WHERE id IN (%s);`, in), append([]interface{}{time.Now()}, args...)...)
+		return err
+	})
+}
+
+// ListRetries returns the retries that match the filter, ordered by ID.
+func (r Repository) ListRetries(ctx context.Context, filter model.ListFilter) ([]model.Retry, error) {
+	var conds []string
+	var args []interface{}
+	if filter.Topic != "" {
+		args = append(args, filter.Topic)
+		conds = append(conds, fmt.Sprintf("topic = $%d", len(args)))
+	}
+	if filter.State != "" {
+		cond, ok := stateConditions[filter.State]
+		if !ok {
+			return nil, fmt.Errorf("data/retries: unknown retry state '%s'", filter.State)
+		}
+		conds = append(conds, cond)
+	}
+	if filter.Attempts > 0 {
+		args = append(args, filter.Attempts)
+		conds = append(conds, fmt.Sprintf("attempts = $%d", len(args)))
+	}
+
+	q := fmt.Sprintf(`SELECT %s FROM kafka_consumer_retries`, strings.Join(detailColumns, ", "))
+	if len(conds) > 0 {
+		q += " WHERE " + strings.Join(conds, " AND ")
+	}
+	q += " ORDER BY id"
+	if filter.Limit > 0 {
+		args = append(args, filter.Limit)
+		q += fmt.Sprintf(" LIMIT $%d", len(args))
+	}
+
+	// #nosec G201
+	rows, err := r.query(ctx, r.db, q+";", args...)
+	if err != nil {
+		return nil, fmt.Errorf("data/retries: error listing retries: %w", err)
+	}
+	defer rows.Close()
+
+	var retries []model.Retry
+	for rows.Next() {
+		retry, err := scanRetryDetail(rows)
+		if err != nil {
+			return nil, fmt.Errorf("data/retries: error scanning result into memory: %w", err)
+		}
+		retries = append(retries, retry)
+	}
+
+	return retries, rows.Err()
+}
+
+// GetRetry returns the retry with the given ID. The error wraps sql.ErrNoRows if there is none.
+func (r Repository) GetRetry(ctx context.Context, id int64) (model.Retry, error) {
+	q := fmt.Sprintf(`SELECT %s FROM kafka_consumer_retries WHERE id = $1;`, strings.Join(detailColumns, ", "))
+
+	// #nosec G201
+	retry, err := scanRetryDetail(r.queryRow(ctx, r.db, q, id))
+	if err != nil {
+		return retry, fmt.Errorf("data/retries: error getting retry %d: %w", id, err)
+	}
+
+	return retry, nil
+}
+
+// Summary returns the number of retries in each state for every topic in the retry store,
+// ordered by topic.
+func (r Repository) Summary(ctx context.Context) ([]model.TopicSummary, error) {
+	q := fmt.Sprintf(`SELECT topic, %s FROM kafka_consumer_retries GROUP BY topic ORDER BY topic;`, stateCounts())
+
+	// #nosec G201
+	rows, err := r.query(ctx, r.db, q)
+	if err != nil {
+		return nil, fmt.Errorf("data/retries: error summarising retries: %w", err)
+	}
+	defer rows.Close()
+
+	var summaries []model.TopicSummary
+	for rows.Next() {
+		var s model.TopicSummary
+		if err := rows.Scan(&s.Topic, &s.Pending, &s.Errored, &s.DeadLettered, &s.Successful); err != nil {
+			return nil, fmt.Errorf("data/retries: error scanning result into memory: %w", err)
+		}
+		summaries = append(summaries, s)
+	}
+
+	return summaries, rows.Err()
+}
+
+// SequenceSummary counts the retries in each state for every topic and retry sequence, which
+// is the number of attempts that have been made.
+func (r Repository) SequenceSummary(ctx context.Context) ([]model.SequenceSummary, error) {
+	q := fmt.Sprintf(`SELECT topic, attempts, %s FROM kafka_consumer_retries GROUP BY topic, attempts ORDER BY topic, attempts;`, stateCounts())
+
+	// #nosec G201
+	rows, err := r.query(ctx, r.db, q)
+	if err != nil {
+		return nil, fmt.Errorf("data/retries: error summarising retries: %w", err)
+	}
+	defer rows.Close()
+
+	var summaries []model.SequenceSummary
+	for rows.Next() {
+		var s model.SequenceSummary
+		if err := rows.Scan(&s.Topic, &s.Sequence, &s.Pending, &s.Errored, &s.DeadLettered, &s.Successful); err != nil {
+			return nil, fmt.Errorf("data/retries: error scanning result into memory: %w", err)
+		}
+		summaries = append(summaries, s)
+	}
+
+	return summaries, rows.Err()
+}
+
+// stateCounts returns the columns that count the retries in each state, in the order pending,
+// errored, dead-lettered and successful.
+func stateCounts() string {
+	var counts []string
+	for _, state := range []string{model.StatePending, model.StateErrored, model.StateDeadLettered, model.StateSuccessful} {
+		counts = append(counts, fmt.Sprintf("SUM(CASE WHEN %s THEN 1 ELSE 0 END)", stateConditions[state]))
+	}
+	return strings.Join(counts, ", ")
+}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanRetryDetail(row scanner) (model.Retry, error) {
+	var retry model.Retry
+	var nextRetryAt, createdAt, updatedAt sql.NullTime
+	err := row.Scan(
+		&retry.ID, &retry.Topic, &retry.PayloadJSON, &retry.PayloadHeaders, &retry.PayloadKey, &retry.KafkaOffset,
+		&retry.KafkaPartition, &retry.Attempts, &retry.Deadlettered, &retry.Errored, &retry.Successful, &retry.LastError,
+		&nextRetryAt, &createdAt, &updatedAt,
+	)
+	retry.NextRetryAt = nextRetryAt.Time
+	retry.CreatedAt = createdAt.Time
+	retry.UpdatedAt = updatedAt.Time
+
+	return retry, err
+}
+
+// deadLetterFilterWhere returns the conditions of a WHERE clause, and their arguments, that
+// select the dead-lettered retries matching the filter.
+func deadLetterFilterWhere(f model.DeadLetterFilter) (string, []interface{}) {
+	conds := []string{"deadlettered = true"}
+	var args []interface{}
+	add := func(cond string, arg interface{}) {
+		args = append(args, arg)
+		conds = append(conds, fmt.Sprintf(cond, len(args)))
+	}
+
+	if f.Topic != "" {
+		add("topic = $%d", f.Topic)
+	}
+	if len(f.IDs) > 0 {
+		in, idArgs := inClause(f.IDs, len(args)+1)
+		args = append(args, idArgs...)
+		conds = append(conds, fmt.Sprintf("id IN (%s)", in))
+	}
+	if f.ErrorContains != "" {
+		add("last_error LIKE $%d", "%"+likeEscaper.Replace(f.ErrorContains)+"%")
+	}
+	if !f.CreatedFrom.IsZero() {
+		add("created_at >= $%d", f.CreatedFrom)
+	}
+	if !f.CreatedTo.IsZero() {
+		add("created_at <= $%d", f.CreatedTo)
+	}
+
+	return strings.Join(conds, " AND "), args
+}
+
+// inClause returns the placeholders for an IN clause with the given IDs, numbered from start,
+// along with the IDs as arguments.
+func inClause(ids []int64, start int) (string, []interface{}) {
+	placeholders := make([]string, len(ids))
+	args := make([]interface{}, len(ids))
+	for i, id := range ids {
+		placeholders[i] = fmt.Sprintf("$%d", start+i)
+		args[i] = id
+	}
+	return strings.Join(placeholders, ", "), args
+}
+
 func (r Repository) createEventBatch(ctx context.Context, topic string, sequence uint8, interval time.Duration) (uuid.UUID, error) {
 	batchId := uuid.New()
 	stale := time.Now().Add(consideredStaleAfter * -1)
-	before := time.Now().Add(interval * -1)
+	now := time.Now()
+	before := now.Add(interval * -1)
 
-	upSql := `UPDATE kafka_consumer_retries SET batch_id = $1, retry_started_at = NOW()
-		WHERE id IN(
-			SELECT id FROM kafka_consumer_retries
-			WHERE topic = $2
+	conds := `topic = $2
 			AND (
 				batch_id IS NULL OR
 				(batch_id IS NOT NULL AND retry_finished_at IS NULL AND retry_started_at < $3)
 			)
-			AND attempts = $4 AND deadlettered = false AND successful = false AND updated_at <= $5
+			AND attempts = $4 AND deadlettered = false AND successful = false
+			AND ((next_retry_at IS NULL AND updated_at <= $5) OR next_retry_at <= $6)`
+
+	// retries are claimed, and later processed, in the order they were created, so that retries
+	// of messages with the same key are handled in order
+	upSql := fmt.Sprintf(`UPDATE kafka_consumer_retries SET batch_id = $1, retry_started_at = NOW()
+		WHERE id IN(
+			SELECT id FROM kafka_consumer_retries
+			WHERE %s
+			ORDER BY id
 			LIMIT 250
-		);`
+		);`, conds)
+	if r.dialect == data.DialectMySQL {
+		// MySQL cannot update a table that is selected from in a subquery, or use LIMIT in
+		// an IN subquery, but it can limit the rows that are updated
+		upSql = fmt.Sprintf(`UPDATE kafka_consumer_retries SET batch_id = $1, retry_started_at = NOW()
+			WHERE %s
+			ORDER BY id LIMIT 250;`, conds)
+	}
 
-	_, err := r.db.ExecContext(ctx, upSql, batchId, topic, stale, sequence, before)
+	// #nosec G201
+	_, err := r.exec(ctx, r.db, upSql, batchId, topic, stale, sequence, before, now)
 	if err != nil {
 		return batchId, fmt.Errorf("data/retries: error updating retries records when creating a batch: %w", err)
 	}
@@ -107,10 +471,10 @@ func (r Repository) createEventBatch(ctx context.Context, topic string, sequence
 }
 
 func (r Repository) getCreatedEventBatch(ctx context.Context, batchId uuid.UUID) ([]model.Retry, error) {
-	q := fmt.Sprintf(`SELECT %s FROM kafka_consumer_retries WHERE batch_id = $1`, r.columnsAsString())
+	q := fmt.Sprintf(`SELECT %s FROM kafka_consumer_retries WHERE batch_id = $1 ORDER BY id`, r.columnsAsString())
 
 	// #nosec G201
-	rows, err := r.db.QueryContext(ctx, q, batchId)
+	rows, err := r.query(ctx, r.db, q, batchId)
 	if err != nil {
 		return nil, fmt.Errorf("data/retries: error getting messages for retry: %w", err)
 	}
@@ -129,6 +493,30 @@ func (r Repository) getCreatedEventBatch(ctx context.Context, batchId uuid.UUID)
 	return retries, nil
 }
 
+// nextRetryAt returns the time that a retry with the given delay is due, or NULL if it has no
+// delay, in which case the retry interval of its sequence is used.
+func nextRetryAt(delay time.Duration) sql.NullTime {
+	if delay <= 0 {
+		return sql.NullTime{}
+	}
+	return sql.NullTime{Time: time.Now().Add(delay), Valid: true}
+}
+
+func (r Repository) exec(ctx context.Context, q querier, query string, args ...interface{}) (sql.Result, error) {
+	query, args = r.dialect.Rebind(query, args)
+	return q.ExecContext(ctx, query, args...)
+}
+
+func (r Repository) query(ctx context.Context, q querier, query string, args ...interface{}) (*sql.Rows, error) {
+	query, args = r.dialect.Rebind(query, args)
+	return q.QueryContext(ctx, query, args...)
+}
+
+func (r Repository) queryRow(ctx context.Context, q querier, query string, args ...interface{}) *sql.Row {
+	query, args = r.dialect.Rebind(query, args)
+	return q.QueryRowContext(ctx, query, args...)
+}
+
 func (r Repository) columnsAsString() string {
 	return strings.Join(columns, ", ")
 }
@@ -2,6 +2,8 @@ package internal
 
 import (
 	"context"
+	"database/sql"
+	"database/sql/driver"
 	"errors"
 	"testing"
 	"time"
@@ -9,6 +11,7 @@ import (
 	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/go-test/deep"
 
+	"github.com/inviqa/kafka-consumer-go/data"
 	failuremodel "github.com/inviqa/kafka-consumer-go/data/failure/model"
 	"github.com/inviqa/kafka-consumer-go/data/retry/model"
 )
@@ -20,16 +23,16 @@ func TestNewRepository(t *testing.T) {
 	}()
 
 	db, _, _ := sqlmock.New()
-	exp := Repository{db: db}
+	exp := Repository{db: db, dialect: data.DialectPostgres}
 
-	if diff := deep.Equal(exp, NewRepository(db)); diff != nil {
+	if diff := deep.Equal(exp, NewRepository(db, data.DialectPostgres)); diff != nil {
 		t.Error(diff)
 	}
 }
 
 func TestRepository_PublishFailure(t *testing.T) {
 	db, mock, _ := sqlmock.New()
-	repo := NewRepository(db)
+	repo := NewRepository(db, data.DialectPostgres)
 	ctx := context.Background()
 	f := failuremodel.Failure{
 		Reason:         "something bad happened",
@@ -44,7 +47,7 @@ func TestRepository_PublishFailure(t *testing.T) {
 
 	t.Run("failure successfully published to DB", func(t *testing.T) {
 		mock.ExpectExec(`INSERT INTO kafka_consumer_retries.*`).
-			WithArgs("product", []byte(`{"foo":"bar"}`), []byte(`{"buzz":"bazz"}`), 200, 100, "SKU-123").
+			WithArgs("product", []byte(`{"foo":"bar"}`), []byte(`{"buzz":"bazz"}`), 200, 100, "SKU-123", "something bad happened", false, nil).
 			WillReturnResult(sqlmock.NewResult(1, 1))
 
 		if err := repo.PublishFailure(ctx, f); err != nil {
@@ -56,6 +59,40 @@ func TestRepository_PublishFailure(t *testing.T) {
 		}
 	})
 
+	t.Run("permanent failure is published to DB as dead-lettered", func(t *testing.T) {
+		pf := f
+		pf.Permanent = true
+
+		mock.ExpectExec(`INSERT INTO kafka_consumer_retries.*`).
+			WithArgs("product", []byte(`{"foo":"bar"}`), []byte(`{"buzz":"bazz"}`), 200, 100, "SKU-123", "something bad happened", true, nil).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+
+		if err := repo.PublishFailure(ctx, pf); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("failure with a requested delay is published to DB with its next retry time", func(t *testing.T) {
+		df := f
+		df.RetryAfter = time.Minute
+
+		mock.ExpectExec(`INSERT INTO kafka_consumer_retries.*`).
+			WithArgs("product", []byte(`{"foo":"bar"}`), []byte(`{"buzz":"bazz"}`), 200, 100, "SKU-123", "something bad happened", false, dueAfter(time.Minute)).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+
+		if err := repo.PublishFailure(ctx, df); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+
 	t.Run("error during insert", func(t *testing.T) {
 		mock.ExpectExec(`INSERT INTO kafka_consumer_retries.*`).
 			WillReturnError(errors.New("oops"))
@@ -72,7 +109,7 @@ func TestRepository_PublishFailure(t *testing.T) {
 
 func TestRepository_GetMessagesForRetry(t *testing.T) {
 	db, mock, _ := sqlmock.New()
-	repo := NewRepository(db)
+	repo := NewRepository(db, data.DialectPostgres)
 	ctx := context.Background()
 
 	t.Run("successfully fetches messages for retry", func(t *testing.T) {
@@ -80,11 +117,12 @@ func TestRepository_GetMessagesForRetry(t *testing.T) {
 			AddRow(1, "product", `{"foo":"bar"}`, `{"buzz":"bar"}`, "foo", 100, 200, 1).
 			AddRow(2, "product", `{"foo":"bazz"}`, "{}", "", 200, 300, 10)
 
-		mock.ExpectExec("UPDATE kafka_consumer_retries.*").
-			WithArgs(sqlmock.AnyArg(), "product", sqlmock.AnyArg(), 1, sqlmock.AnyArg()).
+		// retries are claimed and returned in ID order, so that retries with the same key are handled in order
+		mock.ExpectExec(`UPDATE kafka_consumer_retries.*WHERE id IN\(\s+SELECT id FROM kafka_consumer_retries\s+WHERE .*\s+ORDER BY id\s+LIMIT 250\s+\);`).
+			WithArgs(sqlmock.AnyArg(), "product", sqlmock.AnyArg(), 1, sqlmock.AnyArg(), sqlmock.AnyArg()).
 			WillReturnResult(sqlmock.NewResult(0, 250))
 
-		mock.ExpectQuery("SELECT .* FROM kafka_consumer_retries WHERE .*").
+		mock.ExpectQuery(`SELECT .* FROM kafka_consumer_retries WHERE batch_id = \$1 ORDER BY id`).
 			WithArgs(sqlmock.AnyArg()).
 			WillReturnRows(rows)
 
@@ -131,7 +169,7 @@ func TestRepository_GetMessagesForRetry(t *testing.T) {
 
 func TestRepository_DeleteSuccessful(t *testing.T) {
 	db, mock, _ := sqlmock.New()
-	repo := NewRepository(db)
+	repo := NewRepository(db, data.DialectPostgres)
 	ctx := context.Background()
 	now := time.Now()
 
@@ -163,14 +201,47 @@ func TestRepository_DeleteSuccessful(t *testing.T) {
 	})
 }
 
+func TestRepository_DeleteRetry(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	repo := NewRepository(db, data.DialectPostgres)
+	ctx := context.Background()
+
+	t.Run("deletes the retry", func(t *testing.T) {
+		mock.ExpectExec(`DELETE FROM kafka_consumer_retries WHERE id = \$1`).
+			WithArgs(10).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+
+		if err := repo.DeleteRetry(ctx, model.Retry{ID: 10}); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("returns error from query", func(t *testing.T) {
+		mock.ExpectExec(`DELETE FROM kafka_consumer_retries WHERE id = \$1`).
+			WillReturnError(errors.New("oops"))
+
+		if err := repo.DeleteRetry(ctx, model.Retry{ID: 10}); err == nil {
+			t.Error("expected an error but got nil")
+		}
+
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+}
+
 func TestRepository_MarkRetryErrored(t *testing.T) {
 	db, mock, _ := sqlmock.New()
-	repo := NewRepository(db)
+	repo := NewRepository(db, data.DialectPostgres)
 	ctx := context.Background()
 
 	t.Run("retry marked as errored successfully", func(t *testing.T) {
 		mock.ExpectExec("UPDATE kafka_consumer_retries SET .* WHERE .*").
-			WithArgs(2, "something bad", true, false, 10).
+			WithArgs(2, "something bad", true, false, nil, 10).
 			WillReturnResult(sqlmock.NewResult(1, 1))
 
 		retry := model.Retry{
@@ -190,7 +261,7 @@ func TestRepository_MarkRetryErrored(t *testing.T) {
 
 	t.Run("retry marked as deadlettered successfully", func(t *testing.T) {
 		mock.ExpectExec("UPDATE kafka_consumer_retries SET .* WHERE .*").
-			WithArgs(2, "something bad", true, true, 10).
+			WithArgs(2, "something bad", true, true, nil, 10).
 			WillReturnResult(sqlmock.NewResult(1, 1))
 
 		retry := model.Retry{
@@ -209,6 +280,27 @@ func TestRepository_MarkRetryErrored(t *testing.T) {
 		}
 	})
 
+	t.Run("retry marked as errored with the time that it is next due", func(t *testing.T) {
+		mock.ExpectExec("UPDATE kafka_consumer_retries SET .* WHERE .*").
+			WithArgs(2, "something bad", true, false, dueAfter(time.Second*30), 10).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+
+		retry := model.Retry{
+			ID:          10,
+			Attempts:    2,
+			Errored:     true,
+			NextRetryAt: time.Now().Add(time.Second * 30),
+		}
+
+		if err := repo.MarkRetryErrored(ctx, retry, errors.New("something bad")); err != nil {
+			t.Errorf("unexpected error: %s", err)
+		}
+
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("unexpected error: %s", err)
+		}
+	})
+
 	t.Run("error from database update is returned", func(t *testing.T) {
 		mock.ExpectExec("UPDATE kafka_consumer_retries SET .* WHERE .*").
 			WillReturnError(errors.New("oops"))
@@ -230,7 +322,7 @@ func TestRepository_MarkRetryErrored(t *testing.T) {
 
 func TestRepository_MarkRetrySuccessful(t *testing.T) {
 	db, mock, _ := sqlmock.New()
-	repo := NewRepository(db)
+	repo := NewRepository(db, data.DialectPostgres)
 	ctx := context.Background()
 
 	t.Run("retry marked as successful successfully", func(t *testing.T) {
@@ -295,3 +387,467 @@ func expectedRetriesForTests() []model.Retry {
 
 	return []model.Retry{retry1, retry2}
 }
+
+// dueAfter matches a next retry time that is d from now, allowing for the time taken by the test.
+type dueAfter time.Duration
+
+func (d dueAfter) Match(v driver.Value) bool {
+	due, ok := v.(time.Time)
+	if !ok {
+		return false
+	}
+	until := time.Until(due)
+	return until <= time.Duration(d) && until > time.Duration(d)-time.Second*5
+}
+
+func TestRepository_RequeueDeadLettered(t *testing.T) {
+	ctx := context.Background()
+	from := time.Date(2022, 6, 1, 0, 0, 0, 0, time.UTC)
+	filter := model.DeadLetterFilter{
+		Topic:         "product",
+		IDs:           []int64{4, 7},
+		ErrorContains: "100%_done",
+		CreatedFrom:   from,
+	}
+
+	t.Run("dead-lettered retries are requeued and audited", func(t *testing.T) {
+		db, mock, _ := sqlmock.New()
+		repo := NewRepository(db, data.DialectPostgres)
+
+		mock.ExpectBegin()
+		mock.ExpectQuery(`SELECT id FROM kafka_consumer_retries WHERE deadlettered = true AND topic = \$1 AND id IN \(\$2, \$3\) AND last_error LIKE \$4 AND created_at >= \$5 AND id > \$6 ORDER BY id LIMIT 1000 FOR UPDATE`).
+			WithArgs("product", int64(4), int64(7), `%100\%\_done%`, from, int64(0)).
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(4).AddRow(7))
+		mock.ExpectExec(`INSERT INTO kafka_consumer_retries_audit.* WHERE id IN \(\$3, \$4\)`).
+			WithArgs(model.AuditActionRequeue, "jane", int64(4), int64(7)).
+			WillReturnResult(sqlmock.NewResult(0, 2))
+		mock.ExpectExec(`UPDATE kafka_consumer_retries\s+SET .*attempts = 1.*deadlettered = false.* WHERE id IN \(\$2, \$3\)`).
+			WithArgs(sqlmock.AnyArg(), int64(4), int64(7)).
+			WillReturnResult(sqlmock.NewResult(0, 2))
+		mock.ExpectCommit()
+
+		got, err := repo.RequeueDeadLettered(ctx, filter, "jane")
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if got != 2 {
+			t.Errorf("expected 2 retries to be requeued, but got %d", got)
+		}
+
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("nothing is changed when no retries match", func(t *testing.T) {
+		db, mock, _ := sqlmock.New()
+		repo := NewRepository(db, data.DialectPostgres)
+
+		mock.ExpectBegin()
+		mock.ExpectQuery(`SELECT id FROM kafka_consumer_retries WHERE deadlettered = true AND id > \$1 ORDER BY id LIMIT 1000 FOR UPDATE`).
+			WithArgs(int64(0)).
+			WillReturnRows(sqlmock.NewRows([]string{"id"}))
+		mock.ExpectCommit()
+
+		got, err := repo.RequeueDeadLettered(ctx, model.DeadLetterFilter{}, "jane")
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if got != 0 {
+			t.Errorf("expected no retries to be requeued, but got %d", got)
+		}
+
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("retries are requeued in batches", func(t *testing.T) {
+		db, mock, _ := sqlmock.New()
+		repo := NewRepository(db, data.DialectPostgres)
+
+		firstBatch := sqlmock.NewRows([]string{"id"})
+		for id := 1; id <= changeBatchSize; id++ {
+			firstBatch.AddRow(id)
+		}
+
+		mock.ExpectBegin()
+		mock.ExpectQuery(`SELECT id FROM kafka_consumer_retries WHERE deadlettered = true AND id > \$1 .*`).
+			WithArgs(int64(0)).
+			WillReturnRows(firstBatch)
+		mock.ExpectExec(`INSERT INTO kafka_consumer_retries_audit.* WHERE id IN \(\$3, .*, \$1002\);`).
+			WillReturnResult(sqlmock.NewResult(0, changeBatchSize))
+		mock.ExpectExec(`UPDATE kafka_consumer_retries\s+SET .* WHERE id IN \(\$2, .*, \$1001\);`).
+			WillReturnResult(sqlmock.NewResult(0, changeBatchSize))
+		mock.ExpectQuery(`SELECT id FROM kafka_consumer_retries WHERE deadlettered = true AND id > \$1 .*`).
+			WithArgs(int64(changeBatchSize)).
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(changeBatchSize + 1))
+		mock.ExpectExec(`INSERT INTO kafka_consumer_retries_audit.*`).
+			WithArgs(model.AuditActionRequeue, "jane", int64(changeBatchSize+1)).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(`UPDATE kafka_consumer_retries\s+SET .* WHERE id IN \(\$2\);`).
+			WithArgs(sqlmock.AnyArg(), int64(changeBatchSize+1)).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+
+		got, err := repo.RequeueDeadLettered(ctx, model.DeadLetterFilter{}, "jane")
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if got != changeBatchSize+1 {
+			t.Errorf("expected %d retries to be requeued, but got %d", changeBatchSize+1, got)
+		}
+
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("the transaction is rolled back if the audit fails", func(t *testing.T) {
+		db, mock, _ := sqlmock.New()
+		repo := NewRepository(db, data.DialectPostgres)
+
+		mock.ExpectBegin()
+		mock.ExpectQuery(`SELECT id FROM kafka_consumer_retries WHERE .*`).
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(4))
+		mock.ExpectExec(`INSERT INTO kafka_consumer_retries_audit.*`).
+			WillReturnError(errors.New("oops"))
+		mock.ExpectRollback()
+
+		if _, err := repo.RequeueDeadLettered(ctx, filter, "jane"); err == nil {
+			t.Error("expected an error but got nil")
+		}
+
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+}
+
+func TestRepository_PurgeDeadLettered(t *testing.T) {
+	ctx := context.Background()
+	to := time.Date(2022, 6, 1, 0, 0, 0, 0, time.UTC)
+
+	t.Run("dead-lettered retries are deleted and audited", func(t *testing.T) {
+		db, mock, _ := sqlmock.New()
+		repo := NewRepository(db, data.DialectPostgres)
+
+		mock.ExpectBegin()
+		mock.ExpectQuery(`SELECT id FROM kafka_consumer_retries WHERE deadlettered = true AND created_at <= \$1 AND id > \$2 ORDER BY id LIMIT 1000 FOR UPDATE`).
+			WithArgs(to, int64(0)).
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(3))
+		mock.ExpectExec(`INSERT INTO kafka_consumer_retries_audit.*`).
+			WithArgs(model.AuditActionPurge, "jane", int64(3)).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(`DELETE FROM kafka_consumer_retries WHERE id IN \(\$2\)`).
+			WithArgs(int64(3)).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+
+		got, err := repo.PurgeDeadLettered(ctx, model.DeadLetterFilter{CreatedTo: to}, "jane")
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if got != 1 {
+			t.Errorf("expected 1 retry to be purged, but got %d", got)
+		}
+
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("the transaction is rolled back if the delete fails", func(t *testing.T) {
+		db, mock, _ := sqlmock.New()
+		repo := NewRepository(db, data.DialectPostgres)
+
+		mock.ExpectBegin()
+		mock.ExpectQuery(`SELECT id FROM kafka_consumer_retries WHERE .*`).
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(3))
+		mock.ExpectExec(`INSERT INTO kafka_consumer_retries_audit.*`).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(`DELETE FROM kafka_consumer_retries WHERE .*`).
+			WillReturnError(errors.New("oops"))
+		mock.ExpectRollback()
+
+		if _, err := repo.PurgeDeadLettered(ctx, model.DeadLetterFilter{}, "jane"); err == nil {
+			t.Error("expected an error but got nil")
+		}
+
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+}
+
+func TestRepository_RetryNow(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	repo := NewRepository(db, data.DialectPostgres)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT id FROM kafka_consumer_retries WHERE deadlettered = false AND successful = false AND topic = \$1 AND id IN \(\$2\) AND id > \$3 ORDER BY id LIMIT 1000 FOR UPDATE`).
+		WithArgs("product", int64(9), int64(0)).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(9))
+	mock.ExpectExec(`INSERT INTO kafka_consumer_retries_audit.*`).
+		WithArgs(model.AuditActionRetryNow, "jane", int64(9)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`UPDATE kafka_consumer_retries SET next_retry_at = \$1 WHERE id IN \(\$2\)`).
+		WithArgs(dueAfter(0), int64(9)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	got, err := repo.RetryNow(context.Background(), "product", []int64{9}, "jane")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if got != 1 {
+		t.Errorf("expected 1 retry to be changed, but got %d", got)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestRepository_ListRetries(t *testing.T) {
+	created := time.Date(2022, 6, 1, 12, 0, 0, 0, time.UTC)
+	rowsForTests := func() *sqlmock.Rows {
+		return sqlmock.NewRows(detailColumns).
+			AddRow(1, "product", `{"foo":"bar"}`, `{}`, "SKU-1", 100, 2, 2, false, true, false, "oops", nil, created, created)
+	}
+
+	t.Run("retries are listed with the filter", func(t *testing.T) {
+		db, mock, _ := sqlmock.New()
+		repo := NewRepository(db, data.DialectPostgres)
+
+		mock.ExpectQuery(`SELECT .* FROM kafka_consumer_retries WHERE topic = \$1 AND successful = false AND deadlettered = false AND errored = true AND attempts = \$2 ORDER BY id LIMIT \$3;`).
+			WithArgs("product", 2, 50).
+			WillReturnRows(rowsForTests())
+
+		got, err := repo.ListRetries(context.Background(), model.ListFilter{Topic: "product", State: model.StateErrored, Attempts: 2, Limit: 50})
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+
+		exp := []model.Retry{{
+			ID:             1,
+			Topic:          "product",
+			PayloadJSON:    []byte(`{"foo":"bar"}`),
+			PayloadHeaders: []byte(`{}`),
+			PayloadKey:     []byte("SKU-1"),
+			KafkaOffset:    100,
+			KafkaPartition: 2,
+			Attempts:       2,
+			Errored:        true,
+			LastError:      "oops",
+			CreatedAt:      created,
+			UpdatedAt:      created,
+		}}
+		if diff := deep.Equal(exp, got); diff != nil {
+			t.Error(diff)
+		}
+
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("all retries are listed without a filter", func(t *testing.T) {
+		db, mock, _ := sqlmock.New()
+		repo := NewRepository(db, data.DialectPostgres)
+
+		mock.ExpectQuery(`SELECT .* FROM kafka_consumer_retries ORDER BY id;`).
+			WillReturnRows(rowsForTests())
+
+		if _, err := repo.ListRetries(context.Background(), model.ListFilter{}); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("an unknown state is an error", func(t *testing.T) {
+		db, _, _ := sqlmock.New()
+		if _, err := NewRepository(db, data.DialectPostgres).ListRetries(context.Background(), model.ListFilter{State: "stuck"}); err == nil {
+			t.Error("expected an error but got nil")
+		}
+	})
+}
+
+func TestRepository_GetRetry(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	repo := NewRepository(db, data.DialectPostgres)
+
+	t.Run("the retry is returned", func(t *testing.T) {
+		mock.ExpectQuery(`SELECT .* FROM kafka_consumer_retries WHERE id = \$1;`).
+			WithArgs(1).
+			WillReturnRows(sqlmock.NewRows(detailColumns).
+				AddRow(1, "product", `{}`, `{}`, "", 100, 2, 1, true, true, false, "oops", nil, nil, nil))
+
+		got, err := repo.GetRetry(context.Background(), 1)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if got.ID != 1 || got.State() != model.StateDeadLettered {
+			t.Errorf("unexpected retry %+v", got)
+		}
+	})
+
+	t.Run("a missing retry is not found", func(t *testing.T) {
+		mock.ExpectQuery(`SELECT .* FROM kafka_consumer_retries WHERE id = \$1;`).
+			WithArgs(2).
+			WillReturnRows(sqlmock.NewRows(detailColumns))
+
+		if _, err := repo.GetRetry(context.Background(), 2); !errors.Is(err, sql.ErrNoRows) {
+			t.Errorf("expected a no rows error, but got %v", err)
+		}
+	})
+}
+
+func TestRepository_Summary(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	repo := NewRepository(db, data.DialectPostgres)
+
+	mock.ExpectQuery(`SELECT topic,.* FROM kafka_consumer_retries GROUP BY topic ORDER BY topic;`).
+		WillReturnRows(sqlmock.NewRows([]string{"topic", "pending", "errored", "deadlettered", "successful"}).
+			AddRow("payment", 0, 1, 0, 3).
+			AddRow("product", 2, 0, 5, 10))
+
+	got, err := repo.Summary(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	exp := []model.TopicSummary{
+		{Topic: "payment", Errored: 1, Successful: 3},
+		{Topic: "product", Pending: 2, DeadLettered: 5, Successful: 10},
+	}
+	if diff := deep.Equal(exp, got); diff != nil {
+		t.Error(diff)
+	}
+}
+
+func TestRepository_SequenceSummary(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	repo := NewRepository(db, data.DialectPostgres)
+
+	mock.ExpectQuery(`SELECT topic, attempts,.* FROM kafka_consumer_retries GROUP BY topic, attempts ORDER BY topic, attempts;`).
+		WillReturnRows(sqlmock.NewRows([]string{"topic", "attempts", "pending", "errored", "deadlettered", "successful"}).
+			AddRow("product", 1, 2, 0, 0, 4).
+			AddRow("product", 2, 0, 1, 3, 0))
+
+	got, err := repo.SequenceSummary(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	exp := []model.SequenceSummary{
+		{Topic: "product", Sequence: 1, Pending: 2, Successful: 4},
+		{Topic: "product", Sequence: 2, Errored: 1, DeadLettered: 3},
+	}
+	if diff := deep.Equal(exp, got); diff != nil {
+		t.Error(diff)
+	}
+}
+
+func TestRepository_MySQL(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("failures are published with positional placeholders", func(t *testing.T) {
+		db, mock, _ := sqlmock.New()
+		repo := NewRepository(db, data.DialectMySQL)
+
+		mock.ExpectExec(`INSERT INTO kafka_consumer_retries\(.*\) VALUES\(\?, \?, \?, \?, \?, \?, \?, \?, \?, \?\);`).
+			WithArgs("product", []byte(`{}`), []byte(`{}`), 200, 100, "SKU-123", "oops", true, true, nil).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+
+		err := repo.PublishFailure(ctx, failuremodel.Failure{
+			Reason:         "oops",
+			Topic:          "product",
+			Message:        []byte(`{}`),
+			MessageKey:     []byte(`SKU-123`),
+			MessageHeaders: []byte(`{}`),
+			KafkaPartition: 100,
+			KafkaOffset:    200,
+			Permanent:      true,
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("batches are created without a subquery", func(t *testing.T) {
+		db, mock, _ := sqlmock.New()
+		repo := NewRepository(db, data.DialectMySQL)
+
+		mock.ExpectExec(`UPDATE kafka_consumer_retries SET batch_id = \?, retry_started_at = NOW\(\)\s+WHERE topic = \? .* attempts = \? .*\s+ORDER BY id LIMIT 250;`).
+			WithArgs(sqlmock.AnyArg(), "product", sqlmock.AnyArg(), 1, sqlmock.AnyArg(), sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectQuery(`SELECT .* FROM kafka_consumer_retries WHERE batch_id = \? ORDER BY id`).
+			WillReturnRows(sqlmock.NewRows(columns).AddRow(1, "product", []byte(`{}`), []byte(`{}`), []byte(""), 1, 1, 1))
+
+		got, err := repo.GetMessagesForRetry(ctx, "product", 1, time.Second*10)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if len(got) != 1 {
+			t.Errorf("expected 1 retry, but got %d", len(got))
+		}
+
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("dead-lettered retries are requeued with positional placeholders", func(t *testing.T) {
+		db, mock, _ := sqlmock.New()
+		repo := NewRepository(db, data.DialectMySQL)
+
+		mock.ExpectBegin()
+		mock.ExpectQuery(`SELECT id FROM kafka_consumer_retries WHERE deadlettered = true AND topic = \? AND id IN \(\?, \?\) AND id > \? ORDER BY id LIMIT 1000 FOR UPDATE;`).
+			WithArgs("product", int64(1), int64(2), int64(0)).
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1).AddRow(2))
+		mock.ExpectExec(`INSERT INTO kafka_consumer_retries_audit.* SELECT id, topic, \?, last_error, \? .* WHERE id IN \(\?, \?\);`).
+			WithArgs(model.AuditActionRequeue, "jane", int64(1), int64(2)).
+			WillReturnResult(sqlmock.NewResult(0, 2))
+		mock.ExpectExec(`UPDATE kafka_consumer_retries\s+SET .*next_retry_at = \?.* WHERE id IN \(\?, \?\);`).
+			WithArgs(dueAfter(0), int64(1), int64(2)).
+			WillReturnResult(sqlmock.NewResult(0, 2))
+		mock.ExpectCommit()
+
+		got, err := repo.RequeueDeadLettered(ctx, model.DeadLetterFilter{Topic: "product", IDs: []int64{1, 2}}, "jane")
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if got != 2 {
+			t.Errorf("expected 2 retries to be requeued, but got %d", got)
+		}
+
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("retries are listed with positional placeholders", func(t *testing.T) {
+		db, mock, _ := sqlmock.New()
+		repo := NewRepository(db, data.DialectMySQL)
+
+		mock.ExpectQuery(`SELECT .* FROM kafka_consumer_retries WHERE topic = \? AND attempts = \? ORDER BY id LIMIT \?;`).
+			WithArgs("product", 2, 10).
+			WillReturnRows(sqlmock.NewRows(detailColumns))
+
+		if _, err := repo.ListRetries(ctx, model.ListFilter{Topic: "product", Attempts: 2, Limit: 10}); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+}
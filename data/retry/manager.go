@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/inviqa/kafka-consumer-go/config"
+	"github.com/inviqa/kafka-consumer-go/data"
 	failuremodel "github.com/inviqa/kafka-consumer-go/data/failure/model"
 	"github.com/inviqa/kafka-consumer-go/data/retry/internal"
 	"github.com/inviqa/kafka-consumer-go/data/retry/model"
@@ -26,12 +27,20 @@ type repository interface {
 	MarkRetryErrored(ctx context.Context, retry model.Retry, err error) error
 	PublishFailure(ctx context.Context, failure failuremodel.Failure) error
 	DeleteSuccessful(ctx context.Context, olderThan time.Time) error
+	DeleteRetry(ctx context.Context, retry model.Retry) error
+	RequeueDeadLettered(ctx context.Context, filter model.DeadLetterFilter, actor string) (int64, error)
+	PurgeDeadLettered(ctx context.Context, filter model.DeadLetterFilter, actor string) (int64, error)
+	RetryNow(ctx context.Context, topic string, ids []int64, actor string) (int64, error)
+	ListRetries(ctx context.Context, filter model.ListFilter) ([]model.Retry, error)
+	GetRetry(ctx context.Context, id int64) (model.Retry, error)
+	Summary(ctx context.Context) ([]model.TopicSummary, error)
+	SequenceSummary(ctx context.Context) ([]model.SequenceSummary, error)
 }
 
 func NewManagerWithDefaults(dbRetries config.DBRetries, db *sql.DB) *Manager {
 	return &Manager{
 		dbRetries: dbRetries,
-		repo:      internal.NewRepository(db),
+		repo:      internal.NewRepository(db, data.DialectOf(db)),
 	}
 }
 
@@ -43,11 +52,85 @@ func (m Manager) MarkSuccessful(ctx context.Context, retry model.Retry) error {
 	return m.repo.MarkRetrySuccessful(ctx, m.dbRetries.MakeRetrySuccessful(retry))
 }
 
+// MarkErrored records a failed retry attempt. The retry is marked as dead-lettered if it has
+// run out of attempts, or if err is a permanent failure (see failuremodel.PermanentError). It
+// is next retried after the delay requested by err (see failuremodel.RetryAfterError), if
+// there is one, or otherwise after the interval of its next retry sequence.
 func (m Manager) MarkErrored(ctx context.Context, retry model.Retry, err error) error {
-	return m.repo.MarkRetryErrored(ctx, m.dbRetries.MakeRetryErrored(retry), err)
+	retry = m.dbRetries.MakeRetryErrored(retry)
+	if failuremodel.IsPermanent(err) {
+		retry.Deadlettered = true
+	}
+
+	delay, ok := failuremodel.RetryDelay(err)
+	if !ok {
+		delay = m.dbRetries.NextRetryDelay(retry.Topic, retry.Attempts)
+	}
+	retry.NextRetryAt = time.Time{}
+	if delay > 0 {
+		retry.NextRetryAt = time.Now().Add(delay)
+	}
+
+	return m.repo.MarkRetryErrored(ctx, retry, err)
+}
+
+// Discard removes a retry that will not be attempted again, and should not be dead-lettered
+// because of its retry policy (see config.RetryPolicy).
+func (m Manager) Discard(ctx context.Context, retry model.Retry) error {
+	return m.repo.DeleteRetry(ctx, retry)
+}
+
+// RequeueDeadLettered resets the attempts and dead-letter flag of the dead-lettered retries that
+// match the filter, so that they are retried again from the first retry in the chain. Each
+// requeued retry is recorded in the audit table, along with the actor that requeued it. It
+// returns the number of retries that were requeued.
+func (m Manager) RequeueDeadLettered(ctx context.Context, filter model.DeadLetterFilter, actor string) (int64, error) {
+	return m.repo.RequeueDeadLettered(ctx, filter, actor)
+}
+
+// PurgeDeadLettered deletes the dead-lettered retries that match the filter. Each purged retry
+// is recorded in the audit table, along with the actor that purged it. It returns the number of
+// retries that were deleted.
+func (m Manager) PurgeDeadLettered(ctx context.Context, filter model.DeadLetterFilter, actor string) (int64, error) {
+	return m.repo.PurgeDeadLettered(ctx, filter, actor)
 }
 
+// RetryNow makes the retries that are waiting to be retried due straight away, rather than
+// after the interval of their retry sequence. They can be limited to a source topic, and to
+// the given IDs. Each changed retry is recorded in the audit table, along with the actor that
+// changed it. It returns the number of retries that were changed.
+func (m Manager) RetryNow(ctx context.Context, topic string, ids []int64, actor string) (int64, error) {
+	return m.repo.RetryNow(ctx, topic, ids, actor)
+}
+
+// List returns the retries that match the filter, ordered by ID.
+func (m Manager) List(ctx context.Context, filter model.ListFilter) ([]model.Retry, error) {
+	return m.repo.ListRetries(ctx, filter)
+}
+
+// Get returns the retry with the given ID. The error wraps sql.ErrNoRows if there is none.
+func (m Manager) Get(ctx context.Context, id int64) (model.Retry, error) {
+	return m.repo.GetRetry(ctx, id)
+}
+
+// Summary returns the number of retries in each state for every topic, ordered by topic.
+func (m Manager) Summary(ctx context.Context) ([]model.TopicSummary, error) {
+	return m.repo.Summary(ctx)
+}
+
+// SequenceSummary returns the number of retries in each state for every topic and retry
+// sequence, ordered by topic and then sequence.
+func (m Manager) SequenceSummary(ctx context.Context) ([]model.SequenceSummary, error) {
+	return m.repo.SequenceSummary(ctx)
+}
+
+// PublishFailure stores a failure to be retried, after the delay requested by the handler, if
+// there is one, or otherwise after the interval of the first retry sequence.
 func (m Manager) PublishFailure(ctx context.Context, failure failuremodel.Failure) error {
+	if failure.RetryAfter <= 0 {
+		// new retries have made one attempt, see the attempts column
+		failure.RetryAfter = m.dbRetries.NextRetryDelay(failure.Topic, 1)
+	}
 	return m.repo.PublishFailure(ctx, failure)
 }
 
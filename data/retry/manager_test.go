@@ -2,7 +2,9 @@ package retry
 
 import (
 	"context"
+	"database/sql"
 	"errors"
+	"fmt"
 	"testing"
 	"time"
 
@@ -10,6 +12,7 @@ import (
 	"github.com/go-test/deep"
 
 	"github.com/inviqa/kafka-consumer-go/config"
+	"github.com/inviqa/kafka-consumer-go/data"
 	failuremodel "github.com/inviqa/kafka-consumer-go/data/failure/model"
 	"github.com/inviqa/kafka-consumer-go/data/retry/internal"
 	"github.com/inviqa/kafka-consumer-go/data/retry/model"
@@ -21,7 +24,7 @@ func TestNewManagerWithDefaults(t *testing.T) {
 
 	exp := &Manager{
 		dbRetries: dbRetries,
-		repo:      internal.NewRepository(db),
+		repo:      internal.NewRepository(db, data.DialectPostgres),
 	}
 
 	got := NewManagerWithDefaults(dbRetries, db)
@@ -161,6 +164,64 @@ func TestManager_MarkErrored(t *testing.T) {
 		}
 	})
 
+	t.Run("marks retry deadlettered when the error is permanent", func(t *testing.T) {
+		manager, repo := newManagerForTests(false)
+		retry := model.Retry{
+			ID:    123,
+			Topic: "foo",
+		}
+		err := manager.MarkErrored(ctx, retry, fmt.Errorf("wrapped: %w", &failuremodel.PermanentError{Err: errors.New("foo")}))
+		if err != nil {
+			t.Errorf("unexpected error: %s", err)
+		}
+
+		expRetry := model.Retry{
+			ID:           123,
+			Topic:        "foo",
+			Errored:      true,
+			Deadlettered: true,
+			Attempts:     1,
+		}
+
+		if diff := deep.Equal(&expRetry, repo.RetryMarkedErrored); diff != nil {
+			t.Error(diff)
+		}
+	})
+
+	t.Run("marks retry errored with the delay requested by the handler", func(t *testing.T) {
+		manager, repo := newManagerForTests(false)
+		retry := model.Retry{
+			ID:    123,
+			Topic: "foo",
+		}
+		err := manager.MarkErrored(ctx, retry, &failuremodel.RetryAfterError{Err: errors.New("foo"), Delay: time.Minute})
+		if err != nil {
+			t.Errorf("unexpected error: %s", err)
+		}
+
+		if until := time.Until(repo.RetryMarkedErrored.NextRetryAt); until <= time.Second*55 || until > time.Minute {
+			t.Errorf("expected the retry to be due in 1m, but it is due in %s", until)
+		}
+	})
+
+	t.Run("marks retry errored with a jittered delay", func(t *testing.T) {
+		manager, repo := newManagerForTests(false)
+		manager.dbRetries["foo"][1].Jitter = 0.5
+		retry := model.Retry{
+			ID:       123,
+			Topic:    "foo",
+			Attempts: 1,
+		}
+		err := manager.MarkErrored(ctx, retry, errors.New("foo"))
+		if err != nil {
+			t.Errorf("unexpected error: %s", err)
+		}
+
+		if until := time.Until(repo.RetryMarkedErrored.NextRetryAt); until <= 0 || until > time.Second*3 {
+			t.Errorf("expected the retry to be due within 1s to 3s, but it is due in %s", until)
+		}
+	})
+
 	t.Run("returns error from repository", func(t *testing.T) {
 		manager, _ := newManagerForTests(true)
 
@@ -189,6 +250,32 @@ func TestManager_PublishFailure(t *testing.T) {
 		}
 	})
 
+	t.Run("publishes failure with a jittered delay", func(t *testing.T) {
+		manager, repo := newManagerForTests(false)
+		manager.dbRetries["foo"][0].Jitter = 0.5
+
+		if err := manager.PublishFailure(ctx, failuremodel.Failure{Topic: "foo"}); err != nil {
+			t.Errorf("unexpected error: %s", err)
+		}
+
+		if got := repo.PublishedFailure.RetryAfter; got < time.Millisecond*500 || got > time.Millisecond*1500 {
+			t.Errorf("expected the failure to be retried after 0.5s to 1.5s, but got %s", got)
+		}
+	})
+
+	t.Run("publishes failure with the delay requested by the handler", func(t *testing.T) {
+		manager, repo := newManagerForTests(false)
+		manager.dbRetries["foo"][0].Jitter = 0.5
+
+		if err := manager.PublishFailure(ctx, failuremodel.Failure{Topic: "foo", RetryAfter: time.Minute}); err != nil {
+			t.Errorf("unexpected error: %s", err)
+		}
+
+		if got := repo.PublishedFailure.RetryAfter; got != time.Minute {
+			t.Errorf("expected the failure to be retried after 1m, but got %s", got)
+		}
+	})
+
 	t.Run("returns error from repository", func(t *testing.T) {
 		manager, _ := newManagerForTests(true)
 
@@ -198,6 +285,217 @@ func TestManager_PublishFailure(t *testing.T) {
 	})
 }
 
+func TestManager_Discard(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("deletes the retry", func(t *testing.T) {
+		manager, repo := newManagerForTests(false)
+		r := model.Retry{ID: 10, Topic: "product"}
+
+		if err := manager.Discard(ctx, r); err != nil {
+			t.Errorf("unexpected error: %s", err)
+		}
+
+		if diff := deep.Equal(&r, repo.RetryDeleted); diff != nil {
+			t.Error(diff)
+		}
+	})
+
+	t.Run("returns error from repository", func(t *testing.T) {
+		manager, _ := newManagerForTests(true)
+
+		if err := manager.Discard(ctx, model.Retry{}); err == nil {
+			t.Error("expected an error but got nil")
+		}
+	})
+}
+
+func TestManager_RequeueDeadLettered(t *testing.T) {
+	ctx := context.Background()
+	filter := model.DeadLetterFilter{Topic: "product", IDs: []int64{1, 2}}
+
+	t.Run("requeues the dead-lettered retries", func(t *testing.T) {
+		manager, repo := newManagerForTests(false)
+
+		got, err := manager.RequeueDeadLettered(ctx, filter, "jane")
+		if err != nil {
+			t.Errorf("unexpected error: %s", err)
+		}
+
+		if got != 2 {
+			t.Errorf("expected 2 retries to be requeued, but got %d", got)
+		}
+		if diff := deep.Equal(&filter, repo.DeadLetterFilter); diff != nil {
+			t.Error(diff)
+		}
+		if repo.DeadLetterAction != model.AuditActionRequeue || repo.DeadLetterActor != "jane" {
+			t.Errorf("unexpected action '%s' by '%s'", repo.DeadLetterAction, repo.DeadLetterActor)
+		}
+	})
+
+	t.Run("returns error from repository", func(t *testing.T) {
+		manager, _ := newManagerForTests(true)
+
+		if _, err := manager.RequeueDeadLettered(ctx, filter, "jane"); err == nil {
+			t.Error("expected an error but got nil")
+		}
+	})
+}
+
+func TestManager_PurgeDeadLettered(t *testing.T) {
+	ctx := context.Background()
+	filter := model.DeadLetterFilter{ErrorContains: "timeout"}
+
+	t.Run("purges the dead-lettered retries", func(t *testing.T) {
+		manager, repo := newManagerForTests(false)
+
+		if _, err := manager.PurgeDeadLettered(ctx, filter, "jane"); err != nil {
+			t.Errorf("unexpected error: %s", err)
+		}
+
+		if diff := deep.Equal(&filter, repo.DeadLetterFilter); diff != nil {
+			t.Error(diff)
+		}
+		if repo.DeadLetterAction != model.AuditActionPurge || repo.DeadLetterActor != "jane" {
+			t.Errorf("unexpected action '%s' by '%s'", repo.DeadLetterAction, repo.DeadLetterActor)
+		}
+	})
+
+	t.Run("returns error from repository", func(t *testing.T) {
+		manager, _ := newManagerForTests(true)
+
+		if _, err := manager.PurgeDeadLettered(ctx, filter, "jane"); err == nil {
+			t.Error("expected an error but got nil")
+		}
+	})
+}
+
+func TestManager_RetryNow(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("makes the retries due", func(t *testing.T) {
+		manager, repo := newManagerForTests(false)
+
+		got, err := manager.RetryNow(ctx, "product", []int64{3, 4}, "jane")
+		if err != nil {
+			t.Errorf("unexpected error: %s", err)
+		}
+
+		if got != 2 || repo.RetryNowTopic != "product" {
+			t.Errorf("unexpected retry now of %d retries from '%s'", got, repo.RetryNowTopic)
+		}
+		if diff := deep.Equal([]int64{3, 4}, repo.RetryNowIDs); diff != nil {
+			t.Error(diff)
+		}
+	})
+
+	t.Run("returns error from repository", func(t *testing.T) {
+		manager, _ := newManagerForTests(true)
+
+		if _, err := manager.RetryNow(ctx, "", nil, "jane"); err == nil {
+			t.Error("expected an error but got nil")
+		}
+	})
+}
+
+func TestManager_List(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("returns retries from repository", func(t *testing.T) {
+		manager, repo := newManagerForTests(false)
+		repo.retriesToReturn = []model.Retry{{ID: 1, Topic: "product"}}
+		filter := model.ListFilter{Topic: "product", State: model.StateErrored, Limit: 10}
+
+		got, err := manager.List(ctx, filter)
+		if err != nil {
+			t.Errorf("unexpected error: %s", err)
+		}
+
+		if diff := deep.Equal(repo.retriesToReturn, got); diff != nil {
+			t.Error(diff)
+		}
+		if diff := deep.Equal(&filter, repo.ListFilter); diff != nil {
+			t.Error(diff)
+		}
+	})
+
+	t.Run("returns error from repository", func(t *testing.T) {
+		manager, _ := newManagerForTests(true)
+
+		if _, err := manager.List(ctx, model.ListFilter{}); err == nil {
+			t.Error("expected an error but got nil")
+		}
+	})
+}
+
+func TestManager_Get(t *testing.T) {
+	ctx := context.Background()
+	manager, repo := newManagerForTests(false)
+	repo.retriesToReturn = []model.Retry{{ID: 1, Topic: "product"}}
+
+	got, err := manager.Get(ctx, 1)
+	if err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+	if diff := deep.Equal(repo.retriesToReturn[0], got); diff != nil {
+		t.Error(diff)
+	}
+
+	if _, err := manager.Get(ctx, 2); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("expected a no rows error, but got %v", err)
+	}
+}
+
+func TestManager_Summary(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("returns summary from repository", func(t *testing.T) {
+		manager, repo := newManagerForTests(false)
+		repo.summariesToReturn = []model.TopicSummary{{Topic: "product", Pending: 1, DeadLettered: 2}}
+
+		got, err := manager.Summary(ctx)
+		if err != nil {
+			t.Errorf("unexpected error: %s", err)
+		}
+		if diff := deep.Equal(repo.summariesToReturn, got); diff != nil {
+			t.Error(diff)
+		}
+	})
+
+	t.Run("returns error from repository", func(t *testing.T) {
+		manager, _ := newManagerForTests(true)
+
+		if _, err := manager.Summary(ctx); err == nil {
+			t.Error("expected an error but got nil")
+		}
+	})
+}
+
+func TestManager_SequenceSummary(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("returns summary from repository", func(t *testing.T) {
+		manager, repo := newManagerForTests(false)
+		repo.sequencesToReturn = []model.SequenceSummary{{Topic: "product", Sequence: 1, Errored: 2}}
+
+		got, err := manager.SequenceSummary(ctx)
+		if err != nil {
+			t.Errorf("unexpected error: %s", err)
+		}
+		if diff := deep.Equal(repo.sequencesToReturn, got); diff != nil {
+			t.Error(diff)
+		}
+	})
+
+	t.Run("returns error from repository", func(t *testing.T) {
+		manager, _ := newManagerForTests(true)
+
+		if _, err := manager.SequenceSummary(ctx); err == nil {
+			t.Error("expected an error but got nil")
+		}
+	})
+}
+
 func TestManager_RunMaintenance(t *testing.T) {
 	ctx := context.Background()
 	now := time.Now()
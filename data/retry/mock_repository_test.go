@@ -2,6 +2,7 @@ package retry
 
 import (
 	"context"
+	"database/sql"
 	"errors"
 	"time"
 
@@ -12,6 +13,15 @@ import (
 type mockRepository struct {
 	RetryMarkedSuccessful *model.Retry
 	RetryMarkedErrored    *model.Retry
+	RetryDeleted          *model.Retry
+	DeadLetterFilter      *model.DeadLetterFilter
+	DeadLetterAction      string
+	DeadLetterActor       string
+	RetryNowTopic         string
+	RetryNowIDs           []int64
+	ListFilter            *model.ListFilter
+	summariesToReturn     []model.TopicSummary
+	sequencesToReturn     []model.SequenceSummary
 	PublishedFailure      *failuremodel.Failure
 	retriesToReturn       []model.Retry
 	willError             bool
@@ -60,3 +70,72 @@ func (m *mockRepository) DeleteSuccessful(ctx context.Context, olderThan time.Ti
 	m.receivedOlderThan = olderThan
 	return nil
 }
+
+func (m *mockRepository) DeleteRetry(ctx context.Context, retry model.Retry) error {
+	if m.willError {
+		return errors.New("oops")
+	}
+	m.RetryDeleted = &retry
+	return nil
+}
+
+func (m *mockRepository) RequeueDeadLettered(ctx context.Context, filter model.DeadLetterFilter, actor string) (int64, error) {
+	return m.changeDeadLettered(filter, model.AuditActionRequeue, actor)
+}
+
+func (m *mockRepository) PurgeDeadLettered(ctx context.Context, filter model.DeadLetterFilter, actor string) (int64, error) {
+	return m.changeDeadLettered(filter, model.AuditActionPurge, actor)
+}
+
+func (m *mockRepository) changeDeadLettered(filter model.DeadLetterFilter, action, actor string) (int64, error) {
+	if m.willError {
+		return 0, errors.New("oops")
+	}
+	m.DeadLetterFilter = &filter
+	m.DeadLetterAction = action
+	m.DeadLetterActor = actor
+	return int64(len(filter.IDs)), nil
+}
+
+func (m *mockRepository) RetryNow(ctx context.Context, topic string, ids []int64, actor string) (int64, error) {
+	if m.willError {
+		return 0, errors.New("oops")
+	}
+	m.RetryNowTopic = topic
+	m.RetryNowIDs = ids
+	return int64(len(ids)), nil
+}
+
+func (m *mockRepository) ListRetries(ctx context.Context, filter model.ListFilter) ([]model.Retry, error) {
+	if m.willError {
+		return nil, errors.New("oops")
+	}
+	m.ListFilter = &filter
+	return m.retriesToReturn, nil
+}
+
+func (m *mockRepository) GetRetry(ctx context.Context, id int64) (model.Retry, error) {
+	if m.willError {
+		return model.Retry{}, errors.New("oops")
+	}
+	for _, r := range m.retriesToReturn {
+		if r.ID == id {
+			return r, nil
+		}
+	}
+	return model.Retry{}, sql.ErrNoRows
+}
+
+func (m *mockRepository) Summary(ctx context.Context) ([]model.TopicSummary, error) {
+	if m.willError {
+		return nil, errors.New("oops")
+	}
+	return m.summariesToReturn, nil
+}
+
+func (m *mockRepository) SequenceSummary(ctx context.Context) ([]model.SequenceSummary, error) {
+	if m.willError {
+		return nil, errors.New("oops")
+	}
+	return m.sequencesToReturn, nil
+}
@@ -0,0 +1,55 @@
+package model
+
+// States of a retry in the retry chain.
+const (
+	// StatePending is a retry that has not been attempted yet.
+	StatePending = "pending"
+	// StateErrored is a retry that has failed at least once, and will be attempted again.
+	StateErrored = "errored"
+	// StateDeadLettered is a retry that will not be attempted again.
+	StateDeadLettered = "deadlettered"
+	// StateSuccessful is a retry that has been processed successfully.
+	StateSuccessful = "successful"
+)
+
+// IsValidState returns whether state is one of the states of a retry, see StatePending.
+func IsValidState(state string) bool {
+	switch state {
+	case StatePending, StateErrored, StateDeadLettered, StateSuccessful:
+		return true
+	default:
+		return false
+	}
+}
+
+// ListFilter selects the retries to list. A retry must match all of the fields that are set.
+type ListFilter struct {
+	// Topic limits the retries to those from this source topic.
+	Topic string
+	// State limits the retries to those in this state, see StatePending.
+	State string
+	// Attempts limits the retries to those with this number of attempts.
+	Attempts uint8
+	// Limit is the maximum number of retries to return, all are returned if it is 0.
+	Limit int
+}
+
+// TopicSummary counts the retries from a source topic in each state.
+type TopicSummary struct {
+	Topic        string `json:"topic"`
+	Pending      int    `json:"pending"`
+	Errored      int    `json:"errored"`
+	DeadLettered int    `json:"deadlettered"`
+	Successful   int    `json:"successful"`
+}
+
+// SequenceSummary counts the retries from a source topic in each state, at a retry sequence.
+// The sequence is the number of attempts that have been made to process the retries.
+type SequenceSummary struct {
+	Topic        string `json:"topic"`
+	Sequence     uint8  `json:"sequence"`
+	Pending      int    `json:"pending"`
+	Errored      int    `json:"errored"`
+	DeadLettered int    `json:"deadlettered"`
+	Successful   int    `json:"successful"`
+}
@@ -0,0 +1,31 @@
+package model
+
+import "time"
+
+// Actions recorded in the audit table when retries are changed.
+const (
+	AuditActionRequeue  = "requeue"
+	AuditActionPurge    = "purge"
+	AuditActionRetryNow = "retry_now"
+)
+
+// DeadLetterFilter selects the dead-lettered retries to requeue or purge. A retry must match
+// all of the fields that are set, and the zero value matches every dead-lettered retry.
+type DeadLetterFilter struct {
+	// Topic limits the retries to those from this source topic.
+	Topic string
+	// IDs limits the retries to those with these IDs.
+	IDs []int64
+	// ErrorContains limits the retries to those whose last error contains this text.
+	ErrorContains string
+	// CreatedFrom and CreatedTo limit the retries to those created in this time range. Either
+	// may be zero for an open-ended range.
+	CreatedFrom time.Time
+	CreatedTo   time.Time
+}
+
+// IsEmpty reports whether none of the fields of the filter are set, in which case it matches
+// every dead-lettered retry.
+func (f DeadLetterFilter) IsEmpty() bool {
+	return f.Topic == "" && len(f.IDs) == 0 && f.ErrorContains == "" && f.CreatedFrom.IsZero() && f.CreatedTo.IsZero()
+}
@@ -0,0 +1,30 @@
+package model
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDeadLetterFilter_IsEmpty(t *testing.T) {
+	tests := []struct {
+		name   string
+		filter DeadLetterFilter
+		want   bool
+	}{
+		{"zero value", DeadLetterFilter{}, true},
+		{"empty IDs", DeadLetterFilter{IDs: []int64{}}, true},
+		{"topic", DeadLetterFilter{Topic: "product"}, false},
+		{"IDs", DeadLetterFilter{IDs: []int64{1}}, false},
+		{"error contains", DeadLetterFilter{ErrorContains: "timeout"}, false},
+		{"created from", DeadLetterFilter{CreatedFrom: time.Date(2022, 6, 1, 0, 0, 0, 0, time.UTC)}, false},
+		{"created to", DeadLetterFilter{CreatedTo: time.Date(2022, 6, 1, 0, 0, 0, 0, time.UTC)}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.filter.IsEmpty(); got != tt.want {
+				t.Errorf("expected %v, but got %v", tt.want, got)
+			}
+		})
+	}
+}
@@ -2,6 +2,7 @@ package model
 
 import (
 	"encoding/json"
+	"time"
 
 	"github.com/Shopify/sarama"
 )
@@ -17,6 +18,27 @@ type Retry struct {
 	Attempts       uint8
 	Deadlettered   bool
 	Errored        bool
+	Successful     bool
+	LastError      string
+	// NextRetryAt is the time that the retry is due, or zero if it is due once the interval of its
+	// retry sequence has elapsed
+	NextRetryAt time.Time
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+// State returns the state of the retry in the retry chain, see StatePending.
+func (r Retry) State() string {
+	switch {
+	case r.Successful:
+		return StateSuccessful
+	case r.Deadlettered:
+		return StateDeadLettered
+	case r.Errored:
+		return StateErrored
+	default:
+		return StatePending
+	}
 }
 
 type recordHeaders map[string]string
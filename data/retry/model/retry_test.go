@@ -72,3 +72,33 @@ func TestRetry_ToSaramaConsumerMessage(t *testing.T) {
 		}
 	})
 }
+
+func TestRetry_State(t *testing.T) {
+	tests := []struct {
+		retry Retry
+		want  string
+	}{
+		{retry: Retry{}, want: StatePending},
+		{retry: Retry{Errored: true}, want: StateErrored},
+		{retry: Retry{Errored: true, Deadlettered: true}, want: StateDeadLettered},
+		{retry: Retry{Successful: true}, want: StateSuccessful},
+	}
+
+	for _, tt := range tests {
+		if got := tt.retry.State(); got != tt.want {
+			t.Errorf("expected state '%s' for %+v, but got '%s'", tt.want, tt.retry, got)
+		}
+	}
+}
+
+func TestIsValidState(t *testing.T) {
+	for _, state := range []string{StatePending, StateErrored, StateDeadLettered, StateSuccessful} {
+		if !IsValidState(state) {
+			t.Errorf("expected '%s' to be a valid state", state)
+		}
+	}
+
+	if IsValidState("stuck") {
+		t.Error("expected 'stuck' to not be a valid state")
+	}
+}
@@ -0,0 +1,63 @@
+package model
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// View is a retry as it is shown to operators, e.g. by the admin CLI and API, with its key
+// decoded and its state resolved.
+type View struct {
+	ID          int64             `json:"id"`
+	Topic       string            `json:"topic"`
+	Key         string            `json:"key"`
+	Partition   int32             `json:"partition"`
+	Offset      int64             `json:"offset"`
+	Attempts    uint8             `json:"attempts"`
+	State       string            `json:"state"`
+	LastError   string            `json:"last_error"`
+	NextRetryAt *time.Time        `json:"next_retry_at,omitempty"`
+	CreatedAt   time.Time         `json:"created_at"`
+	UpdatedAt   time.Time         `json:"updated_at"`
+	Headers     map[string]string `json:"headers,omitempty"`
+	Payload     interface{}       `json:"payload,omitempty"`
+}
+
+// NewView returns the view of r, without its headers and payload.
+func NewView(r Retry) View {
+	v := View{
+		ID:        r.ID,
+		Topic:     r.Topic,
+		Key:       string(r.PayloadKey),
+		Partition: r.KafkaPartition,
+		Offset:    r.KafkaOffset,
+		Attempts:  r.Attempts,
+		State:     r.State(),
+		LastError: r.LastError,
+		CreatedAt: r.CreatedAt,
+		UpdatedAt: r.UpdatedAt,
+	}
+	if !r.NextRetryAt.IsZero() {
+		v.NextRetryAt = &r.NextRetryAt
+	}
+	return v
+}
+
+// NewDetailedView returns the view of r with its headers and payload. The payload is kept as
+// JSON when it is valid JSON, so that it is nested when the view is encoded as JSON, and as a
+// string otherwise.
+func NewDetailedView(r Retry) View {
+	v := NewView(r)
+
+	v.Headers = map[string]string{}
+	for _, h := range r.ToSaramaConsumerMessage().Headers {
+		v.Headers[string(h.Key)] = string(h.Value)
+	}
+
+	v.Payload = string(r.PayloadJSON)
+	if json.Valid(r.PayloadJSON) {
+		v.Payload = json.RawMessage(r.PayloadJSON)
+	}
+
+	return v
+}
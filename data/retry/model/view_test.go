@@ -0,0 +1,58 @@
+package model
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/go-test/deep"
+)
+
+func TestNewView(t *testing.T) {
+	next := time.Date(2022, 6, 1, 12, 0, 0, 0, time.UTC)
+	retry := Retry{
+		ID:             10,
+		Topic:          "product",
+		PayloadJSON:    []byte(`{"foo":"bar"}`),
+		PayloadHeaders: []byte(`{"baz":"buzz"}`),
+		PayloadKey:     []byte("foo"),
+		Attempts:       2,
+		Errored:        true,
+		NextRetryAt:    next,
+	}
+
+	t.Run("without headers and payload", func(t *testing.T) {
+		exp := View{
+			ID:          10,
+			Topic:       "product",
+			Key:         "foo",
+			Attempts:    2,
+			State:       StateErrored,
+			NextRetryAt: &next,
+		}
+
+		if diff := deep.Equal(exp, NewView(retry)); diff != nil {
+			t.Error(diff)
+		}
+	})
+
+	t.Run("with headers and a JSON payload", func(t *testing.T) {
+		got := NewDetailedView(retry)
+
+		if diff := deep.Equal(map[string]string{"baz": "buzz"}, got.Headers); diff != nil {
+			t.Error(diff)
+		}
+		if diff := deep.Equal(json.RawMessage(`{"foo":"bar"}`), got.Payload); diff != nil {
+			t.Error(diff)
+		}
+	})
+
+	t.Run("with a payload that is not JSON", func(t *testing.T) {
+		r := retry
+		r.PayloadJSON = []byte("not json")
+
+		if got := NewDetailedView(r).Payload; got != "not json" {
+			t.Errorf("expected the payload as a string, but got %v", got)
+		}
+	})
+}
@@ -4,42 +4,69 @@ import (
 	"context"
 	"sync"
 
+	"github.com/inviqa/kafka-consumer-go/config"
 	"github.com/inviqa/kafka-consumer-go/data/failure/model"
 	"github.com/inviqa/kafka-consumer-go/log"
+	"github.com/inviqa/kafka-consumer-go/prometheus"
 )
 
 // databaseProducer is a producer that listens for failed push attempts to kafka
 // sent on fch and then sends them to the database for retry later
 type databaseProducer struct {
+	cfg          *config.Config
 	retryManager retryManager
 	fch          <-chan model.Failure
-	logger       log.Logger
+	logger       log.StructuredLogger
+
+	// optional fields managed by setters
+	status *statusTracker
 }
 
-func newDatabaseProducer(rm retryManager, fch <-chan model.Failure, logger log.Logger) *databaseProducer {
+func newDatabaseProducer(cfg *config.Config, rm retryManager, fch <-chan model.Failure, logger log.StructuredLogger) *databaseProducer {
 	return &databaseProducer{
+		cfg:          cfg,
 		retryManager: rm,
 		fch:          fch,
 		logger:       logger,
+		status:       newStatusTracker(),
 	}
 }
 
+func (d *databaseProducer) setStatusTracker(s *statusTracker) {
+	d.status = s
+}
+
 func (d databaseProducer) listenForFailures(ctx context.Context, wg *sync.WaitGroup) {
-	d.logger.Info("starting database retry producer")
+	log.Info(d.logger, "starting database retry producer")
 
 	wg.Add(1)
+	d.status.setFailureProducerRunning(true)
 	go func() {
 		defer wg.Done()
+		defer d.status.setFailureProducerRunning(false)
 
 		for {
 			select {
 			case f := <-d.fch:
-				if err := d.retryManager.PublishFailure(context.Background(), f); err != nil {
-					d.logger.Errorf("error publishing a failure to database for retry: %s", err)
-				}
+				d.publishFailure(f)
 			case <-ctx.Done():
 				return
 			}
 		}
 	}()
 }
+
+func (d databaseProducer) publishFailure(f model.Failure) {
+	topic, stage := metricLabels(d.cfg, f.NextTopic)
+
+	if err := d.retryManager.PublishFailure(context.Background(), f); err != nil {
+		log.Error(d.logger, "error publishing a failure to database for retry", append(failureFields(d.cfg, f), log.Err(err))...)
+		prometheus.IncFailurePublishErrors(topic, stage)
+		return
+	}
+
+	prometheus.IncFailuresPublished(topic, stage)
+	if f.Permanent {
+		prometheus.IncDeadLettered(topic, d.cfg.TopicStage(f.Topic))
+	}
+}
@@ -21,14 +21,17 @@ func TestNewDatabaseProducer(t *testing.T) {
 	fch := make(chan model.Failure)
 	logger := log.NullLogger{}
 	rm := newMockRetryManager(false)
+	cfg := newTestConfig()
 
 	exp := &databaseProducer{
+		cfg:          cfg,
 		retryManager: rm,
 		fch:          fch,
 		logger:       logger,
+		status:       newStatusTracker(),
 	}
 
-	if diff := deep.Equal(exp, newDatabaseProducer(rm, fch, logger)); diff != nil {
+	if diff := deep.Equal(exp, newDatabaseProducer(cfg, rm, fch, logger)); diff != nil {
 		t.Error(diff)
 	}
 }
@@ -51,7 +54,7 @@ func TestDatabaseProducer_ListenForFailures(t *testing.T) {
 		repo := newMockRetryManager(false)
 		fch := make(chan model.Failure, 1)
 
-		newDatabaseProducer(repo, fch, log.NullLogger{}).listenForFailures(ctx, &sync.WaitGroup{})
+		newDatabaseProducer(newTestConfig(), repo, fch, log.NullLogger{}).listenForFailures(ctx, &sync.WaitGroup{})
 		fch <- f1
 		fch <- f2
 		time.Sleep(time.Millisecond * 5)
@@ -75,7 +78,7 @@ func TestDatabaseProducer_ListenForFailures(t *testing.T) {
 		repo := newMockRetryManager(true)
 		fch := make(chan model.Failure, 1)
 
-		newDatabaseProducer(repo, fch, log.NullLogger{}).listenForFailures(ctx, &sync.WaitGroup{})
+		newDatabaseProducer(newTestConfig(), repo, fch, log.NullLogger{}).listenForFailures(ctx, &sync.WaitGroup{})
 		fch <- f1
 		fch <- f2
 		time.Sleep(time.Millisecond * 5)
@@ -0,0 +1,35 @@
+package consumer
+
+import (
+	"time"
+
+	"github.com/inviqa/kafka-consumer-go/data/failure/model"
+)
+
+type PermanentError = model.PermanentError
+type RetryAfterError = model.RetryAfterError
+
+// Permanent marks err as permanent, so that the message is sent straight to the dead-letter
+// topic (or marked as dead-lettered in the DB) instead of going through the remaining retries.
+// Return this from a handler for failures that a retry would not fix, such as decoding or
+// validation errors.
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &model.PermanentError{Err: err}
+}
+
+// RetryAfter marks err as retryable, with a delay that the handler would like to elapse before
+// the message is retried.
+func RetryAfter(err error, d time.Duration) error {
+	if err == nil {
+		return nil
+	}
+	return &model.RetryAfterError{Err: err, Delay: d}
+}
+
+// IsPermanent reports whether err has been marked as permanent with Permanent.
+func IsPermanent(err error) bool {
+	return model.IsPermanent(err)
+}
@@ -7,12 +7,17 @@ require (
 	github.com/Shopify/sarama v1.30.0
 	github.com/containerd/containerd v1.6.0 // indirect
 	github.com/docker/distribution v2.8.0+incompatible // indirect
+	github.com/go-sql-driver/mysql v1.6.0
 	github.com/go-test/deep v1.0.8
 	github.com/golang-migrate/migrate/v4 v4.15.1
 	github.com/google/uuid v1.3.0
 	github.com/jackc/pgx/v4 v4.13.0
 	github.com/lib/pq v1.10.3 // indirect
 	github.com/prometheus/client_golang v1.12.1
+	github.com/xdg-go/scram v1.0.2
+	go.opentelemetry.io/otel v1.7.0
+	go.opentelemetry.io/otel/sdk v1.7.0
+	go.opentelemetry.io/otel/trace v1.7.0
 	go.uber.org/atomic v1.9.0 // indirect
 	golang.org/x/mod v0.5.1 // indirect
 	golang.org/x/tools v0.1.7
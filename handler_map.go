@@ -2,16 +2,112 @@ package consumer
 
 import (
 	"context"
+	"fmt"
+	"strings"
 
 	"github.com/Shopify/sarama"
 
 	"github.com/inviqa/kafka-consumer-go/config"
+	"github.com/inviqa/kafka-consumer-go/log"
 )
 
 type Handler func(ctx context.Context, msg *sarama.ConsumerMessage) error
 type HandlerMap map[config.TopicKey]Handler
 
+// UnhandledPolicy determines what happens to messages from topics that have no registered handler.
+type UnhandledPolicy int
+
+const (
+	// FailOnUnhandled causes Start to return an error if any configured topic does not have a
+	// handler. This is the default policy.
+	FailOnUnhandled UnhandledPolicy = iota
+	// SkipUnhandled marks messages without a handler as processed, without processing them.
+	SkipUnhandled
+	// DeadLetterUnhandled sends messages without a handler straight to the dead-letter stage.
+	DeadLetterUnhandled
+)
+
+// callHandler calls the handler for the message, converting a panic into a *PanicError so that
+// the message goes through the normal failure path instead of crashing the process.
+func callHandler(ctx context.Context, logger log.StructuredLogger, h Handler, msg *sarama.ConsumerMessage) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			pe := newPanicError(r)
+			logPanic(logger, pe, messageFields(msg))
+			err = pe
+		}
+	}()
+
+	return h(ctx, msg)
+}
+
+// resolveHandler returns the handler for the topic key, falling back to the default handler if
+// there is one. Otherwise, it returns a handler that applies the unhandled message policy.
+func resolveHandler(hm HandlerMap, k config.TopicKey, opts *options, logger log.StructuredLogger) Handler {
+	if h, ok := hm.handlerForTopic(k); ok {
+		return h
+	}
+
+	if opts.defaultHandler != nil {
+		return opts.defaultHandler
+	}
+
+	if opts.unhandledPolicy == DeadLetterUnhandled {
+		return func(ctx context.Context, msg *sarama.ConsumerMessage) error {
+			return Permanent(fmt.Errorf("consumer: handler not found for topic: %s", k))
+		}
+	}
+
+	return func(ctx context.Context, msg *sarama.ConsumerMessage) error {
+		log.Error(logger, "consumer: handler not found for topic, skipping message", messageFields(msg)...)
+		return nil
+	}
+}
+
+// validateHandlers checks that every configured topic has a handler to process its messages,
+// unless a default handler has been registered or the unhandled policy allows for it.
+func validateHandlers(cfg *config.Config, hm HandlerMap, opts *options) error {
+	if opts.defaultHandler != nil || opts.unhandledPolicy != FailOnUnhandled {
+		return nil
+	}
+
+	var missing []string
+	seen := map[config.TopicKey]bool{}
+	for _, t := range cfg.ConsumableTopics {
+		if seen[t.Key] {
+			continue
+		}
+		seen[t.Key] = true
+
+		_, ok := hm.handlerForTopic(t.Key)
+		_, batchOk := opts.batchHandlers.handlerForTopic(t.Key)
+		if !ok && !batchOk {
+			missing = append(missing, string(t.Key))
+		}
+	}
+
+	if len(missing) > 0 {
+		return fmt.Errorf("consumer: no handler registered for topic(s): %s", strings.Join(missing, ", "))
+	}
+
+	return nil
+}
+
 func (hm HandlerMap) handlerForTopic(t config.TopicKey) (Handler, bool) {
 	h, ok := hm[t]
 	return h, ok
 }
+
+// withMiddleware returns a copy of the handler map with the given middleware applied to each handler.
+func (hm HandlerMap) withMiddleware(mws []Middleware) HandlerMap {
+	if len(mws) == 0 {
+		return hm
+	}
+
+	wrapped := make(HandlerMap, len(hm))
+	for k, h := range hm {
+		wrapped[k] = applyMiddleware(h, mws)
+	}
+
+	return wrapped
+}
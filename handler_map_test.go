@@ -0,0 +1,105 @@
+package consumer
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/Shopify/sarama"
+
+	"github.com/inviqa/kafka-consumer-go/log"
+)
+
+func TestResolveHandler(t *testing.T) {
+	errRegistered := errors.New("registered")
+	errDefault := errors.New("default")
+	hm := HandlerMap{
+		"product": func(ctx context.Context, msg *sarama.ConsumerMessage) error {
+			return errRegistered
+		},
+	}
+	defaultHandler := func(ctx context.Context, msg *sarama.ConsumerMessage) error {
+		return errDefault
+	}
+	msg := &sarama.ConsumerMessage{}
+
+	t.Run("registered handler is used", func(t *testing.T) {
+		h := resolveHandler(hm, "product", newOptions(WithDefaultHandler(defaultHandler)), log.NullLogger{})
+		if err := h(context.Background(), msg); err != errRegistered {
+			t.Errorf("expected the registered handler to be used, but got %v", err)
+		}
+	})
+
+	t.Run("default handler is used when none is registered", func(t *testing.T) {
+		h := resolveHandler(hm, "price", newOptions(WithDefaultHandler(defaultHandler)), log.NullLogger{})
+		if err := h(context.Background(), msg); err != errDefault {
+			t.Errorf("expected the default handler to be used, but got %v", err)
+		}
+	})
+
+	t.Run("unhandled messages are skipped", func(t *testing.T) {
+		h := resolveHandler(hm, "price", newOptions(WithUnhandledPolicy(SkipUnhandled)), log.NullLogger{})
+		if err := h(context.Background(), msg); err != nil {
+			t.Errorf("expected unhandled message to be skipped, but got %v", err)
+		}
+	})
+
+	t.Run("unhandled messages are dead-lettered", func(t *testing.T) {
+		h := resolveHandler(hm, "price", newOptions(WithUnhandledPolicy(DeadLetterUnhandled)), log.NullLogger{})
+		if err := h(context.Background(), msg); !IsPermanent(err) {
+			t.Errorf("expected a permanent error for unhandled message, but got %v", err)
+		}
+	})
+}
+
+func TestValidateHandlers(t *testing.T) {
+	handler := func(ctx context.Context, msg *sarama.ConsumerMessage) error {
+		return nil
+	}
+	batchHandler := func(ctx context.Context, msgs []*sarama.ConsumerMessage) error {
+		return nil
+	}
+
+	tests := []struct {
+		name    string
+		hm      HandlerMap
+		opts    *options
+		wantErr bool
+	}{
+		{
+			name: "all topics have a handler",
+			hm:   HandlerMap{"product": handler},
+			opts: newOptions(),
+		},
+		{
+			name: "all topics have a batch handler",
+			hm:   HandlerMap{},
+			opts: newOptions(WithBatchHandlers(BatchHandlerMap{"product": batchHandler}, 10, 0)),
+		},
+		{
+			name:    "topic is missing a handler",
+			hm:      HandlerMap{"price": handler},
+			opts:    newOptions(),
+			wantErr: true,
+		},
+		{
+			name: "default handler is registered",
+			hm:   HandlerMap{},
+			opts: newOptions(WithDefaultHandler(handler)),
+		},
+		{
+			name: "unhandled messages are skipped",
+			hm:   HandlerMap{},
+			opts: newOptions(WithUnhandledPolicy(SkipUnhandled)),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateHandlers(newTestConfig(), tt.hm, tt.opts)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("wantErr: %v, error: %v", tt.wantErr, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,30 @@
+package consumer
+
+import (
+	"github.com/Shopify/sarama"
+
+	"github.com/inviqa/kafka-consumer-go/data/failure/model"
+)
+
+// Headers added to messages that are republished to a Kafka retry or dead-letter topic, see
+// the constants in the failure model package for their meaning.
+const (
+	HeaderOriginalTopic     = model.HeaderOriginalTopic
+	HeaderOriginalPartition = model.HeaderOriginalPartition
+	HeaderOriginalOffset    = model.HeaderOriginalOffset
+	HeaderFailureReason     = model.HeaderFailureReason
+	HeaderAttempts          = model.HeaderAttempts
+	HeaderFirstFailureAt    = model.HeaderFirstFailureAt
+	HeaderDueAt             = model.HeaderDueAt
+)
+
+// FailedAttempts returns the number of times that processing msg has already failed, based on
+// its HeaderAttempts header. This is 0 for messages consumed from a main topic.
+func FailedAttempts(msg *sarama.ConsumerMessage) int {
+	for _, h := range msg.Headers {
+		if h != nil && string(h.Key) == HeaderAttempts {
+			return model.AttemptsFromHeader(string(h.Value))
+		}
+	}
+	return 0
+}
@@ -0,0 +1,27 @@
+package consumer
+
+import (
+	"testing"
+
+	"github.com/Shopify/sarama"
+)
+
+func TestFailedAttempts(t *testing.T) {
+	tests := []struct {
+		name    string
+		headers []*sarama.RecordHeader
+		want    int
+	}{
+		{name: "no headers", want: 0},
+		{name: "attempts header", headers: []*sarama.RecordHeader{{Key: []byte("foo"), Value: []byte("bar")}, {Key: []byte(HeaderAttempts), Value: []byte("2")}}, want: 2},
+		{name: "invalid attempts header", headers: []*sarama.RecordHeader{{Key: []byte(HeaderAttempts), Value: []byte("two")}}, want: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := FailedAttempts(&sarama.ConsumerMessage{Headers: tt.headers}); got != tt.want {
+				t.Errorf("expected %d failed attempts, but got %d", tt.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,158 @@
+package consumer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/inviqa/kafka-consumer-go/log"
+)
+
+var (
+	healthCheckTimeout    = time.Second * 2
+	healthShutdownTimeout = time.Second * 5
+	errNotRunning         = errors.New("consumer is not running")
+	errProducerNotRunning = errors.New("failure producer is not running")
+	errNoSession          = errors.New("no consumer group session is established")
+	errNoPartitions       = errors.New("no partitions are assigned")
+)
+
+// pinger is satisfied by *sql.DB, and is used to check the retry database is reachable.
+type pinger interface {
+	PingContext(ctx context.Context) error
+}
+
+type healthResponse struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks"`
+}
+
+// HealthHandler returns an http.Handler that serves liveness checks on /healthz, and readiness
+// checks on /readyz. Each responds with 200 OK if all checks pass, or 503 Service Unavailable
+// otherwise, along with a JSON body describing the result of each check.
+//
+// The liveness check only fails if the failure producer has stopped after being started, so
+// that a consumer that is slow to connect to the database or Kafka is not restarted. The
+// readiness check requires the consumer and its failure producer to be running, a consumer
+// group session with assigned partitions, and, if DB retries are enabled, that the retry
+// database responds to a ping.
+func (c *Consumer) HealthHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		writeHealthResponse(w, c.livenessChecks())
+	})
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		writeHealthResponse(w, c.readinessChecks(r.Context()))
+	})
+
+	return mux
+}
+
+func (c *Consumer) livenessChecks() map[string]error {
+	checks := map[string]error{"failure_producer": nil}
+
+	if c.opts.status.failureProducerStopped() {
+		checks["failure_producer"] = errProducerNotRunning
+	}
+
+	return checks
+}
+
+func (c *Consumer) readinessChecks(ctx context.Context) map[string]error {
+	st := c.Status()
+	checks := map[string]error{"consumer": nil, "failure_producer": nil}
+
+	if !st.Running {
+		checks["consumer"] = errNotRunning
+	}
+	if !st.FailureProducerRunning {
+		checks["failure_producer"] = errProducerNotRunning
+	}
+
+	checks["kafka"] = nil
+	if st.ActiveSessions == 0 {
+		checks["kafka"] = errNoSession
+	} else if len(st.AssignedPartitions) == 0 {
+		checks["kafka"] = errNoPartitions
+	}
+
+	c.mu.Lock()
+	db := c.db
+	c.mu.Unlock()
+
+	if c.cfg.UseDBForRetryQueue {
+		checks["database"] = pingDB(ctx, db)
+	}
+
+	return checks
+}
+
+func pingDB(ctx context.Context, db pinger) error {
+	if db == nil {
+		return errors.New("database is not connected")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+	defer cancel()
+
+	if err := db.PingContext(ctx); err != nil {
+		return fmt.Errorf("database ping failed: %w", err)
+	}
+
+	return nil
+}
+
+func writeHealthResponse(w http.ResponseWriter, checks map[string]error) {
+	resp := healthResponse{Status: "ok", Checks: make(map[string]string, len(checks))}
+	code := http.StatusOK
+
+	names := make([]string, 0, len(checks))
+	for name := range checks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		resp.Checks[name] = "ok"
+		if err := checks[name]; err != nil {
+			resp.Checks[name] = err.Error()
+			resp.Status = "unavailable"
+			code = http.StatusServiceUnavailable
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// serveHealthChecks starts an HTTP server for the HealthHandler on the given address, and
+// returns a function that shuts it down.
+func (c *Consumer) serveHealthChecks(addr string) (func(), error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("unable to serve health checks: %w", err)
+	}
+
+	srv := &http.Server{Handler: c.HealthHandler()}
+	go func() {
+		if err := srv.Serve(ln); err != nil && err != http.ErrServerClosed {
+			log.Error(c.opts.logger, "error serving health checks", log.Err(err))
+			c.opts.status.recordError(err)
+		}
+	}()
+	log.Info(c.opts.logger, "serving health checks", log.F("addr", ln.Addr().String()))
+
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(), healthShutdownTimeout)
+		defer cancel()
+		if err := srv.Shutdown(ctx); err != nil {
+			log.Error(c.opts.logger, "error shutting down health check server", log.Err(err))
+		}
+	}, nil
+}
@@ -0,0 +1,154 @@
+package consumer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-test/deep"
+)
+
+type fakePinger struct {
+	err error
+}
+
+func (f fakePinger) PingContext(ctx context.Context) error {
+	return f.err
+}
+
+func TestConsumer_HealthHandler(t *testing.T) {
+	healthy := func(c *Consumer) {
+		c.opts.status.setRunning(true)
+		c.opts.status.setFailureProducerRunning(true)
+		c.opts.status.partitionsAssigned(map[string][]int32{"product": {0}})
+	}
+
+	tests := []struct {
+		name      string
+		path      string
+		useDB     bool
+		db        pinger
+		setup     func(c *Consumer)
+		expCode   int
+		expChecks map[string]string
+	}{
+		{
+			name:      "live when the consumer is running",
+			path:      "/healthz",
+			setup:     healthy,
+			expCode:   http.StatusOK,
+			expChecks: map[string]string{"failure_producer": "ok"},
+		},
+		{
+			name:      "live whilst the consumer is starting",
+			path:      "/healthz",
+			setup:     func(c *Consumer) {},
+			expCode:   http.StatusOK,
+			expChecks: map[string]string{"failure_producer": "ok"},
+		},
+		{
+			name: "not live when the failure producer has stopped",
+			path: "/healthz",
+			setup: func(c *Consumer) {
+				c.opts.status.setRunning(true)
+				c.opts.status.setFailureProducerRunning(true)
+				c.opts.status.setFailureProducerRunning(false)
+			},
+			expCode:   http.StatusServiceUnavailable,
+			expChecks: map[string]string{"failure_producer": errProducerNotRunning.Error()},
+		},
+		{
+			name:      "ready when partitions are assigned",
+			path:      "/readyz",
+			setup:     healthy,
+			expCode:   http.StatusOK,
+			expChecks: map[string]string{"consumer": "ok", "failure_producer": "ok", "kafka": "ok"},
+		},
+		{
+			name:    "not ready whilst the consumer is starting",
+			path:    "/readyz",
+			setup:   func(c *Consumer) {},
+			expCode: http.StatusServiceUnavailable,
+			expChecks: map[string]string{
+				"consumer":         errNotRunning.Error(),
+				"failure_producer": errProducerNotRunning.Error(),
+				"kafka":            errNoSession.Error(),
+			},
+		},
+		{
+			name: "not ready without a consumer group session",
+			path: "/readyz",
+			setup: func(c *Consumer) {
+				c.opts.status.setRunning(true)
+				c.opts.status.setFailureProducerRunning(true)
+			},
+			expCode:   http.StatusServiceUnavailable,
+			expChecks: map[string]string{"consumer": "ok", "failure_producer": "ok", "kafka": errNoSession.Error()},
+		},
+		{
+			name: "not ready when no partitions are assigned",
+			path: "/readyz",
+			setup: func(c *Consumer) {
+				c.opts.status.setRunning(true)
+				c.opts.status.setFailureProducerRunning(true)
+				c.opts.status.partitionsAssigned(map[string][]int32{})
+			},
+			expCode:   http.StatusServiceUnavailable,
+			expChecks: map[string]string{"consumer": "ok", "failure_producer": "ok", "kafka": errNoPartitions.Error()},
+		},
+		{
+			name:      "ready when the database responds",
+			path:      "/readyz",
+			useDB:     true,
+			db:        fakePinger{},
+			setup:     healthy,
+			expCode:   http.StatusOK,
+			expChecks: map[string]string{"consumer": "ok", "failure_producer": "ok", "kafka": "ok", "database": "ok"},
+		},
+		{
+			name:      "not ready when the database does not respond",
+			path:      "/readyz",
+			useDB:     true,
+			db:        fakePinger{err: errors.New("oops")},
+			setup:     healthy,
+			expCode:   http.StatusServiceUnavailable,
+			expChecks: map[string]string{"consumer": "ok", "failure_producer": "ok", "kafka": "ok", "database": "database ping failed: oops"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newTestRunner(t, &fakeCollection{}, nil)
+			c.cfg.UseDBForRetryQueue = tt.useDB
+			c.db = tt.db
+			tt.setup(c)
+
+			rec := httptest.NewRecorder()
+			c.HealthHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.path, nil))
+
+			if rec.Code != tt.expCode {
+				t.Errorf("expected status code %d, but got %d", tt.expCode, rec.Code)
+			}
+
+			var resp healthResponse
+			if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+				t.Fatalf("unexpected error decoding response: %s", err)
+			}
+			if diff := deep.Equal(tt.expChecks, resp.Checks); diff != nil {
+				t.Error(diff)
+			}
+		})
+	}
+}
+
+func TestConsumer_Run_WithHealthCheckAddr(t *testing.T) {
+	c := newTestRunner(t, &fakeCollection{}, nil)
+	c.cfg.HealthCheckAddr = "invalid address"
+
+	if err := c.Run(context.Background()); err == nil {
+		t.Error("expected an error when the health check server cannot listen, but got nil")
+	}
+}
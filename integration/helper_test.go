@@ -8,6 +8,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
+	"os"
 	"time"
 
 	"github.com/Shopify/sarama"
@@ -63,17 +64,25 @@ func initKafkaProducer(srmcfg *sarama.Config) {
 	}
 }
 
+// createConfig returns the config used in the integration tests, using the database driver set in
+// the DB_DRIVER environment variable, which is postgres if not set.
 func createConfig() *config.Config {
+	driver, port := "postgres", 15432
+	if os.Getenv("DB_DRIVER") == "mysql" {
+		driver, port = "mysql", 13306
+	}
+
 	c, err := config.NewBuilder().
 		SetKafkaHost([]string{"localhost:9092"}).
 		SetKafkaGroup("test").
 		SetSourceTopics([]string{"mainTopic"}).
 		SetRetryIntervals([]int{1, 2}).
+		SetDBDriver(driver).
 		SetDBHost("127.0.0.1").
 		SetDBPass("kafka-consumer").
 		SetDBUser("kafka-consumer").
 		SetDBSchema("kafka-consumer").
-		SetDBPort(15432).
+		SetDBPort(port).
 		Config()
 
 	if err != nil {
@@ -126,10 +135,16 @@ func consumeFromKafkaUsingDbRetriesUntil(done func(chan<- bool), handler consume
 }
 
 func dbRetryWithEventId(eventId string) (*Retry, error) {
-	row := db.QueryRow(
-		`SELECT id, topic, payload_json, payload_headers, payload_key, kafka_offset, kafka_partition, attempts, deadlettered, successful, errored, last_error FROM kafka_consumer_retries WHERE payload_json::text LIKE $1`,
-		fmt.Sprintf(`%%"event_id":"%s"%%`, eventId),
+	payload := "payload_json::text"
+	if cfg.DBDialect() == data.DialectMySQL {
+		payload = "payload_json"
+	}
+
+	query, args := cfg.DBDialect().Rebind(
+		`SELECT id, topic, payload_json, payload_headers, payload_key, kafka_offset, kafka_partition, attempts, deadlettered, successful, errored, last_error FROM kafka_consumer_retries WHERE `+payload+` LIKE $1`,
+		[]interface{}{fmt.Sprintf(`%%"event_id":"%s"%%`, eventId)},
 	)
+	row := db.QueryRow(query, args...)
 
 	retry := &Retry{}
 	err := row.Scan(&retry.ID, &retry.Topic, &retry.PayloadJSON, &retry.PayloadHeaders, &retry.PayloadKey, &retry.KafkaOffset, &retry.KafkaPartition, &retry.Attempts, &retry.Deadlettered, &retry.Successful, &retry.Errored, &retry.LastError)
@@ -153,13 +168,11 @@ func insertDeadletteredProcessedDbRetry(updatedAt time.Time) {
 }
 
 func insertDbRetry(successful, errored, deadlettered bool, updatedAt time.Time) {
-	_, err := db.Exec(
-		`INSERT INTO kafka_consumer_retries(topic, payload_json, payload_headers, kafka_offset, kafka_partition, payload_key, successful, errored, deadlettered, updated_at) VALUES('foo', '{}', '{}', 0, 0, '', $1, $2, $3, $4);`,
-		successful,
-		errored,
-		deadlettered,
-		updatedAt,
+	query, args := cfg.DBDialect().Rebind(
+		`INSERT INTO kafka_consumer_retries(topic, payload_json, payload_headers, kafka_offset, kafka_partition, payload_key, successful, errored, deadlettered, last_error, updated_at) VALUES('foo', '{}', '{}', 0, 0, '', $1, $2, $3, '', $4);`,
+		[]interface{}{successful, errored, deadlettered, updatedAt},
 	)
+	_, err := db.Exec(query, args...)
 
 	if err != nil {
 		panic(err)
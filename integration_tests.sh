@@ -2,6 +2,9 @@
 
 docker-compose down && docker-compose up -d
 echo "waiting for stack..."
-sleep 5
+sleep 15
 
-LOG_LEVEL=error go test -timeout=100s -count=1 -v --tags=integration ./integration/
+for driver in postgres mysql; do
+  echo "running integration tests with the ${driver} database driver..."
+  DB_DRIVER=${driver} LOG_LEVEL=error go test -timeout=100s -count=1 -v --tags=integration ./integration/ || exit 1
+done
@@ -7,4 +7,4 @@ import (
 	"github.com/inviqa/kafka-consumer-go/log"
 )
 
-type kafkaConnector func(cfg *config.Config, saramaCfg *sarama.Config, logger log.Logger) (sarama.ConsumerGroup, error)
+type kafkaConnector func(cfg *config.Config, saramaCfg *sarama.Config, logger log.StructuredLogger) (sarama.ConsumerGroup, error)
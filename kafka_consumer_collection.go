@@ -13,6 +13,13 @@ import (
 	"github.com/inviqa/kafka-consumer-go/log"
 )
 
+const (
+	// consumeErrorBackoff is how long a consumer waits before consuming again after an error,
+	// which doubles after each consecutive error up to maxConsumeErrorBackoff.
+	consumeErrorBackoff    = time.Second
+	maxConsumeErrorBackoff = time.Second * 30
+)
+
 type failureProducer interface {
 	listenForFailures(ctx context.Context, wg *sync.WaitGroup)
 }
@@ -22,8 +29,9 @@ type kafkaConsumerCollection struct {
 	consumers      []sarama.ConsumerGroup
 	producer       failureProducer
 	handler        sarama.ConsumerGroupHandler
+	opts           *options
 	saramaCfg      *sarama.Config
-	logger         log.Logger
+	logger         log.StructuredLogger
 	connectToKafka kafkaConnector
 }
 
@@ -33,18 +41,24 @@ func newKafkaConsumerCollection(
 	fch chan model.Failure,
 	hm HandlerMap,
 	scfg *sarama.Config,
-	logger log.Logger,
+	logger log.StructuredLogger,
 	connector kafkaConnector,
+	opts *options,
 ) *kafkaConsumerCollection {
 	if logger == nil {
 		logger = log.NullLogger{}
 	}
 
+	if opts == nil {
+		opts = newOptions()
+	}
+
 	return &kafkaConsumerCollection{
 		cfg:            cfg,
 		consumers:      []sarama.ConsumerGroup{},
 		producer:       p,
-		handler:        newConsumer(fch, cfg, hm, logger),
+		handler:        newConsumer(fch, cfg, hm, logger, opts),
+		opts:           opts,
 		saramaCfg:      scfg,
 		logger:         logger,
 		connectToKafka: connector,
@@ -72,14 +86,14 @@ func (cc *kafkaConsumerCollection) start(ctx context.Context, wg *sync.WaitGroup
 func (cc *kafkaConsumerCollection) close() {
 	for _, c := range cc.consumers {
 		if err := c.Close(); err != nil {
-			cc.logger.Errorf("error occurred closing a Kafka consumer: %w", err)
+			log.Error(cc.logger, "error occurred closing a Kafka consumer", log.Err(err))
 		}
 	}
 	cc.consumers = []sarama.ConsumerGroup{}
 }
 
 func (cc *kafkaConsumerCollection) startConsumerGroup(ctx context.Context, wg *sync.WaitGroup, topic *config.KafkaTopic) (sarama.ConsumerGroup, error) {
-	cc.logger.Infof("starting Kafka consumer group for '%s'", topic.Name)
+	log.Info(cc.logger, "starting Kafka consumer group", log.F("topic", topic.Name))
 
 	cl, err := cc.connectToKafka(cc.cfg, cc.saramaCfg, cc.logger)
 	if err != nil {
@@ -94,30 +108,38 @@ func (cc *kafkaConsumerCollection) startConsumerGroup(ctx context.Context, wg *s
 func (cc *kafkaConsumerCollection) startConsumer(cl sarama.ConsumerGroup, ctx context.Context, wg *sync.WaitGroup, topic *config.KafkaTopic) {
 	go func() {
 		for err := range cl.Errors() {
-			cc.logger.Errorf("error occurred in consumer group Handler: %w", err)
+			log.Error(cc.logger, "error occurred in consumer group handler", log.F("topic", topic.Name), log.Err(err))
+			cc.opts.status.recordError(err)
 		}
 	}()
 
+	// retry topics are consumed straight away, as the consumer waits for each message to be
+	// due before handling it (see HeaderDueAt)
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		timer := time.NewTimer(topic.Delay)
-		for {
+		backoff := consumeErrorBackoff
+		for ctx.Err() == nil {
+			err := cl.Consume(ctx, []string{topic.Name}, cc.handler)
+			if ctx.Err() != nil {
+				return
+			}
+			if err == nil {
+				// the session ended cleanly, e.g. on a rebalance, so we rejoin straight away
+				backoff = consumeErrorBackoff
+				continue
+			}
+
+			log.Error(cc.logger, "error when consuming from Kafka", log.F("topic", topic.Name), log.Err(err), log.F("backoff", backoff))
+			cc.opts.status.recordError(err)
+
 			select {
-			case <-timer.C:
-				if err := cl.Consume(ctx, []string{topic.Name}, cc.handler); err != nil {
-					cc.logger.Errorf("error when consuming from Kafka: %s", err)
-				}
-				if ctx.Err() != nil {
-					timer.Stop()
-					return
-				}
-				timer.Reset(topic.Delay)
 			case <-ctx.Done():
-				if !timer.Stop() {
-					<-timer.C
-				}
 				return
+			case <-time.After(backoff):
+			}
+			if backoff *= 2; backoff > maxConsumeErrorBackoff {
+				backoff = maxConsumeErrorBackoff
 			}
 		}
 	}()
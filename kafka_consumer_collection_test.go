@@ -23,7 +23,7 @@ func TestNewCollection(t *testing.T) {
 	}()
 
 	cfg := &config.Config{}
-	fp := newKafkaFailureProducer(saramatest.NewMockSyncProducer(), make(chan model.Failure, 10), nil)
+	fp := newKafkaFailureProducer(newTestConfig(), saramatest.NewMockSyncProducer(), make(chan model.Failure, 10), nil)
 	fch := make(chan model.Failure)
 	scfg := config.NewSaramaConfig(false, false)
 	l := log.NullLogger{}
@@ -33,12 +33,13 @@ func TestNewCollection(t *testing.T) {
 		cfg:            cfg,
 		consumers:      []sarama.ConsumerGroup{},
 		producer:       fp,
-		handler:        newConsumer(fch, cfg, hm, l),
+		handler:        newConsumer(fch, cfg, hm, l, nil),
+		opts:           newOptions(),
 		saramaCfg:      scfg,
 		logger:         l,
 		connectToKafka: defaultKafkaConnector,
 	}
-	got := newKafkaConsumerCollection(cfg, fp, fch, hm, scfg, nil, defaultKafkaConnector)
+	got := newKafkaConsumerCollection(cfg, fp, fch, hm, scfg, nil, defaultKafkaConnector, nil)
 
 	if diff := deep.Equal(exp, got); diff != nil {
 		t.Error(diff)
@@ -168,12 +169,13 @@ func TestCollection_Start(t *testing.T) {
 			t.Errorf("unexpected error: %s", err)
 		}
 
+		timeout := time.After(time.Second * 1)
 	L:
 		for {
 			select {
-			case <-time.After(time.Second * 1):
-				t.Error("did not receive any failures in time")
-			default:
+			case <-timeout:
+				t.Fatal("did not receive any failures in time")
+			case <-time.After(time.Millisecond):
 				if failureProd.numberOfReceivedFailures() == 1 {
 					cancel()
 					break L
@@ -195,5 +197,5 @@ func testKafkaConsumerCollection(mcg *saramatest.MockConsumerGroup, msgHandler H
 
 	mockFp := newMockFailureProducer(fch)
 
-	return newKafkaConsumerCollection(newTestConfig(), mockFp, fch, hm, sarama.NewConfig(), log.NullLogger{}, connector.connectToKafka), mockFp
+	return newKafkaConsumerCollection(newTestConfig(), mockFp, fch, hm, sarama.NewConfig(), log.NullLogger{}, connector.connectToKafka, nil), mockFp
 }
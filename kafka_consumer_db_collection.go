@@ -12,6 +12,7 @@ import (
 	failuremodel "github.com/inviqa/kafka-consumer-go/data/failure/model"
 	"github.com/inviqa/kafka-consumer-go/data/retry/model"
 	"github.com/inviqa/kafka-consumer-go/log"
+	"github.com/inviqa/kafka-consumer-go/prometheus"
 )
 
 // kafkaConsumerDbCollection is a collection of consumers that initially consume messages from Kafka
@@ -24,8 +25,9 @@ type kafkaConsumerDbCollection struct {
 	retryManager      retryManager
 	handler           sarama.ConsumerGroupHandler
 	handlerMap        HandlerMap
+	opts              *options
 	saramaCfg         *sarama.Config
-	logger            log.Logger
+	logger            log.StructuredLogger
 	connectToKafka    kafkaConnector
 
 	// optional fields managed by setters
@@ -36,6 +38,7 @@ type retryManager interface {
 	GetBatch(ctx context.Context, topic string, sequence uint8, interval time.Duration) ([]model.Retry, error)
 	MarkSuccessful(ctx context.Context, retry model.Retry) error
 	MarkErrored(ctx context.Context, retry model.Retry, err error) error
+	Discard(ctx context.Context, retry model.Retry) error
 	PublishFailure(ctx context.Context, f failuremodel.Failure) error
 	RunMaintenance(ctx context.Context) error
 }
@@ -47,19 +50,25 @@ func newKafkaConsumerDbCollection(
 	fch chan failuremodel.Failure,
 	hm HandlerMap,
 	scfg *sarama.Config,
-	logger log.Logger,
+	logger log.StructuredLogger,
 	connector kafkaConnector,
+	opts *options,
 ) *kafkaConsumerDbCollection {
 	if logger == nil {
 		logger = log.NullLogger{}
 	}
 
+	if opts == nil {
+		opts = newOptions()
+	}
+
 	return &kafkaConsumerDbCollection{
 		cfg:                 cfg,
 		producer:            p,
 		retryManager:        rm,
-		handler:             newConsumer(fch, cfg, hm, logger),
+		handler:             newConsumer(fch, cfg, hm, logger, opts),
 		handlerMap:          hm,
+		opts:                opts,
 		saramaCfg:           scfg,
 		logger:              logger,
 		connectToKafka:      connector,
@@ -97,7 +106,7 @@ func (cc *kafkaConsumerDbCollection) periodicRetryManagerMaintenance(ctx context
 				return
 			case <-time.After(cc.maintenanceInterval):
 				if err := cc.retryManager.RunMaintenance(ctx); err != nil {
-					cc.logger.Errorf("error running maintenance in kafka consumer DB collection: %s", err)
+					log.Error(cc.logger, "error running maintenance in kafka consumer DB collection", log.Err(err))
 				}
 			}
 		}
@@ -106,7 +115,7 @@ func (cc *kafkaConsumerDbCollection) periodicRetryManagerMaintenance(ctx context
 
 // startMainTopicConsumer starts a sarama.ConsumerGroup to consume messages from Kafka for the given main topic names
 func (cc *kafkaConsumerDbCollection) startMainTopicConsumer(ctx context.Context, wg *sync.WaitGroup, topics []string) (sarama.ConsumerGroup, error) {
-	cc.logger.Infof("starting Kafka consumer group for topics: '%s'", topics)
+	log.Info(cc.logger, "starting Kafka consumer group", log.F("topics", topics))
 
 	cl, err := cc.connectToKafka(cc.cfg, cc.saramaCfg, cc.logger)
 	if err != nil {
@@ -115,7 +124,8 @@ func (cc *kafkaConsumerDbCollection) startMainTopicConsumer(ctx context.Context,
 
 	go func() {
 		for err := range cl.Errors() {
-			cc.logger.Errorf("error occurred in consumer group Handler: %w", err)
+			log.Error(cc.logger, "error occurred in consumer group handler", log.Err(err))
+			cc.opts.status.recordError(err)
 		}
 	}()
 
@@ -128,7 +138,8 @@ func (cc *kafkaConsumerDbCollection) startMainTopicConsumer(ctx context.Context,
 				return
 			default:
 				if err := cl.Consume(ctx, topics, cc.handler); err != nil {
-					cc.logger.Errorf("error when consuming from Kafka: %s", err)
+					log.Error(cc.logger, "error when consuming from Kafka", log.Err(err))
+					cc.opts.status.recordError(err)
 				}
 				if ctx.Err() != nil {
 					return
@@ -145,6 +156,8 @@ func (cc *kafkaConsumerDbCollection) startDbRetryProcessorsForTopic(ctx context.
 		wg.Add(1)
 		go func(retryConfig *config.DBTopicRetry) {
 			defer wg.Done()
+			cc.opts.status.retryProcessorStarted()
+			defer cc.opts.status.retryProcessorStopped()
 			timer := time.NewTimer(dbRetryPollInterval)
 			for {
 				select {
@@ -175,29 +188,123 @@ func (cc *kafkaConsumerDbCollection) processMessagesForRetry(topic string, rc *c
 
 	msgsForRetry, err := cc.retryManager.GetBatch(ctx, topic, rc.Sequence, rc.Interval)
 	if err != nil {
-		cc.logger.Errorf("error when fetching messages from the DB for retry: %s", err)
+		log.Error(cc.logger, "error when fetching messages from the DB for retry", log.F("topic", topic), log.F("retry_sequence", rc.Sequence), log.Err(err))
+		cc.opts.status.recordError(err)
 		return
 	}
 
-	h, ok := cc.handlerMap.handlerForTopic(rc.Key)
-	if !ok {
-		cc.logger.Errorf("no handler found for topic key '%s'", rc.Key)
+	stage := config.RetryStage(rc.Sequence)
+	prometheus.IncMessagesConsumed(topic, stage, len(msgsForRetry))
+
+	if bh, ok := cc.opts.batchHandlers.handlerForTopic(rc.Key); ok {
+		cc.processRetryBatch(ctx, bh, topic, stage, msgsForRetry)
 		return
 	}
 
+	h := resolveHandler(cc.handlerMap, rc.Key, cc.opts, cc.logger)
+
+	if cc.cfg.WorkerCount <= 1 {
+		for _, msg := range msgsForRetry {
+			cc.processRetry(ctx, h, topic, stage, msg)
+		}
+		return
+	}
+
+	pool := newKeyedWorkerPool(cc.cfg.WorkerCount)
 	for _, msg := range msgsForRetry {
-		saramaMsg := msg.ToSaramaConsumerMessage()
-		if err = h(ctx, saramaMsg); err != nil {
-			cc.logger.Errorf("error processing retried message from DB: %s", err)
-			if repoErr := cc.retryManager.MarkErrored(ctx, msg, err); repoErr != nil {
-				cc.logger.Errorf("error marking retried message as errored in the DB: %s", repoErr)
-			}
-		} else {
-			cc.logger.Infof("successfully processed retried message from topic '%s' with original partition %d and offset %d", topic, msg.KafkaPartition, msg.KafkaOffset)
-			if err = cc.retryManager.MarkSuccessful(ctx, msg); err != nil {
-				cc.logger.Errorf("error marking retried message as successful in the DB: %s", err)
-			}
+		msg := msg
+		pool.submit(msg.PayloadKey, func() {
+			cc.processRetry(ctx, h, topic, stage, msg)
+		})
+	}
+	pool.wait()
+}
+
+func (cc *kafkaConsumerDbCollection) processRetry(ctx context.Context, h Handler, topic, stage string, msg model.Retry) {
+	saramaMsg := msg.ToSaramaConsumerMessage()
+
+	ctx, span := cc.opts.startHandlerSpan(ctx, saramaMsg)
+	start := time.Now()
+	err := callHandler(ctx, cc.logger, h, saramaMsg)
+	prometheus.ObserveHandlerDuration(topic, stage, time.Since(start))
+	endSpan(span, err)
+	incHandlerPanics(topic, stage, err)
+
+	if err != nil {
+		prometheus.IncHandlerFailures(topic, stage, 1)
+		cc.markErrored(ctx, topic, stage, msg, err)
+		return
+	}
+
+	prometheus.IncHandlerSuccesses(topic, stage, 1)
+	log.Info(cc.logger, "successfully processed retried message from DB", retryFields(msg, stage)...)
+	cc.markSuccessful(ctx, topic, stage, msg)
+}
+
+func (cc *kafkaConsumerDbCollection) markErrored(ctx context.Context, topic, stage string, msg model.Retry, err error) {
+	fields := retryFields(msg, stage)
+	log.Error(cc.logger, "error processing retried message from DB", append(fields, log.Err(err))...)
+	prometheus.IncDBRetriesErrored(topic, stage)
+	if failuremodel.IsPermanent(err) || cc.cfg.DBRetries.MakeRetryErrored(msg).Deadlettered {
+		if cc.cfg.RetryPolicy(msg.Topic).DisableDeadLetter {
+			cc.discard(ctx, topic, stage, msg)
+			return
 		}
+		prometheus.IncDeadLettered(topic, stage)
+	}
+
+	if repoErr := cc.retryManager.MarkErrored(ctx, msg, err); repoErr != nil {
+		log.Error(cc.logger, "error marking retried message as errored in the DB", append(fields, log.Err(repoErr))...)
+	}
+}
+
+func (cc *kafkaConsumerDbCollection) discard(ctx context.Context, topic, stage string, msg model.Retry) {
+	fields := retryFields(msg, stage)
+	log.Info(cc.logger, "discarding retried message from DB instead of dead-lettering it", fields...)
+	prometheus.IncDiscarded(topic, stage)
+
+	if err := cc.retryManager.Discard(ctx, msg); err != nil {
+		log.Error(cc.logger, "error discarding retried message from the DB", append(fields, log.Err(err))...)
+	}
+}
+
+func (cc *kafkaConsumerDbCollection) markSuccessful(ctx context.Context, topic, stage string, msg model.Retry) {
+	prometheus.IncDBRetriesSucceeded(topic, stage)
+	if err := cc.retryManager.MarkSuccessful(ctx, msg); err != nil {
+		log.Error(cc.logger, "error marking retried message as successful in the DB", append(retryFields(msg, stage), log.Err(err))...)
+	}
+}
+
+// processRetryBatch passes all retries fetched from the DB to the batch handler in a single call,
+// and then marks each retry as successful or errored based on the outcome reported by the handler.
+func (cc *kafkaConsumerDbCollection) processRetryBatch(ctx context.Context, h BatchHandler, topic, stage string, retries []model.Retry) {
+	if len(retries) == 0 {
+		return
+	}
+
+	msgs := make([]*sarama.ConsumerMessage, len(retries))
+	for i, r := range retries {
+		msgs[i] = r.ToSaramaConsumerMessage()
+	}
+
+	ctx, span := cc.opts.startBatchSpan(ctx, msgs)
+	start := time.Now()
+	err := callBatchHandler(ctx, cc.logger, h, msgs)
+	prometheus.ObserveHandlerDuration(topic, stage, time.Since(start))
+	endSpan(span, err)
+	incHandlerPanics(topic, stage, err)
+
+	failures := batchFailures(msgs, err)
+	prometheus.IncHandlerFailures(topic, stage, len(failures))
+	prometheus.IncHandlerSuccesses(topic, stage, len(msgs)-len(failures))
+
+	for i, msg := range msgs {
+		if err, failed := failures[msg]; failed {
+			cc.markErrored(ctx, topic, stage, retries[i], err)
+			continue
+		}
+
+		cc.markSuccessful(ctx, topic, stage, retries[i])
 	}
 }
 
@@ -207,7 +314,7 @@ func (cc *kafkaConsumerDbCollection) close() {
 	}
 
 	if err := cc.mainKafkaConsumer.Close(); err != nil {
-		cc.logger.Errorf("error occurred closing the main Kafka consumer: %w", err)
+		log.Error(cc.logger, "error occurred closing the main Kafka consumer", log.Err(err))
 	}
 	cc.mainKafkaConsumer = nil
 }
@@ -25,7 +25,7 @@ func TestNewKafkaConsumerDbCollection(t *testing.T) {
 	cfg := &config.Config{}
 	repo := newMockRetryManager(false)
 	fch := make(chan model.Failure)
-	dp := newDatabaseProducer(repo, fch, nil)
+	dp := newDatabaseProducer(newTestConfig(), repo, fch, nil)
 	hm := HandlerMap{}
 	scfg := config.NewSaramaConfig(false, false)
 	logger := log.NullLogger{}
@@ -34,15 +34,16 @@ func TestNewKafkaConsumerDbCollection(t *testing.T) {
 		cfg:                 cfg,
 		producer:            dp,
 		retryManager:        repo,
-		handler:             newConsumer(fch, cfg, hm, logger),
+		handler:             newConsumer(fch, cfg, hm, logger, nil),
 		handlerMap:          hm,
+		opts:                newOptions(),
 		saramaCfg:           scfg,
 		logger:              logger,
 		connectToKafka:      defaultKafkaConnector,
 		maintenanceInterval: defaultMaintenanceInterval,
 	}
 
-	got := newKafkaConsumerDbCollection(cfg, dp, repo, fch, hm, scfg, logger, defaultKafkaConnector)
+	got := newKafkaConsumerDbCollection(cfg, dp, repo, fch, hm, scfg, logger, defaultKafkaConnector, nil)
 
 	if diff := deep.Equal(exp, got); diff != nil {
 		t.Error(diff)
@@ -157,6 +158,82 @@ func TestKafkaConsumerDbCollection_Start(t *testing.T) {
 		}
 	})
 
+	t.Run("retries are processed by workers when a worker count is configured", func(t *testing.T) {
+		mcg := saramatest.NewMockConsumerGroup()
+		mcg.AddMessage(exampleMsg)
+		var mu sync.Mutex
+		var called bool
+		col, repo := testKafkaConsumerDbCollection(mcg, func(ctx context.Context, msg *sarama.ConsumerMessage) error {
+			mu.Lock()
+			defer mu.Unlock()
+			if !called {
+				called = true
+				return errors.New("something bad happened")
+			}
+			return nil
+		}, false)
+		col.cfg.WorkerCount = 2
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*50)
+		defer cancel()
+		var wg sync.WaitGroup
+		if err := col.start(ctx, &wg); err != nil {
+			t.Errorf("unexpected error: %s", err)
+		}
+		wg.Wait()
+
+		if !repo.retrySuccessful {
+			t.Error("expected the DB retry to have been marked as successful, but it wasn't")
+		}
+	})
+
+	t.Run("retries are passed to batch handlers in a single call", func(t *testing.T) {
+		mcg := saramatest.NewMockConsumerGroup()
+		mcg.AddMessage(exampleMsg)
+		mcg.AddMessage(&sarama.ConsumerMessage{Topic: "product", Value: []byte(`{"foo":"baz"}`)})
+
+		var mu sync.Mutex
+		var calls [][]*sarama.ConsumerMessage
+		bhs := BatchHandlerMap{
+			"product": func(ctx context.Context, msgs []*sarama.ConsumerMessage) error {
+				mu.Lock()
+				defer mu.Unlock()
+				calls = append(calls, msgs)
+				if len(calls) == 1 {
+					return errors.New("something bad happened")
+				}
+				return nil
+			},
+		}
+
+		fch := make(chan model.Failure, 10)
+		repo := newMockRetryManager(false)
+		dp := newDatabaseProducer(newTestConfig(), repo, fch, log.NullLogger{})
+		connector := testKafkaConnector{consumerGroup: mcg}
+		opts := newOptions(WithBatchHandlers(bhs, 10, time.Millisecond))
+		col := newKafkaConsumerDbCollection(newTestConfig(), dp, repo, fch, HandlerMap{}, sarama.NewConfig(), log.NullLogger{}, connector.connectToKafka, opts)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		var wg sync.WaitGroup
+		if err := col.start(ctx, &wg); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		repo.waitFor(t, func() bool { return repo.retrySuccessful })
+		cancel()
+		wg.Wait()
+
+		mu.Lock()
+		defer mu.Unlock()
+		if len(calls) < 2 || len(calls[1]) != 2 {
+			t.Fatalf("expected both retries to be passed to the batch handler in a single call, got %v", calls)
+		}
+
+		if !repo.retrySuccessful {
+			t.Error("expected the DB retries to have been marked as successful, but they weren't")
+		}
+	})
+
 	t.Run("retries are marked as errored when they continue to fail", func(t *testing.T) {
 		mcg := saramatest.NewMockConsumerGroup()
 		mcg.AddMessage(exampleMsg)
@@ -181,6 +258,66 @@ func TestKafkaConsumerDbCollection_Start(t *testing.T) {
 		}
 	})
 
+	t.Run("retries are discarded instead of dead-lettered when the retry policy disables it", func(t *testing.T) {
+		mcg := saramatest.NewMockConsumerGroup()
+		mcg.AddMessage(exampleMsg)
+		var mu sync.Mutex
+		var called bool
+		col, repo := testKafkaConsumerDbCollection(mcg, func(ctx context.Context, msg *sarama.ConsumerMessage) error {
+			mu.Lock()
+			defer mu.Unlock()
+			if !called {
+				called = true
+				return errors.New("something bad happened")
+			}
+			return Permanent(errors.New("something worse happened"))
+		}, false)
+		col.cfg.RetryPolicies = map[config.TopicKey]config.RetryPolicy{
+			"product": {Intervals: []int{1}, DisableDeadLetter: true},
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		var wg sync.WaitGroup
+		if err := col.start(ctx, &wg); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		repo.waitFor(t, func() bool { return repo.retryDiscarded || repo.retryErrored })
+		cancel()
+		wg.Wait()
+
+		if !repo.retryDiscarded {
+			t.Error("expected the DB retry to have been discarded, but it wasn't")
+		}
+		if repo.retryErrored {
+			t.Error("expected the DB retry not to have been marked as errored, but it was")
+		}
+	})
+
+	t.Run("panics in handlers are recovered and marked as errored", func(t *testing.T) {
+		mcg := saramatest.NewMockConsumerGroup()
+		mcg.AddMessage(exampleMsg)
+		col, repo := testKafkaConsumerDbCollection(mcg, func(ctx context.Context, msg *sarama.ConsumerMessage) error {
+			panic("something really bad happened")
+		}, false)
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*100)
+		defer cancel()
+		var wg sync.WaitGroup
+		if err := col.start(ctx, &wg); err != nil {
+			t.Errorf("unexpected error: %s", err)
+		}
+		wg.Wait()
+
+		if got := repo.getPublishedFailureCountByTopic("product"); got != 1 {
+			t.Errorf("expected 1 failure to be produced in database, but got %d", got)
+		}
+
+		if !repo.retryErrored {
+			t.Error("expected the DB retry to have been marked as errored, but it wasn't")
+		}
+	})
+
 	t.Run("handles error from repository when fetching messages for retry", func(t *testing.T) {
 		mcg := saramatest.NewMockConsumerGroup()
 		mcg.AddMessage(exampleMsg)
@@ -250,6 +387,39 @@ func TestKafkaConsumerDbCollection_Start(t *testing.T) {
 	})
 }
 
+func TestKafkaConsumerDbCollection_processMessagesForRetry_KeyOrder(t *testing.T) {
+	var mu sync.Mutex
+	handled := map[string][]int64{}
+	col, repo := testKafkaConsumerDbCollection(saramatest.NewMockConsumerGroup(), func(ctx context.Context, msg *sarama.ConsumerMessage) error {
+		// later retries finish sooner, so they would overtake earlier ones if keys were not ordered
+		time.Sleep(time.Duration(20-msg.Offset) * time.Millisecond / 10)
+		mu.Lock()
+		defer mu.Unlock()
+		handled[string(msg.Key)] = append(handled[string(msg.Key)], msg.Offset)
+		return nil
+	}, false)
+	col.cfg.WorkerCount = 4
+
+	// the retries are returned in ID order, which is the order they were published in
+	for offset := int64(1); offset <= 20; offset++ {
+		key := []byte("even")
+		if offset%2 == 1 {
+			key = []byte("odd")
+		}
+		repo.recvdFailures["product"] = append(repo.recvdFailures["product"], model.Failure{Topic: "product", MessageKey: key, KafkaOffset: offset})
+	}
+
+	col.processMessagesForRetry("product", col.cfg.DBRetries["product"][0])
+
+	expected := map[string][]int64{
+		"odd":  {1, 3, 5, 7, 9, 11, 13, 15, 17, 19},
+		"even": {2, 4, 6, 8, 10, 12, 14, 16, 18, 20},
+	}
+	if diff := deep.Equal(expected, handled); diff != nil {
+		t.Error(diff)
+	}
+}
+
 func TestKafkaConsumerDbCollection_Close(t *testing.T) {
 	t.Run("consumers are closed", func(t *testing.T) {
 		t.Parallel()
@@ -290,10 +460,10 @@ func TestKafkaConsumerDbCollection_Close(t *testing.T) {
 func testKafkaConsumerDbCollection(mcg *saramatest.MockConsumerGroup, msgHandler Handler, errorOnConnect bool) (*kafkaConsumerDbCollection, *mockRetryManager) {
 	fch := make(chan model.Failure, 10)
 	repo := newMockRetryManager(false)
-	dp := newDatabaseProducer(repo, fch, log.NullLogger{})
+	dp := newDatabaseProducer(newTestConfig(), repo, fch, log.NullLogger{})
 
 	hm := HandlerMap{"product": msgHandler}
 	connector := testKafkaConnector{consumerGroup: mcg, willError: errorOnConnect}
 
-	return newKafkaConsumerDbCollection(newTestConfig(), dp, repo, fch, hm, sarama.NewConfig(), log.NullLogger{}, connector.connectToKafka), repo
+	return newKafkaConsumerDbCollection(newTestConfig(), dp, repo, fch, hm, sarama.NewConfig(), log.NullLogger{}, connector.connectToKafka, nil), repo
 }
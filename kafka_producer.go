@@ -12,26 +12,34 @@ import (
 	"github.com/inviqa/kafka-consumer-go/config"
 	"github.com/inviqa/kafka-consumer-go/data/failure/model"
 	"github.com/inviqa/kafka-consumer-go/log"
+	"github.com/inviqa/kafka-consumer-go/prometheus"
 )
 
 // kafkaFailureProducer is a producer that listens for failed push attempts from kafka
 // on fch and then sends them to the next kafka retry topic in the chain for retry later
 type kafkaFailureProducer struct {
+	cfg      *config.Config
 	producer sarama.SyncProducer
 	fch      <-chan model.Failure
-	logger   log.Logger
+	logger   log.StructuredLogger
+
+	// optional fields managed by setters
+	status *statusTracker
 }
 
-func newKafkaFailureProducerWithDefaults(cfg *config.Config, fch <-chan model.Failure, logger log.Logger) (*kafkaFailureProducer, error) {
+func newKafkaFailureProducerWithDefaults(cfg *config.Config, fch <-chan model.Failure, logger log.StructuredLogger) (*kafkaFailureProducer, error) {
 	if logger == nil {
 		logger = log.NullLogger{}
 	}
 
-	var sp sarama.SyncProducer
-	var err error
+	srmCfg, err := cfg.SaramaConfig()
+	if err != nil {
+		return nil, err
+	}
 
+	var sp sarama.SyncProducer
 	for i := 0; i < maxConnectionAttempts; i++ {
-		sp, err = sarama.NewSyncProducer(cfg.Host, config.NewSaramaConfig(cfg.TLSEnable, cfg.TLSSkipVerifyPeer))
+		sp, err = sarama.NewSyncProducer(cfg.Host, srmCfg)
 		if err == nil {
 			break
 		}
@@ -43,30 +51,38 @@ func newKafkaFailureProducerWithDefaults(cfg *config.Config, fch <-chan model.Fa
 			return nil, fmt.Errorf("error occurred creating Kafka producer for retries: %w", err)
 		}
 
-		logger.Info("Kafka cluster is not reachable, retrying...")
+		log.Info(logger, "Kafka cluster is not reachable, retrying...")
 		time.Sleep(connectionInterval)
 	}
 
-	return newKafkaFailureProducer(sp, fch, logger), nil
+	return newKafkaFailureProducer(cfg, sp, fch, logger), nil
 }
 
-func newKafkaFailureProducer(sp sarama.SyncProducer, fch <-chan model.Failure, logger log.Logger) *kafkaFailureProducer {
+func newKafkaFailureProducer(cfg *config.Config, sp sarama.SyncProducer, fch <-chan model.Failure, logger log.StructuredLogger) *kafkaFailureProducer {
 	return &kafkaFailureProducer{
+		cfg:      cfg,
 		producer: sp,
 		fch:      fch,
 		logger:   logger,
+		status:   newStatusTracker(),
 	}
 }
 
+func (p *kafkaFailureProducer) setStatusTracker(s *statusTracker) {
+	p.status = s
+}
+
 func (p kafkaFailureProducer) listenForFailures(ctx context.Context, wg *sync.WaitGroup) {
-	p.logger.Info("starting Kafka retry producer")
+	log.Info(p.logger, "starting Kafka retry producer")
 
 	wg.Add(1)
+	p.status.setFailureProducerRunning(true)
 	go func() {
 		defer wg.Done()
+		defer p.status.setFailureProducerRunning(false)
 		defer func() {
 			if err := p.producer.Close(); err != nil {
-				p.logger.Error("error occurred closing Kafka retry producer")
+				log.Error(p.logger, "error occurred closing Kafka retry producer", log.Err(err))
 			}
 		}()
 
@@ -82,17 +98,49 @@ func (p kafkaFailureProducer) listenForFailures(ctx context.Context, wg *sync.Wa
 }
 
 func (p kafkaFailureProducer) publishFailure(f model.Failure) {
-	p.logger.Debugf("publishing retry to Kafka topic '%s'", f.NextTopic)
+	fields := failureFields(p.cfg, f)
+	log.Debug(p.logger, "publishing retry to Kafka topic", fields...)
+	topic, stage := metricLabels(p.cfg, f.NextTopic)
+
+	now := time.Now()
+	msg := &sarama.ProducerMessage{
+		Topic:   f.NextTopic,
+		Value:   sarama.ByteEncoder(f.Message),
+		Headers: f.RetryRecordHeaders(now, p.dueAt(f, now)),
+	}
+	// the key is only set when there is one, so that messages without a key are still
+	// spread across partitions rather than all hashed to the same one
+	if len(f.MessageKey) > 0 {
+		msg.Key = sarama.ByteEncoder(f.MessageKey)
+	}
 
-	_, _, err := p.producer.SendMessage(&sarama.ProducerMessage{
-		Topic: f.NextTopic,
-		Value: sarama.ByteEncoder(f.Message),
-	})
+	_, _, err := p.producer.SendMessage(msg)
 
 	if err != nil {
-		p.logger.Errorf("error occurred publishing retry to Kafka topic '%s': %w", f.NextTopic, err)
+		log.Error(p.logger, "error occurred publishing retry to Kafka topic", append(fields, log.Err(err))...)
+		prometheus.IncFailurePublishErrors(topic, stage)
 		return
 	}
 
-	p.logger.Debugf("published Failure event message to Kafka retry topic '%s' successfully", f.NextTopic)
+	prometheus.IncFailuresPublished(topic, stage)
+	if stage == "deadletter" {
+		prometheus.IncDeadLettered(topic, p.cfg.TopicStage(f.Topic))
+	}
+
+	log.Debug(p.logger, "published failure to Kafka retry topic successfully", fields...)
+}
+
+// dueAt returns the time that a failure published at now should be retried from its next topic,
+// which is after the delay requested by the handler, if there was one, or otherwise the delay of
+// its next retry. It is zero if the next topic is a dead-letter topic.
+func (p kafkaFailureProducer) dueAt(f model.Failure, now time.Time) time.Time {
+	next, ok := p.cfg.TopicMap[config.TopicKey(f.NextTopic)]
+	if !ok || next.Next == nil {
+		return time.Time{}
+	}
+
+	if f.RetryAfter > 0 {
+		return now.Add(f.RetryAfter)
+	}
+	return now.Add(p.cfg.RetryDelayInChain(f.Topic, f.Attempts()))
 }
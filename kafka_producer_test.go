@@ -7,8 +7,10 @@ import (
 	"testing"
 	"time"
 
+	"github.com/Shopify/sarama"
 	"github.com/go-test/deep"
 
+	"github.com/inviqa/kafka-consumer-go/config"
 	"github.com/inviqa/kafka-consumer-go/data/failure/model"
 	"github.com/inviqa/kafka-consumer-go/log"
 	"github.com/inviqa/kafka-consumer-go/test/saramatest"
@@ -23,14 +25,17 @@ func TestNewKafkaFailureProducer(t *testing.T) {
 	sp := saramatest.NewMockSyncProducer()
 	fch := make(<-chan model.Failure)
 	logger := log.NullLogger{}
+	cfg := newTestConfig()
 
 	exp := &kafkaFailureProducer{
+		cfg:      cfg,
 		producer: sp,
 		fch:      fch,
 		logger:   logger,
+		status:   newStatusTracker(),
 	}
 
-	got := newKafkaFailureProducer(sp, fch, logger)
+	got := newKafkaFailureProducer(cfg, sp, fch, logger)
 
 	if diff := deep.Equal(exp, got); diff != nil {
 		t.Error(diff)
@@ -38,7 +43,7 @@ func TestNewKafkaFailureProducer(t *testing.T) {
 }
 
 func TestNewFailureProducer_WithNilLogger(t *testing.T) {
-	if newKafkaFailureProducer(saramatest.NewMockSyncProducer(), make(<-chan model.Failure), nil) == nil {
+	if newKafkaFailureProducer(newTestConfig(), saramatest.NewMockSyncProducer(), make(<-chan model.Failure), nil) == nil {
 		t.Errorf("expected a producer but got nil")
 	}
 }
@@ -47,7 +52,7 @@ func TestFailureProducer_ListenForFailures(t *testing.T) {
 	ctx, cancel := context.WithCancel(context.Background())
 	sp := saramatest.NewMockSyncProducer()
 	fch := make(chan model.Failure, 10)
-	prod := newKafkaFailureProducer(sp, fch, log.NullLogger{})
+	prod := newKafkaFailureProducer(newTestConfig(), sp, fch, log.NullLogger{})
 
 	prod.listenForFailures(ctx, &sync.WaitGroup{})
 
@@ -85,7 +90,7 @@ func TestFailureProducer_ListenForFailuresWithProducerError(t *testing.T) {
 	sp := saramatest.NewMockSyncProducer()
 	sp.ReturnErrorOnSend()
 	fch := make(chan model.Failure, 10)
-	prod := newKafkaFailureProducer(sp, fch, log.NullLogger{})
+	prod := newKafkaFailureProducer(newTestConfig(), sp, fch, log.NullLogger{})
 
 	prod.listenForFailures(ctx, &sync.WaitGroup{})
 
@@ -99,3 +104,127 @@ func TestFailureProducer_ListenForFailuresWithProducerError(t *testing.T) {
 	<-time.After(time.Millisecond * 5)
 	cancel()
 }
+
+func TestFailureProducer_RecordsDeadLetteredMetric(t *testing.T) {
+	prod := newKafkaFailureProducer(newTestConfig(), saramatest.NewMockSyncProducer(), make(chan model.Failure), log.NullLogger{})
+
+	labels := map[string]string{"topic": "product", "stage": "retry1"}
+	before := metricValue(t, "kafka_consumer_messages_dead_lettered_total", labels)
+
+	prod.publishFailure(model.Failure{
+		Topic:     "retry.kafkaGroup.product",
+		NextTopic: "deadLetter.kafkaGroup.product",
+		Message:   []byte("hello"),
+	})
+
+	if got := metricValue(t, "kafka_consumer_messages_dead_lettered_total", labels); got != before+1 {
+		t.Errorf("expected %v dead-lettered messages, but got %v", before+1, got)
+	}
+}
+
+func TestFailureProducer_PreservesKeyAndHeaders(t *testing.T) {
+	sp := saramatest.NewMockSyncProducer()
+	prod := newKafkaFailureProducer(newTestConfig(), sp, make(chan model.Failure), log.NullLogger{})
+
+	prod.publishFailure(model.Failure{
+		Reason:         "something bad happened",
+		Topic:          "product",
+		NextTopic:      "retry.kafkaGroup.product",
+		Message:        []byte("hello"),
+		MessageKey:     []byte("SKU-123"),
+		MessageHeaders: []byte(`{"foo":"bar"}`),
+		KafkaPartition: 1,
+		KafkaOffset:    20,
+	})
+	prod.publishFailure(model.Failure{
+		Topic:     "product",
+		NextTopic: "retry.kafkaGroup.product",
+		Message:   []byte("no key"),
+	})
+
+	msgs := sp.GetMessagesReceived("retry.kafkaGroup.product")
+	if len(msgs) != 2 {
+		t.Fatalf("expected 2 messages to be published, but got %d", len(msgs))
+	}
+
+	if key, _ := msgs[0].Key.Encode(); string(key) != "SKU-123" {
+		t.Errorf("expected the message key to be preserved, but got '%s'", key)
+	}
+	headers := map[string]string{}
+	for _, h := range msgs[0].Headers {
+		headers[string(h.Key)] = string(h.Value)
+	}
+	for k, v := range map[string]string{"foo": "bar", HeaderOriginalTopic: "product", HeaderOriginalPartition: "1", HeaderOriginalOffset: "20", HeaderAttempts: "1", HeaderFailureReason: "something bad happened"} {
+		if headers[k] != v {
+			t.Errorf("expected header '%s' to be '%s', but got '%s'", k, v, headers[k])
+		}
+	}
+	if _, err := time.Parse(time.RFC3339Nano, headers[HeaderFirstFailureAt]); err != nil {
+		t.Errorf("expected a first failure time header, but got '%s'", headers[HeaderFirstFailureAt])
+	}
+
+	if msgs[1].Key != nil {
+		t.Error("expected no key to be set for a message without one")
+	}
+}
+
+func TestFailureProducer_SetsDueTime(t *testing.T) {
+	sp := saramatest.NewMockSyncProducer()
+	prod := newKafkaFailureProducer(newTestConfig(), sp, make(chan model.Failure), log.NullLogger{})
+
+	dueAt := func(msg *sarama.ProducerMessage) (time.Time, bool) {
+		for _, h := range msg.Headers {
+			if string(h.Key) == HeaderDueAt {
+				return model.DueAtFromHeader(string(h.Value))
+			}
+		}
+		return time.Time{}, false
+	}
+
+	start := time.Now()
+	prod.publishFailure(model.Failure{Topic: "product", NextTopic: "retry.kafkaGroup.product", RetryAfter: time.Minute})
+	prod.publishFailure(model.Failure{Topic: "retry.kafkaGroup.product", NextTopic: "deadLetter.kafkaGroup.product"})
+
+	due, ok := dueAt(sp.GetMessagesReceived("retry.kafkaGroup.product")[0])
+	if !ok || due.Before(start.Add(time.Minute)) || due.After(time.Now().Add(time.Minute)) {
+		t.Errorf("expected the retry to be due in 1m, but got %s (%v)", due, ok)
+	}
+	if _, ok := dueAt(sp.GetMessagesReceived("deadLetter.kafkaGroup.product")[0]); ok {
+		t.Error("expected no due time for a dead-lettered message")
+	}
+}
+
+func TestFailureProducer_SetsDueTimeOfRetryInSharedTopic(t *testing.T) {
+	cfg, err := config.NewBuilder().
+		SetKafkaHost([]string{"localhost"}).
+		SetKafkaGroup("kafkaGroup").
+		SetSourceTopics([]string{"product"}).
+		SetRetryPolicy("product", config.RetryPolicy{MaxAttempts: 12, Backoff: &config.Backoff{Initial: time.Second}}).
+		Config()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	sp := saramatest.NewMockSyncProducer()
+	prod := newKafkaFailureProducer(cfg, sp, make(chan model.Failure), log.NullLogger{})
+
+	// the sixth retry shares the fifth retry topic, which has a delay of 16s, but is due after its own delay of 32s
+	start := time.Now()
+	prod.publishFailure(model.Failure{
+		Topic:          "retry5.kafkaGroup.product",
+		NextTopic:      "retry5.kafkaGroup.product",
+		MessageHeaders: []byte(`{"x-attempts":"5"}`),
+	})
+
+	for _, h := range sp.GetMessagesReceived("retry5.kafkaGroup.product")[0].Headers {
+		if string(h.Key) != HeaderDueAt {
+			continue
+		}
+		due, _ := model.DueAtFromHeader(string(h.Value))
+		if due.Before(start.Add(time.Second*32)) || due.After(time.Now().Add(time.Second*32)) {
+			t.Errorf("expected the retry to be due in 32s, but got %s", due)
+		}
+		return
+	}
+	t.Error("expected a due time to be set")
+}
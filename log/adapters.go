@@ -0,0 +1,60 @@
+package log
+
+// KeyValueLogger is a logger that accepts alternating keys and values with each message. It is
+// satisfied by *zap.SugaredLogger from go.uber.org/zap.
+type KeyValueLogger interface {
+	Debugw(msg string, keysAndValues ...interface{})
+	Infow(msg string, keysAndValues ...interface{})
+	Errorw(msg string, keysAndValues ...interface{})
+}
+
+// FromKeyValueLogger returns a StructuredLogger that writes to a KeyValueLogger.
+func FromKeyValueLogger(l KeyValueLogger) StructuredLogger {
+	return keyValueAdapter{l: l}
+}
+
+type keyValueAdapter struct {
+	l KeyValueLogger
+}
+
+func (a keyValueAdapter) Log(level Level, msg string, fields ...Field) {
+	kvs := keyValues(fields)
+
+	switch {
+	case level >= LevelError:
+		a.l.Errorw(msg, kvs...)
+	case level == LevelInfo:
+		a.l.Infow(msg, kvs...)
+	default:
+		a.l.Debugw(msg, kvs...)
+	}
+}
+
+// KitLogger is a logger that accepts alternating keys and values. It is satisfied by the
+// log.Logger from github.com/go-kit/log.
+type KitLogger interface {
+	Log(keyvals ...interface{}) error
+}
+
+// FromKitLogger returns a StructuredLogger that writes to a KitLogger. The level and message
+// are written with the "level" and "msg" keys.
+func FromKitLogger(l KitLogger) StructuredLogger {
+	return kitAdapter{l: l}
+}
+
+type kitAdapter struct {
+	l KitLogger
+}
+
+func (a kitAdapter) Log(level Level, msg string, fields ...Field) {
+	_ = a.l.Log(append([]interface{}{"level", level.String(), "msg", msg}, keyValues(fields)...)...)
+}
+
+func keyValues(fields []Field) []interface{} {
+	kvs := make([]interface{}, 0, len(fields)*2)
+	for _, f := range fields {
+		kvs = append(kvs, f.Key, fieldValue(f.Value))
+	}
+
+	return kvs
+}
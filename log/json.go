@@ -0,0 +1,51 @@
+package log
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// JSONLogger writes each log entry as a JSON object on its own line, with the "time", "level"
+// and "msg" keys followed by the fields of the entry.
+type JSONLogger struct {
+	mu    sync.Mutex
+	w     io.Writer
+	level Level
+	now   func() time.Time
+}
+
+// NewJSONLogger returns a JSONLogger that writes entries at or above the given level to w.
+func NewJSONLogger(w io.Writer, level Level) *JSONLogger {
+	return &JSONLogger{w: w, level: level, now: time.Now}
+}
+
+// NewJSONStdOutLogger returns a JSONLogger that writes entries at or above the given level to stdout.
+func NewJSONStdOutLogger(level Level) *JSONLogger {
+	return NewJSONLogger(os.Stdout, level)
+}
+
+func (j *JSONLogger) Log(level Level, msg string, fields ...Field) {
+	if level < j.level {
+		return
+	}
+
+	entry := make(map[string]interface{}, len(fields)+3)
+	for _, f := range fields {
+		entry[f.Key] = fieldValue(f.Value)
+	}
+	entry["time"] = j.now().UTC().Format(time.RFC3339Nano)
+	entry["level"] = level.String()
+	entry["msg"] = msg
+
+	b, err := json.Marshal(entry)
+	if err != nil {
+		b, _ = json.Marshal(map[string]string{"level": LevelError.String(), "msg": "unable to encode log entry: " + err.Error()})
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	_, _ = j.w.Write(append(b, '\n'))
+}
@@ -22,3 +22,6 @@ func (n NullLogger) Infof(format string, args ...interface{}) {
 
 func (n NullLogger) Panic(args ...interface{}) {
 }
+
+func (n NullLogger) Log(level Level, msg string, fields ...Field) {
+}
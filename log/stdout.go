@@ -5,13 +5,23 @@ import (
 	"log"
 )
 
-type StdOutLogger struct{}
+// StdOutLogger writes log entries to stdout. Entries below Level are not written, and the
+// zero value writes all entries.
+type StdOutLogger struct {
+	Level Level
+}
 
 func (s StdOutLogger) Debugf(format string, args ...interface{}) {
+	if s.Level > LevelDebug {
+		return
+	}
 	fmt.Println("[DEBUG]: ", fmt.Sprintf(format, args...))
 }
 
 func (s StdOutLogger) Debug(args ...interface{}) {
+	if s.Level > LevelDebug {
+		return
+	}
 	fmt.Println("[DEBUG]: ", args)
 }
 
@@ -24,13 +34,34 @@ func (s StdOutLogger) Errorf(format string, args ...interface{}) {
 }
 
 func (s StdOutLogger) Info(args ...interface{}) {
+	if s.Level > LevelInfo {
+		return
+	}
 	fmt.Println("[INFO]: ", args)
 }
 
 func (s StdOutLogger) Infof(format string, args ...interface{}) {
+	if s.Level > LevelInfo {
+		return
+	}
 	fmt.Println("[INFO]: ", fmt.Sprintf(format, args...))
 }
 
 func (s StdOutLogger) Panic(args ...interface{}) {
 	log.Panic(args...)
 }
+
+func (s StdOutLogger) Log(level Level, msg string, fields ...Field) {
+	if level < s.Level {
+		return
+	}
+
+	switch {
+	case level >= LevelError:
+		fmt.Println("[ERROR]: ", formatLine(msg, fields))
+	case level == LevelInfo:
+		fmt.Println("[INFO]: ", formatLine(msg, fields))
+	default:
+		fmt.Println("[DEBUG]: ", formatLine(msg, fields))
+	}
+}
@@ -0,0 +1,165 @@
+package log
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Level is the severity of a log entry.
+type Level int
+
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelError
+)
+
+func (l Level) String() string {
+	switch l {
+	case LevelDebug:
+		return "debug"
+	case LevelInfo:
+		return "info"
+	case LevelError:
+		return "error"
+	default:
+		return fmt.Sprintf("level(%d)", int(l))
+	}
+}
+
+// Field is a key/value pair that is attached to a log entry.
+type Field struct {
+	Key   string
+	Value interface{}
+}
+
+// F returns a Field with the given key and value.
+func F(key string, value interface{}) Field {
+	return Field{Key: key, Value: value}
+}
+
+// Err returns a Field for the given error, with the key "error".
+func Err(err error) Field {
+	return Field{Key: "error", Value: err}
+}
+
+// StructuredLogger writes log entries with a level, a message and key/value fields. Use the
+// Debug, Info and Error functions in this package to write entries at each level.
+type StructuredLogger interface {
+	Log(level Level, msg string, fields ...Field)
+}
+
+// Debug writes a debug entry to the logger.
+func Debug(l StructuredLogger, msg string, fields ...Field) {
+	l.Log(LevelDebug, msg, fields...)
+}
+
+// Info writes an info entry to the logger.
+func Info(l StructuredLogger, msg string, fields ...Field) {
+	l.Log(LevelInfo, msg, fields...)
+}
+
+// Error writes an error entry to the logger.
+func Error(l StructuredLogger, msg string, fields ...Field) {
+	l.Log(LevelError, msg, fields...)
+}
+
+// With returns a logger that adds the given fields to every entry written to l.
+func With(l StructuredLogger, fields ...Field) StructuredLogger {
+	if len(fields) == 0 {
+		return l
+	}
+
+	return fieldLogger{next: l, fields: fields}
+}
+
+type fieldLogger struct {
+	next   StructuredLogger
+	fields []Field
+}
+
+func (f fieldLogger) Log(level Level, msg string, fields ...Field) {
+	all := make([]Field, 0, len(f.fields)+len(fields))
+	f.next.Log(level, msg, append(append(all, f.fields...), fields...)...)
+}
+
+// WithLevel returns a logger that only writes entries to l that are at least as severe as min.
+func WithLevel(l StructuredLogger, min Level) StructuredLogger {
+	return levelLogger{next: l, min: min}
+}
+
+type levelLogger struct {
+	next StructuredLogger
+	min  Level
+}
+
+func (ll levelLogger) Log(level Level, msg string, fields ...Field) {
+	if level < ll.min {
+		return
+	}
+	ll.next.Log(level, msg, fields...)
+}
+
+// FromLogger returns a StructuredLogger that writes to a printf-style Logger, such as a
+// logrus logger. Fields are appended to the message as key=value pairs. If l is already a
+// StructuredLogger then it is returned unchanged.
+func FromLogger(l Logger) StructuredLogger {
+	if l == nil {
+		return NullLogger{}
+	}
+	if sl, ok := l.(StructuredLogger); ok {
+		return sl
+	}
+
+	return loggerShim{l: l}
+}
+
+type loggerShim struct {
+	l Logger
+}
+
+func (s loggerShim) Log(level Level, msg string, fields ...Field) {
+	line := formatLine(msg, fields)
+
+	switch {
+	case level >= LevelError:
+		s.l.Errorf("%s", line)
+	case level == LevelInfo:
+		s.l.Infof("%s", line)
+	default:
+		s.l.Debugf("%s", line)
+	}
+}
+
+// formatLine renders the message followed by the fields as space separated key=value pairs.
+func formatLine(msg string, fields []Field) string {
+	if len(fields) == 0 {
+		return msg
+	}
+
+	var b strings.Builder
+	b.WriteString(msg)
+	for _, f := range fields {
+		v := fmt.Sprint(fieldValue(f.Value))
+		if strings.ContainsAny(v, " \t\n\"=") {
+			v = fmt.Sprintf("%q", v)
+		}
+		fmt.Fprintf(&b, " %s=%s", f.Key, v)
+	}
+
+	return b.String()
+}
+
+// fieldValue converts values that do not render well, such as errors and byte slices, to strings.
+func fieldValue(v interface{}) interface{} {
+	switch t := v.(type) {
+	case error:
+		return t.Error()
+	case []byte:
+		return string(t)
+	case fmt.Stringer:
+		return t.String()
+	default:
+		return v
+	}
+}
@@ -0,0 +1,191 @@
+package log
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/go-test/deep"
+)
+
+type entry struct {
+	level  Level
+	msg    string
+	fields []Field
+}
+
+type recordingLogger struct {
+	entries []entry
+}
+
+func (r *recordingLogger) Log(level Level, msg string, fields ...Field) {
+	r.entries = append(r.entries, entry{level: level, msg: msg, fields: fields})
+}
+
+type printfLogger struct {
+	lines []string
+}
+
+func (p *printfLogger) Debug(args ...interface{}) {}
+func (p *printfLogger) Error(args ...interface{}) {}
+func (p *printfLogger) Info(args ...interface{})  {}
+func (p *printfLogger) Panic(args ...interface{}) {}
+
+func (p *printfLogger) Debugf(format string, args ...interface{}) {
+	p.lines = append(p.lines, "debug: "+fmt.Sprintf(format, args...))
+}
+
+func (p *printfLogger) Infof(format string, args ...interface{}) {
+	p.lines = append(p.lines, "info: "+fmt.Sprintf(format, args...))
+}
+
+func (p *printfLogger) Errorf(format string, args ...interface{}) {
+	p.lines = append(p.lines, "error: "+fmt.Sprintf(format, args...))
+}
+
+type kvLogger struct {
+	lines [][]interface{}
+}
+
+func (k *kvLogger) Debugw(msg string, keysAndValues ...interface{}) {
+	k.lines = append(k.lines, append([]interface{}{"debug", msg}, keysAndValues...))
+}
+
+func (k *kvLogger) Infow(msg string, keysAndValues ...interface{}) {
+	k.lines = append(k.lines, append([]interface{}{"info", msg}, keysAndValues...))
+}
+
+func (k *kvLogger) Errorw(msg string, keysAndValues ...interface{}) {
+	k.lines = append(k.lines, append([]interface{}{"error", msg}, keysAndValues...))
+}
+
+type kitLogger struct {
+	lines [][]interface{}
+}
+
+func (k *kitLogger) Log(keyvals ...interface{}) error {
+	k.lines = append(k.lines, keyvals)
+	return nil
+}
+
+func TestFromLogger(t *testing.T) {
+	t.Run("fields are appended to the message", func(t *testing.T) {
+		l := &printfLogger{}
+		sl := FromLogger(l)
+
+		Debug(sl, "processing message", F("topic", "product"), F("offset", int64(3)))
+		Info(sl, "started")
+		Error(sl, "failed", F("key", []byte("abc")), Err(errors.New("oh no")))
+
+		exp := []string{
+			"debug: processing message topic=product offset=3",
+			"info: started",
+			`error: failed key=abc error="oh no"`,
+		}
+		if diff := deep.Equal(exp, l.lines); diff != nil {
+			t.Error(diff)
+		}
+	})
+
+	t.Run("structured loggers are returned unchanged", func(t *testing.T) {
+		if _, ok := FromLogger(StdOutLogger{}).(StdOutLogger); !ok {
+			t.Error("expected StdOutLogger to be returned unchanged")
+		}
+	})
+
+	t.Run("nil logger", func(t *testing.T) {
+		if _, ok := FromLogger(nil).(NullLogger); !ok {
+			t.Error("expected a NullLogger for a nil logger")
+		}
+	})
+}
+
+func TestWith(t *testing.T) {
+	l := &recordingLogger{}
+	Info(With(l, F("topic", "product")), "started", F("partition", int32(1)))
+
+	exp := []entry{
+		{level: LevelInfo, msg: "started", fields: []Field{F("topic", "product"), F("partition", int32(1))}},
+	}
+	if diff := deep.Equal(exp, l.entries); diff != nil {
+		t.Error(diff)
+	}
+}
+
+func TestWithLevel(t *testing.T) {
+	l := &recordingLogger{}
+	ll := WithLevel(l, LevelInfo)
+
+	Debug(ll, "hidden")
+	Info(ll, "shown")
+	Error(ll, "also shown")
+
+	if len(l.entries) != 2 {
+		t.Fatalf("expected 2 entries, but got %d", len(l.entries))
+	}
+	if l.entries[0].msg != "shown" || l.entries[1].msg != "also shown" {
+		t.Errorf("unexpected entries: %v", l.entries)
+	}
+}
+
+func TestJSONLogger(t *testing.T) {
+	buf := &bytes.Buffer{}
+	l := NewJSONLogger(buf, LevelInfo)
+	l.now = func() time.Time {
+		return time.Date(2022, 5, 1, 12, 0, 0, 0, time.UTC)
+	}
+
+	Debug(l, "hidden")
+	Error(l, "error processing message", F("topic", "product"), F("partition", int32(2)), F("key", []byte("abc")), Err(errors.New("oops")))
+
+	var got map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatalf("unable to decode log entry %q: %s", buf.String(), err)
+	}
+
+	exp := map[string]interface{}{
+		"time":      "2022-05-01T12:00:00Z",
+		"level":     "error",
+		"msg":       "error processing message",
+		"topic":     "product",
+		"partition": float64(2),
+		"key":       "abc",
+		"error":     "oops",
+	}
+	if diff := deep.Equal(exp, got); diff != nil {
+		t.Error(diff)
+	}
+}
+
+func TestFromKeyValueLogger(t *testing.T) {
+	l := &kvLogger{}
+	sl := FromKeyValueLogger(l)
+
+	Debug(sl, "one", F("a", 1))
+	Info(sl, "two")
+	Error(sl, "three", Err(errors.New("oops")))
+
+	exp := [][]interface{}{
+		{"debug", "one", "a", 1},
+		{"info", "two"},
+		{"error", "three", "error", "oops"},
+	}
+	if diff := deep.Equal(exp, l.lines); diff != nil {
+		t.Error(diff)
+	}
+}
+
+func TestFromKitLogger(t *testing.T) {
+	l := &kitLogger{}
+	Info(FromKitLogger(l), "started", F("topic", "product"))
+
+	exp := [][]interface{}{
+		{"level", "info", "msg", "started", "topic", "product"},
+	}
+	if diff := deep.Equal(exp, l.lines); diff != nil {
+		t.Error(diff)
+	}
+}
@@ -0,0 +1,72 @@
+package consumer
+
+import (
+	"github.com/Shopify/sarama"
+
+	"github.com/inviqa/kafka-consumer-go/config"
+	failuremodel "github.com/inviqa/kafka-consumer-go/data/failure/model"
+	"github.com/inviqa/kafka-consumer-go/data/retry/model"
+	"github.com/inviqa/kafka-consumer-go/log"
+)
+
+// messageFields returns the log fields that identify a message consumed from Kafka.
+func messageFields(msg *sarama.ConsumerMessage) []log.Field {
+	return []log.Field{
+		log.F("topic", msg.Topic),
+		log.F("partition", msg.Partition),
+		log.F("offset", msg.Offset),
+		log.F("key", msg.Key),
+	}
+}
+
+// messageFields returns the log fields that identify a message consumed from Kafka, including
+// its position in the retry chain.
+func (c *consumer) messageFields(msg *sarama.ConsumerMessage) []log.Field {
+	return append(messageFields(msg), retrySequenceField(c.cfg, msg.Topic))
+}
+
+// batchFields returns the log fields that identify a batch of messages from the same topic.
+func batchFields(msgs []*sarama.ConsumerMessage) []log.Field {
+	fields := []log.Field{log.F("batch_size", len(msgs))}
+	if len(msgs) > 0 {
+		fields = append([]log.Field{log.F("topic", msgs[0].Topic)}, fields...)
+	}
+	return fields
+}
+
+// claimFields returns the log fields that identify the partition of a claim.
+func claimFields(claim sarama.ConsumerGroupClaim) []log.Field {
+	return []log.Field{
+		log.F("topic", claim.Topic()),
+		log.F("partition", claim.Partition()),
+	}
+}
+
+// retryFields returns the log fields that identify a message being retried from the database.
+func retryFields(msg model.Retry, stage string) []log.Field {
+	return []log.Field{
+		log.F("topic", msg.Topic),
+		log.F("partition", msg.KafkaPartition),
+		log.F("offset", msg.KafkaOffset),
+		log.F("key", msg.PayloadKey),
+		log.F("retry_sequence", msg.Attempts),
+		log.F("stage", stage),
+	}
+}
+
+// failureFields returns the log fields that identify a failed message being published for retry.
+func failureFields(cfg *config.Config, f failuremodel.Failure) []log.Field {
+	return []log.Field{
+		log.F("topic", f.Topic),
+		log.F("partition", f.KafkaPartition),
+		log.F("offset", f.KafkaOffset),
+		log.F("key", f.MessageKey),
+		retrySequenceField(cfg, f.Topic),
+		log.F("next_topic", f.NextTopic),
+	}
+}
+
+func retrySequenceField(cfg *config.Config, topicName string) log.Field {
+	seq, _ := cfg.RetrySequence(topicName)
+	return log.F("retry_sequence", seq)
+}
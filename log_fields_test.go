@@ -0,0 +1,63 @@
+package consumer
+
+import (
+	"testing"
+
+	"github.com/Shopify/sarama"
+	"github.com/go-test/deep"
+
+	"github.com/inviqa/kafka-consumer-go/data/failure/model"
+	"github.com/inviqa/kafka-consumer-go/log"
+)
+
+type logEntry struct {
+	level  log.Level
+	msg    string
+	fields []log.Field
+}
+
+type recordingLogger struct {
+	entries []logEntry
+}
+
+func (r *recordingLogger) Log(level log.Level, msg string, fields ...log.Field) {
+	r.entries = append(r.entries, logEntry{level: level, msg: msg, fields: fields})
+}
+
+func TestConsumer_MessageFields(t *testing.T) {
+	c := &consumer{cfg: newTestConfig()}
+	msg := &sarama.ConsumerMessage{Topic: "retry.kafkaGroup.product", Partition: 2, Offset: 10, Key: []byte("abc")}
+
+	exp := []log.Field{
+		log.F("topic", "retry.kafkaGroup.product"),
+		log.F("partition", int32(2)),
+		log.F("offset", int64(10)),
+		log.F("key", []byte("abc")),
+		log.F("retry_sequence", uint8(1)),
+	}
+	if diff := deep.Equal(exp, c.messageFields(msg)); diff != nil {
+		t.Error(diff)
+	}
+}
+
+func TestFailureFields(t *testing.T) {
+	f := model.Failure{
+		Topic:          "product",
+		NextTopic:      "retry.kafkaGroup.product",
+		MessageKey:     []byte("abc"),
+		KafkaPartition: 1,
+		KafkaOffset:    5,
+	}
+
+	exp := []log.Field{
+		log.F("topic", "product"),
+		log.F("partition", int32(1)),
+		log.F("offset", int64(5)),
+		log.F("key", []byte("abc")),
+		log.F("retry_sequence", uint8(0)),
+		log.F("next_topic", "retry.kafkaGroup.product"),
+	}
+	if diff := deep.Equal(exp, failureFields(newTestConfig(), f)); diff != nil {
+		t.Error(diff)
+	}
+}
@@ -0,0 +1,22 @@
+package consumer
+
+import (
+	"errors"
+
+	"github.com/inviqa/kafka-consumer-go/config"
+	"github.com/inviqa/kafka-consumer-go/prometheus"
+)
+
+// metricLabels returns the main topic and retry stage labels used for the processing metrics
+// of a message from the given topic.
+func metricLabels(cfg *config.Config, topicName string) (topic, stage string) {
+	return string(cfg.FindTopicKey(topicName)), cfg.TopicStage(topicName)
+}
+
+// incHandlerPanics counts err in the handler panics metric if it was recovered from a panic.
+func incHandlerPanics(topic, stage string, err error) {
+	var pe *PanicError
+	if errors.As(err, &pe) {
+		prometheus.IncHandlerPanics(topic, stage)
+	}
+}
@@ -0,0 +1,66 @@
+package consumer
+
+import (
+	"testing"
+
+	prom "github.com/prometheus/client_golang/prometheus"
+
+	"github.com/inviqa/kafka-consumer-go/prometheus"
+)
+
+// testMetrics is the registry that the consumer metrics are registered with for these tests.
+var testMetrics = prom.NewRegistry()
+
+func init() {
+	if err := prometheus.RegisterConsumerMetrics(testMetrics); err != nil {
+		panic(err)
+	}
+}
+
+func TestMetricLabels(t *testing.T) {
+	cfg := newTestConfig()
+
+	tests := map[string][2]string{
+		"product":                       {"product", "main"},
+		"retry.kafkaGroup.product":      {"product", "retry1"},
+		"deadLetter.kafkaGroup.product": {"product", "deadletter"},
+	}
+
+	for topicName, exp := range tests {
+		topic, stage := metricLabels(cfg, topicName)
+		if topic != exp[0] || stage != exp[1] {
+			t.Errorf("expected labels %v for '%s', but got [%s %s]", exp, topicName, topic, stage)
+		}
+	}
+}
+
+// counterValue returns the current value of the counter with the given name and labels from
+// the test registry, or 0 if it has not been recorded yet.
+func metricValue(t *testing.T, name string, labels map[string]string) float64 {
+	t.Helper()
+
+	mfs, err := testMetrics.Gather()
+	if err != nil {
+		t.Fatalf("unexpected error gathering metrics: %s", err)
+	}
+
+	for _, mf := range mfs {
+		if mf.GetName() != name {
+			continue
+		}
+	metrics:
+		for _, m := range mf.GetMetric() {
+			for _, lp := range m.GetLabel() {
+				if labels[lp.GetName()] != lp.GetValue() {
+					continue metrics
+				}
+			}
+			if m.GetGauge() != nil {
+				return m.GetGauge().GetValue()
+			}
+			return m.GetCounter().GetValue()
+		}
+	}
+
+	return 0
+}
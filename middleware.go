@@ -0,0 +1,120 @@
+package consumer
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+	"time"
+
+	"github.com/Shopify/sarama"
+
+	"github.com/inviqa/kafka-consumer-go/log"
+)
+
+// Middleware wraps a Handler to add behaviour around the processing of each message, such as
+// logging or tracing. Middleware registered with WithMiddleware is applied to every handler
+// in the HandlerMap, so it runs for messages from the main topics, the Kafka retry topics
+// and the DB retry processors alike.
+type Middleware func(Handler) Handler
+
+// PanicError is returned in place of a panic in a handler, so that the message is sent for retry.
+// The stack trace of the panic is kept in Stack, rather than in the error message, so that it is
+// not copied into the failure reason of every retry. It is logged once, when the panic is recovered.
+type PanicError struct {
+	Value interface{}
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("consumer: handler panicked: %v", e.Value)
+}
+
+func newPanicError(r interface{}) *PanicError {
+	return &PanicError{Value: r, Stack: debug.Stack()}
+}
+
+// logPanic logs a recovered panic along with its stack trace.
+func logPanic(logger log.StructuredLogger, pe *PanicError, fields []log.Field) {
+	log.Error(logger, "recovered from panic in handler", append(fields, log.F("stack", string(pe.Stack)), log.Err(pe))...)
+}
+
+// WithMiddleware registers middleware to apply to every handler. The first middleware given
+// is the outermost, so it is the first to see each message. It is not applied to batch
+// handlers, use WithBatchMiddleware for those.
+func WithMiddleware(mws ...Middleware) Option {
+	return func(o *options) {
+		o.middleware = append(o.middleware, mws...)
+	}
+}
+
+// Recovery returns a middleware that recovers from a panic in the handler, logs it with its
+// stack trace, and returns it as a *PanicError so that the message is sent for retry. A
+// log.Logger can be passed to it with log.FromLogger.
+func Recovery(logger log.StructuredLogger) Middleware {
+	if logger == nil {
+		logger = log.NullLogger{}
+	}
+
+	return func(next Handler) Handler {
+		return func(ctx context.Context, msg *sarama.ConsumerMessage) (err error) {
+			defer func() {
+				if r := recover(); r != nil {
+					pe := newPanicError(r)
+					logPanic(logger, pe, messageFields(msg))
+					err = pe
+				}
+			}()
+
+			return next(ctx, msg)
+		}
+	}
+}
+
+// Timeout returns a middleware that cancels the context passed to the handler once the
+// given duration has elapsed.
+func Timeout(d time.Duration) Middleware {
+	return func(next Handler) Handler {
+		return func(ctx context.Context, msg *sarama.ConsumerMessage) error {
+			ctx, cancel := context.WithTimeout(ctx, d)
+			defer cancel()
+
+			return next(ctx, msg)
+		}
+	}
+}
+
+// Logging returns a middleware that logs the outcome and duration of each handler call.
+func Logging(logger log.Logger) Middleware {
+	return StructuredLogging(log.FromLogger(logger))
+}
+
+// StructuredLogging returns a middleware that logs the outcome and duration of each handler
+// call, with the topic, partition, offset and key of the message as fields.
+func StructuredLogging(logger log.StructuredLogger) Middleware {
+	if logger == nil {
+		logger = log.NullLogger{}
+	}
+
+	return func(next Handler) Handler {
+		return func(ctx context.Context, msg *sarama.ConsumerMessage) error {
+			start := time.Now()
+			err := next(ctx, msg)
+			fields := append(messageFields(msg), log.F("duration", time.Since(start)))
+
+			if err != nil {
+				log.Error(logger, "error handling message", append(fields, log.Err(err))...)
+				return err
+			}
+
+			log.Debug(logger, "handled message", fields...)
+			return nil
+		}
+	}
+}
+
+func applyMiddleware(h Handler, mws []Middleware) Handler {
+	for i := len(mws) - 1; i >= 0; i-- {
+		h = mws[i](h)
+	}
+	return h
+}
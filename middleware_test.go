@@ -0,0 +1,157 @@
+package consumer
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/go-test/deep"
+
+	"github.com/inviqa/kafka-consumer-go/log"
+)
+
+func TestHandlerMap_WithMiddleware(t *testing.T) {
+	var calls []string
+	mw := func(name string) Middleware {
+		return func(next Handler) Handler {
+			return func(ctx context.Context, msg *sarama.ConsumerMessage) error {
+				calls = append(calls, name)
+				return next(ctx, msg)
+			}
+		}
+	}
+
+	hm := HandlerMap{
+		"product": func(ctx context.Context, msg *sarama.ConsumerMessage) error {
+			calls = append(calls, "handler")
+			return nil
+		},
+	}
+
+	wrapped := hm.withMiddleware([]Middleware{mw("first"), mw("second")})
+	if err := wrapped["product"](context.Background(), &sarama.ConsumerMessage{}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if diff := deep.Equal([]string{"first", "second", "handler"}, calls); diff != nil {
+		t.Error(diff)
+	}
+
+	calls = nil
+	if err := hm["product"](context.Background(), &sarama.ConsumerMessage{}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if diff := deep.Equal([]string{"handler"}, calls); diff != nil {
+		t.Errorf("original handler map was modified: %v", diff)
+	}
+}
+
+func TestRecovery(t *testing.T) {
+	t.Run("panic is returned as an error", func(t *testing.T) {
+		h := Recovery(log.NullLogger{})(func(ctx context.Context, msg *sarama.ConsumerMessage) error {
+			panic("something bad happened")
+		})
+
+		err := h(context.Background(), &sarama.ConsumerMessage{})
+
+		var pe *PanicError
+		if !errors.As(err, &pe) {
+			t.Fatalf("expected a *PanicError, but got %#v", err)
+		}
+
+		if pe.Value != "something bad happened" {
+			t.Errorf("unexpected panic value: %v", pe.Value)
+		}
+
+		if !strings.Contains(string(pe.Stack), "middleware_test.go") {
+			t.Error("expected the stack trace to include the panicking handler")
+		}
+		if err.Error() != "consumer: handler panicked: something bad happened" {
+			t.Errorf("unexpected error message: %s", err)
+		}
+	})
+
+	t.Run("panic is logged once with its stack trace", func(t *testing.T) {
+		l := &recordingLogger{}
+		h := Recovery(l)(func(ctx context.Context, msg *sarama.ConsumerMessage) error {
+			panic("something bad happened")
+		})
+
+		if err := callHandler(context.Background(), log.NullLogger{}, h, &sarama.ConsumerMessage{Topic: "product"}); err == nil {
+			t.Fatal("expected an error, but got nil")
+		}
+
+		if len(l.entries) != 1 {
+			t.Fatalf("expected the panic to be logged once, but got %d log entries", len(l.entries))
+		}
+
+		got := map[string]interface{}{}
+		for _, f := range l.entries[0].fields {
+			got[f.Key] = f.Value
+		}
+		if got["topic"] != "product" || !strings.Contains(got["stack"].(string), "middleware_test.go") {
+			t.Errorf("expected the message and stack trace to be logged, but got: %v", got)
+		}
+	})
+
+	t.Run("errors are passed through", func(t *testing.T) {
+		exp := errors.New("oops")
+		h := Recovery(log.NullLogger{})(func(ctx context.Context, msg *sarama.ConsumerMessage) error {
+			return exp
+		})
+
+		if err := h(context.Background(), &sarama.ConsumerMessage{}); err != exp {
+			t.Errorf("expected error %v, but got %v", exp, err)
+		}
+	})
+}
+
+func TestTimeout(t *testing.T) {
+	h := Timeout(time.Millisecond)(func(ctx context.Context, msg *sarama.ConsumerMessage) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	if err := h(context.Background(), &sarama.ConsumerMessage{}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected context.DeadlineExceeded, but got %v", err)
+	}
+}
+
+func TestLogging(t *testing.T) {
+	exp := errors.New("oops")
+	h := Logging(log.NullLogger{})(func(ctx context.Context, msg *sarama.ConsumerMessage) error {
+		return exp
+	})
+
+	if err := h(context.Background(), &sarama.ConsumerMessage{}); err != exp {
+		t.Errorf("expected error %v, but got %v", exp, err)
+	}
+}
+
+func TestStructuredLogging(t *testing.T) {
+	l := &recordingLogger{}
+	exp := errors.New("oops")
+	h := StructuredLogging(l)(func(ctx context.Context, msg *sarama.ConsumerMessage) error {
+		return exp
+	})
+
+	_ = h(context.Background(), &sarama.ConsumerMessage{Topic: "product", Partition: 1, Offset: 2, Key: []byte("abc")})
+
+	if len(l.entries) != 1 {
+		t.Fatalf("expected 1 log entry, but got %d", len(l.entries))
+	}
+
+	got := map[string]interface{}{}
+	for _, f := range l.entries[0].fields {
+		got[f.Key] = f.Value
+	}
+	if l.entries[0].level != log.LevelError {
+		t.Errorf("expected an error entry, but got %s", l.entries[0].level)
+	}
+	if got["topic"] != "product" || got["partition"] != int32(1) || got["offset"] != int64(2) || got["error"] != exp {
+		t.Errorf("unexpected log fields: %v", got)
+	}
+}
@@ -43,5 +43,7 @@ func (m *mockFailureProducer) lastReceivedFailure() *model.Failure {
 }
 
 func (m *mockFailureProducer) numberOfReceivedFailures() int {
+	m.Lock()
+	defer m.Unlock()
 	return m.failureRecvdCount
 }
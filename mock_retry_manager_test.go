@@ -3,6 +3,8 @@ package consumer
 import (
 	"context"
 	"errors"
+	"sync"
+	"testing"
 	"time"
 
 	failuremodel "github.com/inviqa/kafka-consumer-go/data/failure/model"
@@ -10,17 +12,21 @@ import (
 )
 
 type mockRetryManager struct {
+	sync.Mutex
 	// indexed by topic name
 	recvdFailures             map[string][]failuremodel.Failure
 	willErrorOnPublishFailure bool
 	willErrorOnGetBatch       bool
 	retryErrored              bool
 	retrySuccessful           bool
+	retryDiscarded            bool
 	runMaintenanceCallCount   int
 }
 
 // GetBatch will return in-memory received failures as retries
 func (mr *mockRetryManager) GetBatch(ctx context.Context, topic string, sequence uint8, interval time.Duration) ([]model.Retry, error) {
+	mr.Lock()
+	defer mr.Unlock()
 	if mr.willErrorOnGetBatch {
 		return nil, errors.New("oops")
 	}
@@ -46,16 +52,29 @@ func (mr *mockRetryManager) GetBatch(ctx context.Context, topic string, sequence
 }
 
 func (mr *mockRetryManager) MarkSuccessful(ctx context.Context, retry model.Retry) error {
+	mr.Lock()
+	defer mr.Unlock()
 	mr.retrySuccessful = true
 	return nil
 }
 
 func (mr *mockRetryManager) MarkErrored(ctx context.Context, retry model.Retry, err error) error {
+	mr.Lock()
+	defer mr.Unlock()
 	mr.retryErrored = true
 	return nil
 }
 
+func (mr *mockRetryManager) Discard(ctx context.Context, retry model.Retry) error {
+	mr.Lock()
+	defer mr.Unlock()
+	mr.retryDiscarded = true
+	return nil
+}
+
 func (mr *mockRetryManager) PublishFailure(ctx context.Context, f failuremodel.Failure) error {
+	mr.Lock()
+	defer mr.Unlock()
 	if mr.willErrorOnPublishFailure {
 		return errors.New("oops")
 	}
@@ -75,7 +94,29 @@ func newMockRetryManager(willError bool) *mockRetryManager {
 	}
 }
 
+// waitFor waits until cond, which is called with the mock locked, returns true, so that tests
+// can stop the consumer once it has done what they expect, rather than after a fixed time.
+func (mr *mockRetryManager) waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(time.Second * 5)
+	for {
+		mr.Lock()
+		ok := cond()
+		mr.Unlock()
+		if ok {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for the retry manager")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
 func (mr *mockRetryManager) getPublishedFailureCountByTopic(topic string) int {
+	mr.Lock()
+	defer mr.Unlock()
 	f, ok := mr.recvdFailures[topic]
 	if !ok {
 		return 0
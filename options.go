@@ -0,0 +1,104 @@
+package consumer
+
+import (
+	"time"
+
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/inviqa/kafka-consumer-go/log"
+)
+
+var (
+	defaultBatchSize          = 100
+	defaultBatchFlushInterval = time.Second * 1
+)
+
+// Option configures optional behaviour of the consumer, and can be passed to Start.
+type Option func(*options)
+
+type options struct {
+	logger             log.StructuredLogger
+	batchHandlers      BatchHandlerMap
+	batchSize          int
+	batchFlushInterval time.Duration
+	middleware         []Middleware
+	batchMiddleware    []BatchMiddleware
+	defaultHandler     Handler
+	unhandledPolicy    UnhandledPolicy
+	tracerProvider     trace.TracerProvider
+	propagator         propagation.TextMapPropagator
+	rebalanceHooks     RebalanceHooks
+	revokeTimeout      time.Duration
+
+	// status is not configurable, it is shared by the components of a consumer to report their state
+	status *statusTracker
+}
+
+func newOptions(opts ...Option) *options {
+	o := &options{
+		logger:             log.NullLogger{},
+		status:             newStatusTracker(),
+		batchHandlers:      BatchHandlerMap{},
+		batchSize:          defaultBatchSize,
+		batchFlushInterval: defaultBatchFlushInterval,
+		revokeTimeout:      defaultRevokeTimeout,
+	}
+
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	return o
+}
+
+// WithLogger sets the logger used by the consumer. By default, nothing is logged. A printf-style
+// logger does not support fields, so they are appended to each message, see log.FromLogger.
+func WithLogger(l log.Logger) Option {
+	return func(o *options) {
+		if l != nil {
+			o.logger = log.FromLogger(l)
+		}
+	}
+}
+
+// WithStructuredLogger sets the logger used by the consumer. Entries about a message include
+// its topic, partition, offset, retry sequence and key as fields.
+func WithStructuredLogger(l log.StructuredLogger) Option {
+	return func(o *options) {
+		if l != nil {
+			o.logger = l
+		}
+	}
+}
+
+// WithBatchHandlers registers handlers that receive messages in batches of up to maxSize
+// messages, or whatever has been received within flushInterval, whichever comes first. If a
+// topic has both a Handler and a BatchHandler registered then the BatchHandler is used.
+func WithBatchHandlers(hs BatchHandlerMap, maxSize int, flushInterval time.Duration) Option {
+	return func(o *options) {
+		o.batchHandlers = hs
+		if maxSize > 0 {
+			o.batchSize = maxSize
+		}
+		if flushInterval > 0 {
+			o.batchFlushInterval = flushInterval
+		}
+	}
+}
+
+// WithDefaultHandler registers a handler that is used for messages from topics that do not have
+// a handler registered in the HandlerMap.
+func WithDefaultHandler(h Handler) Option {
+	return func(o *options) {
+		o.defaultHandler = h
+	}
+}
+
+// WithUnhandledPolicy sets what happens to messages from topics that have no registered handler,
+// and no default handler. See UnhandledPolicy.
+func WithUnhandledPolicy(p UnhandledPolicy) Option {
+	return func(o *options) {
+		o.unhandledPolicy = p
+	}
+}
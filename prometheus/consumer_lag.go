@@ -0,0 +1,27 @@
+package prometheus
+
+import (
+	"strconv"
+
+	prom "github.com/prometheus/client_golang/prometheus"
+)
+
+var consumerLag = prom.NewGaugeVec(prom.GaugeOpts{
+	Name: "kafka_consumer_lag",
+	Help: "The number of messages in a partition that have not yet been processed by this consumer.",
+}, []string{"topic", "partition"})
+
+// SetConsumerLag sets the lag of the consumer for the given topic and partition. It is called by
+// the consumer each time it finishes processing a message.
+func SetConsumerLag(topic string, partition int32, lag int64) {
+	if lag < 0 {
+		lag = 0
+	}
+	consumerLag.WithLabelValues(topic, strconv.Itoa(int(partition))).Set(float64(lag))
+}
+
+// DeleteConsumerLag removes the lag for the given topic and partition, it is called by the
+// consumer when the partition is no longer assigned to it.
+func DeleteConsumerLag(topic string, partition int32) {
+	consumerLag.DeleteLabelValues(topic, strconv.Itoa(int(partition)))
+}
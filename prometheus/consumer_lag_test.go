@@ -0,0 +1,30 @@
+package prometheus
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestSetConsumerLag(t *testing.T) {
+	SetConsumerLag("product", 2, 10)
+	if got := testutil.ToFloat64(consumerLag.WithLabelValues("product", "2")); got != 10 {
+		t.Errorf("expected lag of 10, but got %v", got)
+	}
+
+	SetConsumerLag("product", 2, -1)
+	if got := testutil.ToFloat64(consumerLag.WithLabelValues("product", "2")); got != 0 {
+		t.Errorf("expected negative lag to be recorded as 0, but got %v", got)
+	}
+}
+
+func TestDeleteConsumerLag(t *testing.T) {
+	SetConsumerLag("price", 0, 5)
+	before := testutil.CollectAndCount(consumerLag)
+
+	DeleteConsumerLag("price", 0)
+
+	if got := testutil.CollectAndCount(consumerLag); got != before-1 {
+		t.Errorf("expected %d lag gauges, but got %d", before-1, got)
+	}
+}
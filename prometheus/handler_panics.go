@@ -0,0 +1,16 @@
+package prometheus
+
+import (
+	prom "github.com/prometheus/client_golang/prometheus"
+)
+
+var handlerPanics = prom.NewCounterVec(prom.CounterOpts{
+	Name: "kafka_consumer_handler_panics_total",
+	Help: "The number of times a handler panicked whilst processing a message.",
+}, processingLabels)
+
+// IncHandlerPanics increments the count of handler panics for the given topic and stage. It is
+// called by the consumer when it recovers from a panic in a handler.
+func IncHandlerPanics(topic, stage string) {
+	handlerPanics.WithLabelValues(topic, stage).Inc()
+}
@@ -0,0 +1,17 @@
+package prometheus
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestIncHandlerPanics(t *testing.T) {
+	before := testutil.ToFloat64(handlerPanics.WithLabelValues("product", "retry1"))
+
+	IncHandlerPanics("product", "retry1")
+
+	if got := testutil.ToFloat64(handlerPanics.WithLabelValues("product", "retry1")); got != before+1 {
+		t.Errorf("expected panic count of %v, but got %v", before+1, got)
+	}
+}
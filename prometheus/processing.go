@@ -0,0 +1,115 @@
+package prometheus
+
+import (
+	"time"
+
+	prom "github.com/prometheus/client_golang/prometheus"
+)
+
+// The processing metrics are labelled by the main topic that a message belongs to, and the
+// stage of the retry chain it is in (see config.Config.TopicStage), e.g. "main" or "retry1".
+var (
+	processingLabels = []string{"topic", "stage"}
+
+	messagesConsumed = prom.NewCounterVec(prom.CounterOpts{
+		Name: "kafka_consumer_messages_consumed_total",
+		Help: "The number of messages consumed from Kafka, or fetched from the database for retry.",
+	}, processingLabels)
+
+	handlerSuccesses = prom.NewCounterVec(prom.CounterOpts{
+		Name: "kafka_consumer_handler_successes_total",
+		Help: "The number of messages that were handled successfully.",
+	}, processingLabels)
+
+	handlerFailures = prom.NewCounterVec(prom.CounterOpts{
+		Name: "kafka_consumer_handler_failures_total",
+		Help: "The number of messages that a handler returned an error for.",
+	}, processingLabels)
+
+	handlerDuration = prom.NewHistogramVec(prom.HistogramOpts{
+		Name:    "kafka_consumer_handler_duration_seconds",
+		Help:    "How long handlers took to process a message, or a batch of messages.",
+		Buckets: prom.DefBuckets,
+	}, processingLabels)
+
+	failuresPublished = prom.NewCounterVec(prom.CounterOpts{
+		Name: "kafka_consumer_failures_published_total",
+		Help: "The number of failed messages published for retry, labelled by the stage they were published to.",
+	}, processingLabels)
+
+	failurePublishErrors = prom.NewCounterVec(prom.CounterOpts{
+		Name: "kafka_consumer_failure_publish_errors_total",
+		Help: "The number of failed messages that could not be published for retry, labelled by the stage they were being published to.",
+	}, processingLabels)
+
+	dbRetriesSucceeded = prom.NewCounterVec(prom.CounterOpts{
+		Name: "kafka_consumer_db_retries_succeeded_total",
+		Help: "The number of retries from the database that were handled successfully.",
+	}, processingLabels)
+
+	dbRetriesErrored = prom.NewCounterVec(prom.CounterOpts{
+		Name: "kafka_consumer_db_retries_errored_total",
+		Help: "The number of retries from the database that failed again.",
+	}, processingLabels)
+
+	deadLettered = prom.NewCounterVec(prom.CounterOpts{
+		Name: "kafka_consumer_messages_dead_lettered_total",
+		Help: "The number of messages that were dead-lettered, labelled by the stage they were dead-lettered from.",
+	}, processingLabels)
+
+	discarded = prom.NewCounterVec(prom.CounterOpts{
+		Name: "kafka_consumer_messages_discarded_total",
+		Help: "The number of messages that were discarded instead of being dead-lettered, labelled by the stage they were discarded from.",
+	}, processingLabels)
+)
+
+// IncMessagesConsumed increments the count of messages consumed for the given topic and stage.
+func IncMessagesConsumed(topic, stage string, count int) {
+	messagesConsumed.WithLabelValues(topic, stage).Add(float64(count))
+}
+
+// IncHandlerSuccesses increments the count of messages handled successfully.
+func IncHandlerSuccesses(topic, stage string, count int) {
+	handlerSuccesses.WithLabelValues(topic, stage).Add(float64(count))
+}
+
+// IncHandlerFailures increments the count of messages that a handler failed to process.
+func IncHandlerFailures(topic, stage string, count int) {
+	handlerFailures.WithLabelValues(topic, stage).Add(float64(count))
+}
+
+// ObserveHandlerDuration records how long a handler call took.
+func ObserveHandlerDuration(topic, stage string, d time.Duration) {
+	handlerDuration.WithLabelValues(topic, stage).Observe(d.Seconds())
+}
+
+// IncFailuresPublished increments the count of failures published to the given stage.
+func IncFailuresPublished(topic, stage string) {
+	failuresPublished.WithLabelValues(topic, stage).Inc()
+}
+
+// IncFailurePublishErrors increments the count of failures that could not be published to the given stage.
+func IncFailurePublishErrors(topic, stage string) {
+	failurePublishErrors.WithLabelValues(topic, stage).Inc()
+}
+
+// IncDBRetriesSucceeded increments the count of retries from the database that succeeded.
+func IncDBRetriesSucceeded(topic, stage string) {
+	dbRetriesSucceeded.WithLabelValues(topic, stage).Inc()
+}
+
+// IncDBRetriesErrored increments the count of retries from the database that errored.
+func IncDBRetriesErrored(topic, stage string) {
+	dbRetriesErrored.WithLabelValues(topic, stage).Inc()
+}
+
+// IncDeadLettered increments the count of messages dead-lettered from the given stage.
+func IncDeadLettered(topic, stage string) {
+	deadLettered.WithLabelValues(topic, stage).Inc()
+}
+
+// IncDiscarded increments the count of messages discarded from the given stage, because their
+// retry policy does not dead-letter them.
+func IncDiscarded(topic, stage string) {
+	discarded.WithLabelValues(topic, stage).Inc()
+}
@@ -0,0 +1,52 @@
+package prometheus
+
+import (
+	"testing"
+	"time"
+
+	prom "github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestProcessingCounters(t *testing.T) {
+	tests := []struct {
+		name    string
+		counter *prom.CounterVec
+		stage   string
+		inc     func()
+		exp     float64
+	}{
+		{"messages consumed", messagesConsumed, "main", func() { IncMessagesConsumed("product", "main", 2) }, 2},
+		{"handler successes", handlerSuccesses, "main", func() { IncHandlerSuccesses("product", "main", 2) }, 2},
+		{"handler failures", handlerFailures, "main", func() { IncHandlerFailures("product", "main", 1) }, 1},
+		{"failures published", failuresPublished, "retry1", func() { IncFailuresPublished("product", "retry1") }, 1},
+		{"failure publish errors", failurePublishErrors, "retry1", func() { IncFailurePublishErrors("product", "retry1") }, 1},
+		{"db retries succeeded", dbRetriesSucceeded, "retry1", func() { IncDBRetriesSucceeded("product", "retry1") }, 1},
+		{"db retries errored", dbRetriesErrored, "retry1", func() { IncDBRetriesErrored("product", "retry1") }, 1},
+		{"dead-lettered", deadLettered, "retry1", func() { IncDeadLettered("product", "retry1") }, 1},
+		{"discarded", discarded, "retry1", func() { IncDiscarded("product", "retry1") }, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := tt.counter.WithLabelValues("product", tt.stage)
+			before := testutil.ToFloat64(c)
+
+			tt.inc()
+
+			if got := testutil.ToFloat64(c); got != before+tt.exp {
+				t.Errorf("expected count of %v, but got %v", before+tt.exp, got)
+			}
+		})
+	}
+}
+
+func TestObserveHandlerDuration(t *testing.T) {
+	before := testutil.CollectAndCount(handlerDuration)
+
+	ObserveHandlerDuration("duration-test", "main", time.Millisecond)
+
+	if got := testutil.CollectAndCount(handlerDuration); got != before+1 {
+		t.Errorf("expected %d histograms, but got %d", before+1, got)
+	}
+}
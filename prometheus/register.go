@@ -0,0 +1,42 @@
+package prometheus
+
+import (
+	"errors"
+	"fmt"
+
+	prom "github.com/prometheus/client_golang/prometheus"
+)
+
+// RegisterConsumerMetrics registers the metrics that the consumer records whilst processing
+// messages with r, e.g. prometheus.DefaultRegisterer. The metrics are not registered with any
+// registry until this is called. Registering them with the same registry again is a no-op.
+func RegisterConsumerMetrics(r prom.Registerer) error {
+	for _, c := range consumerCollectors() {
+		if err := r.Register(c); err != nil {
+			var are prom.AlreadyRegisteredError
+			if errors.As(err, &are) && are.ExistingCollector == c {
+				continue
+			}
+			return fmt.Errorf("prometheus: error registering consumer metrics: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func consumerCollectors() []prom.Collector {
+	return []prom.Collector{
+		messagesConsumed,
+		handlerSuccesses,
+		handlerFailures,
+		handlerDuration,
+		failuresPublished,
+		failurePublishErrors,
+		dbRetriesSucceeded,
+		dbRetriesErrored,
+		deadLettered,
+		discarded,
+		consumerLag,
+		handlerPanics,
+	}
+}
@@ -0,0 +1,53 @@
+package prometheus
+
+import (
+	"testing"
+
+	prom "github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestRegisterConsumerMetrics(t *testing.T) {
+	reg := prom.NewRegistry()
+
+	if err := RegisterConsumerMetrics(reg); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := RegisterConsumerMetrics(reg); err != nil {
+		t.Errorf("unexpected error registering metrics again: %s", err)
+	}
+
+	IncHandlerPanics("register-test", "main")
+
+	got, err := testutil.GatherAndCount(reg, "kafka_consumer_handler_panics_total")
+	if err != nil {
+		t.Fatalf("unexpected error gathering metrics: %s", err)
+	}
+	if got == 0 {
+		t.Errorf("expected handler panics to be gathered from the registry")
+	}
+}
+
+func TestRegisterConsumerMetrics_WithConflictingMetric(t *testing.T) {
+	reg := prom.NewRegistry()
+	reg.MustRegister(prom.NewCounter(prom.CounterOpts{
+		Name: "kafka_consumer_handler_panics_total",
+		Help: "A different metric with the same name.",
+	}))
+
+	if err := RegisterConsumerMetrics(reg); err == nil {
+		t.Errorf("expected an error, but got nil")
+	}
+}
+
+func TestConsumerMetrics_NotRegisteredByDefault(t *testing.T) {
+	IncHandlerPanics("register-test", "main")
+
+	got, err := testutil.GatherAndCount(prom.DefaultGatherer, "kafka_consumer_handler_panics_total")
+	if err != nil {
+		t.Fatalf("unexpected error gathering metrics: %s", err)
+	}
+	if got != 0 {
+		t.Errorf("expected handler panics not to be registered with the default registry")
+	}
+}
@@ -0,0 +1,90 @@
+package consumer
+
+import (
+	"sync"
+	"time"
+)
+
+var defaultRevokeTimeout = time.Second * 30
+
+// RebalanceHook is called with the topics and partitions of a consumer group session, keyed by
+// topic name, when they are assigned to or revoked from this consumer.
+type RebalanceHook func(claims map[string][]int32)
+
+// RebalanceHooks are called when partitions are assigned to, or revoked from, the consumer
+// during a consumer group rebalance. Either hook may be nil.
+type RebalanceHooks struct {
+	// OnPartitionsAssigned is called when a session starts, before any messages are consumed.
+	OnPartitionsAssigned RebalanceHook
+	// OnPartitionsRevoked is called when a session ends, once in-flight messages have finished
+	// processing or the revoke timeout has elapsed, see WithRevokeTimeout.
+	OnPartitionsRevoked RebalanceHook
+}
+
+// WithRebalanceHooks registers hooks that are called when partitions are assigned to, or
+// revoked from, the consumer. This can be used to warm up or flush any per-partition state.
+func WithRebalanceHooks(h RebalanceHooks) Option {
+	return func(o *options) {
+		o.rebalanceHooks = h
+	}
+}
+
+// WithRevokeTimeout sets how long the consumer waits for in-flight messages to finish processing
+// when its partitions are revoked, before calling the OnPartitionsRevoked hook anyway. This
+// should be less than the rebalance timeout in the Sarama config. It defaults to 30 seconds.
+func WithRevokeTimeout(d time.Duration) Option {
+	return func(o *options) {
+		if d > 0 {
+			o.revokeTimeout = d
+		}
+	}
+}
+
+// inFlightCounter counts messages that are being processed, so that a session can wait for
+// them to finish before its partitions are revoked. The zero value is ready to use.
+type inFlightCounter struct {
+	mu   sync.Mutex
+	n    int
+	idle chan struct{}
+}
+
+func (c *inFlightCounter) add() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.n == 0 {
+		c.idle = make(chan struct{})
+	}
+	c.n++
+}
+
+func (c *inFlightCounter) done() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.n--
+	if c.n == 0 {
+		close(c.idle)
+	}
+}
+
+// wait blocks until there are no messages in-flight, returning false if the timeout elapses first.
+func (c *inFlightCounter) wait(timeout time.Duration) bool {
+	c.mu.Lock()
+	if c.n == 0 {
+		c.mu.Unlock()
+		return true
+	}
+	idle := c.idle
+	c.mu.Unlock()
+
+	t := time.NewTimer(timeout)
+	defer t.Stop()
+
+	select {
+	case <-idle:
+		return true
+	case <-t.C:
+		return false
+	}
+}
@@ -0,0 +1,170 @@
+package consumer
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/go-test/deep"
+
+	"github.com/inviqa/kafka-consumer-go/data/failure/model"
+	"github.com/inviqa/kafka-consumer-go/log"
+	"github.com/inviqa/kafka-consumer-go/test/saramatest"
+)
+
+func TestConsumer_RebalanceHooks(t *testing.T) {
+	claims := map[string][]int32{"product": {0, 1}}
+
+	var assigned, revoked map[string][]int32
+	opts := newOptions(WithRebalanceHooks(RebalanceHooks{
+		OnPartitionsAssigned: func(c map[string][]int32) {
+			assigned = c
+		},
+		OnPartitionsRevoked: func(c map[string][]int32) {
+			revoked = c
+		},
+	}))
+	con := newConsumer(make(chan model.Failure), newTestConfig(), HandlerMap{}, log.NullLogger{}, opts)
+	sess := saramatest.NewMockConsumerGroupSession()
+	sess.SetClaims(claims)
+
+	if err := con.Setup(sess); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if diff := deep.Equal(claims, assigned); diff != nil {
+		t.Error(diff)
+	}
+	if revoked != nil {
+		t.Errorf("expected the revoked hook not to be called yet, but got %v", revoked)
+	}
+
+	if err := con.Cleanup(sess); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if diff := deep.Equal(claims, revoked); diff != nil {
+		t.Error(diff)
+	}
+}
+
+func TestConsumer_Cleanup_WaitsForInFlightMessages(t *testing.T) {
+	cfg := newTestConfig()
+	cfg.WorkerCount = 2
+
+	release := make(chan struct{})
+	started := make(chan struct{})
+	hs := HandlerMap{
+		"product": func(ctx context.Context, msg *sarama.ConsumerMessage) error {
+			close(started)
+			<-release
+			return nil
+		},
+	}
+
+	t.Run("it waits for in-flight messages before calling the revoked hook", func(t *testing.T) {
+		var revokedAt time.Time
+		var finishedAt time.Time
+		opts := newOptions(WithRebalanceHooks(RebalanceHooks{
+			OnPartitionsRevoked: func(map[string][]int32) {
+				revokedAt = time.Now()
+			},
+		}))
+		con := newConsumer(make(chan model.Failure), cfg, hs, log.NullLogger{}, opts)
+
+		gs := saramatest.NewMockConsumerGroupSession()
+		gc := saramatest.NewMockConsumerGroupClaim()
+		gc.PublishMessage(&sarama.ConsumerMessage{Topic: "product"})
+		gc.CloseChannel()
+
+		if err := con.ConsumeClaim(gs, gc); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		<-started
+
+		go func() {
+			time.Sleep(time.Millisecond * 20)
+			finishedAt = time.Now()
+			close(release)
+		}()
+
+		if err := con.Cleanup(gs); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if revokedAt.Before(finishedAt) {
+			t.Error("expected the revoked hook to be called after the in-flight message finished")
+		}
+		if len(gs.MarkedMessages()) != 1 {
+			t.Errorf("expected the in-flight message to be marked before cleanup returned, but got %d marked", len(gs.MarkedMessages()))
+		}
+	})
+}
+
+func TestConsumer_Cleanup_RevokeTimeout(t *testing.T) {
+	cfg := newTestConfig()
+	cfg.WorkerCount = 2
+
+	release := make(chan struct{})
+	defer close(release)
+	hs := HandlerMap{
+		"product": func(ctx context.Context, msg *sarama.ConsumerMessage) error {
+			<-release
+			return nil
+		},
+	}
+
+	revoked := false
+	opts := newOptions(WithRevokeTimeout(time.Millisecond*10), WithRebalanceHooks(RebalanceHooks{
+		OnPartitionsRevoked: func(map[string][]int32) {
+			revoked = true
+		},
+	}))
+	con := newConsumer(make(chan model.Failure), cfg, hs, log.NullLogger{}, opts)
+
+	gs := saramatest.NewMockConsumerGroupSession()
+	gc := saramatest.NewMockConsumerGroupClaim()
+	gc.PublishMessage(&sarama.ConsumerMessage{Topic: "product"})
+	gc.CloseChannel()
+
+	if err := con.ConsumeClaim(gs, gc); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		_ = con.Cleanup(gs)
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("cleanup did not return after the revoke timeout")
+	}
+	if !revoked {
+		t.Error("expected the revoked hook to be called after the revoke timeout")
+	}
+}
+
+func TestInFlightCounter(t *testing.T) {
+	c := &inFlightCounter{}
+	if !c.wait(time.Millisecond) {
+		t.Error("expected wait to return true with nothing in-flight")
+	}
+
+	c.add()
+	if c.wait(time.Millisecond) {
+		t.Error("expected wait to time out with a message in-flight")
+	}
+
+	c.done()
+	if !c.wait(time.Millisecond) {
+		t.Error("expected wait to return true once the message is done")
+	}
+
+	// the counter can be reused after becoming idle
+	c.add()
+	c.done()
+	if !c.wait(time.Millisecond) {
+		t.Error("expected wait to return true after reuse")
+	}
+}
@@ -0,0 +1,56 @@
+package redrive
+
+import (
+	"bytes"
+	"time"
+
+	"github.com/Shopify/sarama"
+)
+
+// Filter limits a redrive to the dead-lettered messages that match all of its fields. The zero
+// value matches every message.
+type Filter struct {
+	// From and To limit the redrive to messages that were dead-lettered in this time range,
+	// based on the message timestamp. Either may be zero for an open-ended range.
+	From time.Time
+	To   time.Time
+	// Key, if not nil, limits the redrive to messages with this key.
+	Key []byte
+	// Header, if not nil, limits the redrive to messages whose headers it returns true for.
+	Header func(headers map[string]string) bool
+}
+
+// HeaderEquals returns a header predicate, for use in a Filter, that matches messages with the
+// given header set to value.
+func HeaderEquals(key, value string) func(map[string]string) bool {
+	return func(headers map[string]string) bool {
+		v, ok := headers[key]
+		return ok && v == value
+	}
+}
+
+func (f Filter) matches(msg *sarama.ConsumerMessage) bool {
+	if !f.From.IsZero() && msg.Timestamp.Before(f.From) {
+		return false
+	}
+	if !f.To.IsZero() && msg.Timestamp.After(f.To) {
+		return false
+	}
+	if f.Key != nil && !bytes.Equal(f.Key, msg.Key) {
+		return false
+	}
+	if f.Header != nil && !f.Header(headerMap(msg.Headers)) {
+		return false
+	}
+	return true
+}
+
+func headerMap(headers []*sarama.RecordHeader) map[string]string {
+	hm := make(map[string]string, len(headers))
+	for _, h := range headers {
+		if h != nil {
+			hm[string(h.Key)] = string(h.Value)
+		}
+	}
+	return hm
+}
@@ -0,0 +1,42 @@
+package redrive
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+)
+
+func TestFilter_matches(t *testing.T) {
+	ts := time.Date(2022, 6, 1, 12, 0, 0, 0, time.UTC)
+	msg := &sarama.ConsumerMessage{
+		Key:       []byte("SKU-123"),
+		Timestamp: ts,
+		Headers:   []*sarama.RecordHeader{{Key: []byte("tenant"), Value: []byte("uk")}},
+	}
+
+	tests := []struct {
+		name   string
+		filter Filter
+		want   bool
+	}{
+		{name: "empty filter", filter: Filter{}, want: true},
+		{name: "in time range", filter: Filter{From: ts.Add(-time.Hour), To: ts.Add(time.Hour)}, want: true},
+		{name: "before time range", filter: Filter{From: ts.Add(time.Minute)}, want: false},
+		{name: "after time range", filter: Filter{To: ts.Add(-time.Minute)}, want: false},
+		{name: "matching key", filter: Filter{Key: []byte("SKU-123")}, want: true},
+		{name: "different key", filter: Filter{Key: []byte("SKU-456")}, want: false},
+		{name: "matching header", filter: Filter{Header: HeaderEquals("tenant", "uk")}, want: true},
+		{name: "different header", filter: Filter{Header: HeaderEquals("tenant", "de")}, want: false},
+		{name: "missing header", filter: Filter{Header: HeaderEquals("region", "")}, want: false},
+		{name: "all fields must match", filter: Filter{Key: []byte("SKU-123"), Header: HeaderEquals("tenant", "de")}, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.filter.matches(msg); got != tt.want {
+				t.Errorf("expected matches() to return %v, but got %v", tt.want, got)
+			}
+		})
+	}
+}
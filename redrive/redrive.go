@@ -0,0 +1,270 @@
+// Package redrive republishes messages from a Kafka dead-letter topic to the source topic they
+// originally came from, so that they can be processed again once the cause of their failure
+// has been fixed.
+package redrive
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/Shopify/sarama"
+
+	"github.com/inviqa/kafka-consumer-go/config"
+	"github.com/inviqa/kafka-consumer-go/data/failure/model"
+	"github.com/inviqa/kafka-consumer-go/log"
+)
+
+// Options controls a single redrive.
+type Options struct {
+	// Name identifies the redrive. Its progress is committed under a consumer group derived
+	// from the name, so an interrupted redrive resumes from where it stopped when it is run
+	// again with the same name. Redrives with a different name start from the beginning of
+	// the dead-letter topic.
+	Name string
+	// Filter limits the redrive to the matching messages, all messages are redriven by default.
+	Filter Filter
+	// DryRun previews the redrive, without republishing any messages or committing progress.
+	DryRun bool
+	// OnMatch, if not nil, is called with each message that matches the filter. This can be
+	// used to list the messages that would be redriven in a dry run.
+	OnMatch func(msg *sarama.ConsumerMessage)
+}
+
+// Result reports the outcome of a redrive.
+type Result struct {
+	// Scanned is the number of messages read from the dead-letter topic.
+	Scanned int
+	// Matched is the number of messages that matched the filter.
+	Matched int
+	// Republished is the number of messages that were republished to the source topic, this
+	// is always 0 for a dry run.
+	Republished int
+}
+
+type offsetGetter interface {
+	GetOffset(topic string, partitionID int32, time int64) (int64, error)
+}
+
+// Redriver republishes messages from the dead-letter topics of a consumer's config.
+type Redriver struct {
+	cfg              *config.Config
+	client           offsetGetter
+	consumer         sarama.Consumer
+	producer         sarama.SyncProducer
+	newOffsetManager func(group string) (sarama.OffsetManager, error)
+	logger           log.StructuredLogger
+	closers          []io.Closer
+}
+
+// New creates a Redriver that connects to the Kafka cluster in cfg. Close must be called once
+// it is no longer needed.
+func New(cfg *config.Config, logger log.StructuredLogger) (*Redriver, error) {
+	srmCfg, err := cfg.SaramaConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := sarama.NewClient(cfg.Host, srmCfg)
+	if err != nil {
+		return nil, fmt.Errorf("redrive: error connecting to Kafka: %w", err)
+	}
+
+	consumer, err := sarama.NewConsumerFromClient(client)
+	if err != nil {
+		_ = client.Close()
+		return nil, fmt.Errorf("redrive: error creating Kafka consumer: %w", err)
+	}
+
+	producer, err := sarama.NewSyncProducerFromClient(client)
+	if err != nil {
+		_ = consumer.Close()
+		_ = client.Close()
+		return nil, fmt.Errorf("redrive: error creating Kafka producer: %w", err)
+	}
+
+	r := newRedriver(cfg, client, consumer, producer, func(group string) (sarama.OffsetManager, error) {
+		return sarama.NewOffsetManagerFromClient(group, client)
+	}, logger)
+	r.closers = []io.Closer{producer, consumer, client}
+
+	return r, nil
+}
+
+func newRedriver(
+	cfg *config.Config,
+	client offsetGetter,
+	consumer sarama.Consumer,
+	producer sarama.SyncProducer,
+	newOffsetManager func(group string) (sarama.OffsetManager, error),
+	logger log.StructuredLogger,
+) *Redriver {
+	if logger == nil {
+		logger = log.NullLogger{}
+	}
+
+	return &Redriver{
+		cfg:              cfg,
+		client:           client,
+		consumer:         consumer,
+		producer:         producer,
+		newOffsetManager: newOffsetManager,
+		logger:           logger,
+	}
+}
+
+// Close closes the connections to Kafka.
+func (r *Redriver) Close() error {
+	var errs []error
+	for _, c := range r.closers {
+		if err := c.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("redrive: error closing Kafka connections: %v", errs)
+	}
+	return nil
+}
+
+// Redrive reads the dead-letter topic of sourceTopic, up to the messages that were in it when
+// the redrive started, and republishes the messages that match the filter in opts to
+// sourceTopic. The failure metadata headers added to retried messages (see
+// model.HeaderAttempts) are removed, so that a redriven message goes through the whole retry
+// chain again, but its key and other headers are kept.
+func (r *Redriver) Redrive(ctx context.Context, sourceTopic string, opts Options) (Result, error) {
+	var res Result
+
+	if opts.Name == "" {
+		return res, errors.New("redrive: a name is required")
+	}
+	if r.cfg.TopicStage(sourceTopic) != "main" {
+		return res, fmt.Errorf("redrive: '%s' is not a source topic", sourceTopic)
+	}
+	dlTopic, err := r.cfg.DeadLetterTopicNameInChain(sourceTopic)
+	if err != nil {
+		return res, fmt.Errorf("redrive: %w", err)
+	}
+
+	partitions, err := r.consumer.Partitions(dlTopic)
+	if err != nil {
+		return res, fmt.Errorf("redrive: error getting the partitions of '%s': %w", dlTopic, err)
+	}
+
+	om, err := r.newOffsetManager(groupName(r.cfg.Group, opts.Name))
+	if err != nil {
+		return res, fmt.Errorf("redrive: error creating offset manager: %w", err)
+	}
+	defer func() {
+		om.Commit()
+		if err := om.Close(); err != nil {
+			log.Error(r.logger, "redrive: error closing offset manager", log.Err(err))
+		}
+	}()
+
+	log.Info(r.logger, "redriving dead-lettered messages", log.F("topic", dlTopic), log.F("target_topic", sourceTopic), log.F("name", opts.Name), log.F("dry_run", opts.DryRun))
+	for _, p := range partitions {
+		if err := r.redrivePartition(ctx, dlTopic, sourceTopic, p, om, opts, &res); err != nil {
+			return res, err
+		}
+	}
+	log.Info(r.logger, "finished redriving dead-lettered messages", log.F("topic", dlTopic), log.F("scanned", res.Scanned), log.F("matched", res.Matched), log.F("republished", res.Republished))
+
+	return res, nil
+}
+
+func (r *Redriver) redrivePartition(ctx context.Context, dlTopic, target string, partition int32, om sarama.OffsetManager, opts Options, res *Result) error {
+	end, err := r.client.GetOffset(dlTopic, partition, sarama.OffsetNewest)
+	if err != nil {
+		return fmt.Errorf("redrive: error getting the newest offset of '%s' partition %d: %w", dlTopic, partition, err)
+	}
+
+	pom, err := om.ManagePartition(dlTopic, partition)
+	if err != nil {
+		return fmt.Errorf("redrive: error getting the progress of '%s' partition %d: %w", dlTopic, partition, err)
+	}
+	defer func() {
+		if err := pom.Close(); err != nil {
+			log.Error(r.logger, "redrive: error closing partition offset manager", log.F("topic", dlTopic), log.F("partition", partition), log.Err(err))
+		}
+	}()
+
+	start, _ := pom.NextOffset()
+	if start < 0 {
+		if start, err = r.client.GetOffset(dlTopic, partition, sarama.OffsetOldest); err != nil {
+			return fmt.Errorf("redrive: error getting the oldest offset of '%s' partition %d: %w", dlTopic, partition, err)
+		}
+	}
+	if start >= end {
+		return nil
+	}
+
+	pc, err := r.consumer.ConsumePartition(dlTopic, partition, start)
+	if err != nil {
+		return fmt.Errorf("redrive: error consuming '%s' partition %d: %w", dlTopic, partition, err)
+	}
+	defer pc.AsyncClose()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case cErr := <-pc.Errors():
+			if cErr != nil {
+				return fmt.Errorf("redrive: error consuming '%s' partition %d: %w", dlTopic, partition, cErr)
+			}
+		case msg, ok := <-pc.Messages():
+			if !ok {
+				return nil
+			}
+
+			res.Scanned++
+			if opts.Filter.matches(msg) {
+				res.Matched++
+				if opts.OnMatch != nil {
+					opts.OnMatch(msg)
+				}
+				if !opts.DryRun {
+					if err := r.republish(target, msg); err != nil {
+						return err
+					}
+					res.Republished++
+				}
+			}
+
+			if !opts.DryRun {
+				pom.MarkOffset(msg.Offset+1, "")
+			}
+			if msg.Offset >= end-1 {
+				return nil
+			}
+		}
+	}
+}
+
+func (r *Redriver) republish(target string, msg *sarama.ConsumerMessage) error {
+	pm := &sarama.ProducerMessage{
+		Topic: target,
+		Value: sarama.ByteEncoder(msg.Value),
+	}
+	if len(msg.Key) > 0 {
+		pm.Key = sarama.ByteEncoder(msg.Key)
+	}
+	for _, h := range msg.Headers {
+		if h != nil && !model.IsFailureHeader(string(h.Key)) {
+			pm.Headers = append(pm.Headers, *h)
+		}
+	}
+
+	if _, _, err := r.producer.SendMessage(pm); err != nil {
+		return fmt.Errorf("redrive: error republishing message from '%s' partition %d offset %d: %w", msg.Topic, msg.Partition, msg.Offset, err)
+	}
+	log.Debug(r.logger, "redrove dead-lettered message", log.F("topic", msg.Topic), log.F("partition", msg.Partition), log.F("offset", msg.Offset), log.F("key", msg.Key), log.F("target_topic", target))
+
+	return nil
+}
+
+func groupName(group, name string) string {
+	return fmt.Sprintf("redrive.%s.%s", group, name)
+}
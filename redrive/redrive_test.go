@@ -0,0 +1,283 @@
+package redrive
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/Shopify/sarama"
+	"github.com/go-test/deep"
+
+	"github.com/inviqa/kafka-consumer-go/config"
+	"github.com/inviqa/kafka-consumer-go/data/failure/model"
+	"github.com/inviqa/kafka-consumer-go/log"
+	"github.com/inviqa/kafka-consumer-go/test/saramatest"
+)
+
+const dlTopic = "deadLetter.group.product"
+
+type fakeOffsets struct {
+	oldest, newest map[int32]int64
+}
+
+func (f fakeOffsets) GetOffset(topic string, partition int32, time int64) (int64, error) {
+	if time == sarama.OffsetOldest {
+		return f.oldest[partition], nil
+	}
+	return f.newest[partition], nil
+}
+
+type fakeConsumer struct {
+	sarama.Consumer
+	messages map[int32][]*sarama.ConsumerMessage
+	started  map[int32]int64
+}
+
+func (c *fakeConsumer) Partitions(topic string) ([]int32, error) {
+	return []int32{0, 1}, nil
+}
+
+func (c *fakeConsumer) ConsumePartition(topic string, partition int32, offset int64) (sarama.PartitionConsumer, error) {
+	c.started[partition] = offset
+	ch := make(chan *sarama.ConsumerMessage, len(c.messages[partition]))
+	for _, m := range c.messages[partition] {
+		if m.Offset >= offset {
+			ch <- m
+		}
+	}
+	return &fakePartitionConsumer{messages: ch}, nil
+}
+
+type fakePartitionConsumer struct {
+	sarama.PartitionConsumer
+	messages chan *sarama.ConsumerMessage
+}
+
+func (pc *fakePartitionConsumer) Messages() <-chan *sarama.ConsumerMessage { return pc.messages }
+func (pc *fakePartitionConsumer) Errors() <-chan *sarama.ConsumerError     { return nil }
+func (pc *fakePartitionConsumer) AsyncClose()                              {}
+
+type fakeOffsetManager struct {
+	committed map[int32]int64
+	closed    bool
+}
+
+func (om *fakeOffsetManager) ManagePartition(topic string, partition int32) (sarama.PartitionOffsetManager, error) {
+	return &fakePartitionOffsetManager{om: om, partition: partition}, nil
+}
+
+func (om *fakeOffsetManager) Close() error {
+	om.closed = true
+	return nil
+}
+
+func (om *fakeOffsetManager) Commit() {}
+
+type fakePartitionOffsetManager struct {
+	sarama.PartitionOffsetManager
+	om        *fakeOffsetManager
+	partition int32
+}
+
+func (pom *fakePartitionOffsetManager) NextOffset() (int64, string) {
+	if o, ok := pom.om.committed[pom.partition]; ok {
+		return o, ""
+	}
+	return sarama.OffsetOldest, ""
+}
+
+func (pom *fakePartitionOffsetManager) MarkOffset(offset int64, metadata string) {
+	pom.om.committed[pom.partition] = offset
+}
+
+func (pom *fakePartitionOffsetManager) Close() error { return nil }
+
+func newTestRedriver(t *testing.T, om *fakeOffsetManager, sp sarama.SyncProducer) (*Redriver, *fakeConsumer, *string) {
+	cfg, err := config.NewBuilder().
+		SetKafkaHost([]string{"broker1"}).
+		SetKafkaGroup("group").
+		SetSourceTopics([]string{"product"}).
+		SetRetryIntervals([]int{60}).
+		Config()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	con := &fakeConsumer{
+		messages: map[int32][]*sarama.ConsumerMessage{
+			0: {
+				{Topic: dlTopic, Partition: 0, Offset: 5, Key: []byte("SKU-1"), Value: []byte("one"), Headers: []*sarama.RecordHeader{
+					{Key: []byte("traceparent"), Value: []byte("00-abc-def-01")},
+					{Key: []byte(model.HeaderAttempts), Value: []byte("2")},
+					{Key: []byte(model.HeaderFailureReason), Value: []byte("oops")},
+				}},
+				{Topic: dlTopic, Partition: 0, Offset: 6, Key: []byte("SKU-2"), Value: []byte("two")},
+			},
+			1: {
+				{Topic: dlTopic, Partition: 1, Offset: 0, Key: []byte("SKU-1"), Value: []byte("three")},
+			},
+		},
+		started: map[int32]int64{},
+	}
+	offsets := fakeOffsets{
+		oldest: map[int32]int64{0: 5, 1: 0},
+		newest: map[int32]int64{0: 7, 1: 1},
+	}
+
+	var group string
+	r := newRedriver(cfg, offsets, con, sp, func(g string) (sarama.OffsetManager, error) {
+		group = g
+		return om, nil
+	}, log.NullLogger{})
+
+	return r, con, &group
+}
+
+func TestRedriver_Redrive(t *testing.T) {
+	t.Run("all messages are republished to the source topic and progress is committed", func(t *testing.T) {
+		om := &fakeOffsetManager{committed: map[int32]int64{}}
+		sp := saramatest.NewMockSyncProducer()
+		r, _, group := newTestRedriver(t, om, sp)
+
+		res, err := r.Redrive(context.Background(), "product", Options{Name: "fix-123"})
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+
+		if diff := deep.Equal(Result{Scanned: 3, Matched: 3, Republished: 3}, res); diff != nil {
+			t.Error(diff)
+		}
+		if *group != "redrive.group.fix-123" {
+			t.Errorf("expected progress to be committed for group 'redrive.group.fix-123', but got '%s'", *group)
+		}
+		if diff := deep.Equal(map[int32]int64{0: 7, 1: 1}, om.committed); diff != nil {
+			t.Error(diff)
+		}
+		if !om.closed {
+			t.Error("expected the offset manager to be closed")
+		}
+
+		msgs := sp.GetMessagesReceived("product")
+		if len(msgs) != 3 {
+			t.Fatalf("expected 3 messages to be republished, but got %d", len(msgs))
+		}
+		key, _ := msgs[0].Key.Encode()
+		value, _ := msgs[0].Value.Encode()
+		if string(key) != "SKU-1" || string(value) != "one" {
+			t.Errorf("expected the key and value to be preserved, but got '%s' and '%s'", key, value)
+		}
+		expHeaders := []sarama.RecordHeader{{Key: []byte("traceparent"), Value: []byte("00-abc-def-01")}}
+		if diff := deep.Equal(expHeaders, msgs[0].Headers); diff != nil {
+			t.Error(diff)
+		}
+	})
+
+	t.Run("only matching messages are republished", func(t *testing.T) {
+		om := &fakeOffsetManager{committed: map[int32]int64{}}
+		sp := saramatest.NewMockSyncProducer()
+		r, _, _ := newTestRedriver(t, om, sp)
+
+		res, err := r.Redrive(context.Background(), "product", Options{Name: "fix-123", Filter: Filter{Key: []byte("SKU-1")}})
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+
+		if diff := deep.Equal(Result{Scanned: 3, Matched: 2, Republished: 2}, res); diff != nil {
+			t.Error(diff)
+		}
+		if got := len(sp.GetMessagesReceived("product")); got != 2 {
+			t.Errorf("expected 2 messages to be republished, but got %d", got)
+		}
+	})
+
+	t.Run("an interrupted redrive resumes from its committed progress", func(t *testing.T) {
+		om := &fakeOffsetManager{committed: map[int32]int64{0: 6, 1: 1}}
+		sp := saramatest.NewMockSyncProducer()
+		r, con, _ := newTestRedriver(t, om, sp)
+
+		res, err := r.Redrive(context.Background(), "product", Options{Name: "fix-123"})
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+
+		if diff := deep.Equal(Result{Scanned: 1, Matched: 1, Republished: 1}, res); diff != nil {
+			t.Error(diff)
+		}
+		if diff := deep.Equal(map[int32]int64{0: 6}, con.started); diff != nil {
+			t.Error(diff)
+		}
+	})
+
+	t.Run("a dry run previews matches without republishing or committing", func(t *testing.T) {
+		om := &fakeOffsetManager{committed: map[int32]int64{}}
+		sp := saramatest.NewMockSyncProducer()
+		r, _, _ := newTestRedriver(t, om, sp)
+
+		var previewed []string
+		res, err := r.Redrive(context.Background(), "product", Options{
+			Name:    "fix-123",
+			Filter:  Filter{Key: []byte("SKU-2")},
+			DryRun:  true,
+			OnMatch: func(msg *sarama.ConsumerMessage) { previewed = append(previewed, string(msg.Value)) },
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+
+		if diff := deep.Equal(Result{Scanned: 3, Matched: 1}, res); diff != nil {
+			t.Error(diff)
+		}
+		if diff := deep.Equal([]string{"two"}, previewed); diff != nil {
+			t.Error(diff)
+		}
+		if len(sp.GetMessagesReceived("product")) != 0 {
+			t.Error("expected no messages to be republished")
+		}
+		if len(om.committed) != 0 {
+			t.Errorf("expected no progress to be committed, but got %v", om.committed)
+		}
+	})
+
+	t.Run("an error republishing stops the redrive", func(t *testing.T) {
+		om := &fakeOffsetManager{committed: map[int32]int64{}}
+		sp := saramatest.NewMockSyncProducer()
+		sp.ReturnErrorOnSend()
+		r, _, _ := newTestRedriver(t, om, sp)
+
+		res, err := r.Redrive(context.Background(), "product", Options{Name: "fix-123"})
+		if err == nil {
+			t.Fatal("expected an error but got nil")
+		}
+		if res.Republished != 0 || len(om.committed) != 0 {
+			t.Errorf("expected nothing to be republished or committed, but got %+v and %v", res, om.committed)
+		}
+	})
+
+	t.Run("invalid options", func(t *testing.T) {
+		r, _, _ := newTestRedriver(t, &fakeOffsetManager{committed: map[int32]int64{}}, saramatest.NewMockSyncProducer())
+
+		for _, tc := range []struct {
+			topic string
+			opts  Options
+		}{
+			{topic: "product", opts: Options{}},
+			{topic: "retry1.group.product", opts: Options{Name: "fix-123"}},
+			{topic: "missing", opts: Options{Name: "fix-123"}},
+		} {
+			if _, err := r.Redrive(context.Background(), tc.topic, tc.opts); err == nil {
+				t.Errorf("expected an error for topic '%s' and options %+v, but got nil", tc.topic, tc.opts)
+			}
+		}
+	})
+
+	t.Run("a cancelled context stops the redrive", func(t *testing.T) {
+		r, _, _ := newTestRedriver(t, &fakeOffsetManager{committed: map[int32]int64{}}, saramatest.NewMockSyncProducer())
+		r.consumer.(*fakeConsumer).messages = map[int32][]*sarama.ConsumerMessage{}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		if _, err := r.Redrive(ctx, "product", Options{Name: "fix-123"}); !errors.Is(err, context.Canceled) {
+			t.Errorf("expected a context cancelled error, but got %v", err)
+		}
+	})
+}
@@ -0,0 +1,130 @@
+package consumer
+
+import (
+	"sync"
+	"time"
+)
+
+// Status is a snapshot of the state of a running Consumer.
+type Status struct {
+	// Running is true between the consumer being started and it stopping.
+	Running bool
+	// ActiveSessions is the number of consumer group sessions that are currently established.
+	ActiveSessions int
+	// AssignedPartitions are the partitions currently claimed by this consumer, indexed by topic.
+	AssignedPartitions map[string][]int32
+	// ActiveRetryProcessors is the number of DB retry processors that are currently running.
+	ActiveRetryProcessors int
+	// FailureProducerRunning is true whilst the producer that sends failed messages for retry is running.
+	FailureProducerRunning bool
+	// LastError is the most recent error encountered whilst consuming, if any.
+	LastError error
+	// LastErrorAt is when LastError was encountered.
+	LastErrorAt time.Time
+}
+
+// statusTracker records the state of the consumer as it runs, and is shared between the
+// components that make up a Consumer.
+type statusTracker struct {
+	sync.RWMutex
+	running                bool
+	sessions               int
+	assigned               map[string][]int32
+	activeRetryProcessors  int
+	failureProducerRunning bool
+	failureProducerStarted bool
+	lastError              error
+	lastErrorAt            time.Time
+}
+
+func newStatusTracker() *statusTracker {
+	return &statusTracker{
+		assigned: map[string][]int32{},
+	}
+}
+
+func (s *statusTracker) setRunning(running bool) {
+	s.Lock()
+	defer s.Unlock()
+	s.running = running
+}
+
+// partitionsAssigned records the start of a consumer group session and its claims. Each consumer group
+// consumes its own set of topics, so the claims for those topics are replaced.
+func (s *statusTracker) partitionsAssigned(claims map[string][]int32) {
+	s.Lock()
+	defer s.Unlock()
+	s.sessions++
+	for topic, partitions := range claims {
+		s.assigned[topic] = append([]int32(nil), partitions...)
+	}
+}
+
+func (s *statusTracker) partitionsRevoked(claims map[string][]int32) {
+	s.Lock()
+	defer s.Unlock()
+	s.sessions--
+	for topic := range claims {
+		delete(s.assigned, topic)
+	}
+}
+
+func (s *statusTracker) retryProcessorStarted() {
+	s.Lock()
+	defer s.Unlock()
+	s.activeRetryProcessors++
+}
+
+func (s *statusTracker) retryProcessorStopped() {
+	s.Lock()
+	defer s.Unlock()
+	s.activeRetryProcessors--
+}
+
+func (s *statusTracker) setFailureProducerRunning(running bool) {
+	s.Lock()
+	defer s.Unlock()
+	s.failureProducerRunning = running
+	if running {
+		s.failureProducerStarted = true
+	}
+}
+
+// failureProducerStopped returns true if the failure producer has stopped after being started,
+// as opposed to not having been started yet.
+func (s *statusTracker) failureProducerStopped() bool {
+	s.RLock()
+	defer s.RUnlock()
+	return s.failureProducerStarted && !s.failureProducerRunning
+}
+
+func (s *statusTracker) recordError(err error) {
+	if err == nil {
+		return
+	}
+
+	s.Lock()
+	defer s.Unlock()
+	s.lastError = err
+	s.lastErrorAt = time.Now()
+}
+
+func (s *statusTracker) snapshot() Status {
+	s.RLock()
+	defer s.RUnlock()
+
+	assigned := make(map[string][]int32, len(s.assigned))
+	for topic, partitions := range s.assigned {
+		assigned[topic] = append([]int32(nil), partitions...)
+	}
+
+	return Status{
+		Running:                s.running,
+		ActiveSessions:         s.sessions,
+		AssignedPartitions:     assigned,
+		ActiveRetryProcessors:  s.activeRetryProcessors,
+		FailureProducerRunning: s.failureProducerRunning,
+		LastError:              s.lastError,
+		LastErrorAt:            s.lastErrorAt,
+	}
+}
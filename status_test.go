@@ -0,0 +1,43 @@
+package consumer
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/go-test/deep"
+)
+
+func TestStatusTracker(t *testing.T) {
+	s := newStatusTracker()
+	s.setRunning(true)
+	s.partitionsAssigned(map[string][]int32{"product": {0, 1}, "retry1.product": {2}})
+	s.partitionsRevoked(map[string][]int32{"retry1.product": {2}})
+	s.retryProcessorStarted()
+	s.retryProcessorStarted()
+	s.retryProcessorStopped()
+	s.setFailureProducerRunning(true)
+	s.recordError(nil)
+
+	exp := Status{
+		Running:                true,
+		ActiveSessions:         0,
+		AssignedPartitions:     map[string][]int32{"product": {0, 1}},
+		ActiveRetryProcessors:  1,
+		FailureProducerRunning: true,
+	}
+	if diff := deep.Equal(exp, s.snapshot()); diff != nil {
+		t.Error(diff)
+	}
+
+	err := errors.New("oops")
+	s.recordError(err)
+	got := s.snapshot()
+	if got.LastError != err || got.LastErrorAt.IsZero() {
+		t.Errorf("expected the last error to be recorded, but got %v at %s", got.LastError, got.LastErrorAt)
+	}
+
+	got.AssignedPartitions["product"][0] = 5
+	if s.snapshot().AssignedPartitions["product"][0] != 0 {
+		t.Error("expected the snapshot to be a copy")
+	}
+}
@@ -36,30 +36,38 @@ func NewMockConsumerGroup() *MockConsumerGroup {
 
 func (mg *MockConsumerGroup) Consume(ctx context.Context, topics []string, handler sarama.ConsumerGroupHandler) error {
 	mg.Lock()
-	defer mg.Unlock()
-
-	if mg.consumed {
+	var pending []string
+	for _, topic := range topics {
+		if mg.consumedTopicCount[topic] == 0 {
+			pending = append(pending, topic)
+		}
+	}
+	if len(pending) == 0 {
+		mg.Unlock()
+		// a real session lasts until it is cancelled or the group rebalances, so rather than
+		// returning straight away, which would have callers consume in a busy loop, we wait
+		<-ctx.Done()
 		return nil
 	}
+	defer mg.Unlock()
 	mg.consumed = true
 
+	for _, topic := range pending {
+		mg.consumedTopicCount[topic]++
+	}
+
 	if mg.errorOnConsume {
 		return errors.New("something bad happened")
 	}
 
-	for _, topic := range topics {
-		_, ok := mg.consumedTopicCount[topic]
-		if !ok {
-			mg.consumedTopicCount[topic] = 0
-		}
-		mg.consumedTopicCount[topic]++
-
+	for _, topic := range pending {
 		msgsToConsume := mg.messagesToConsumeForTopic(topic)
 		if len(msgsToConsume) == 0 {
 			continue
 		}
 		session := NewMockConsumerGroupSession()
 		claim := NewMockConsumerGroupClaim()
+		claim.SetTopic(topic)
 		for _, msg := range msgsToConsume {
 			claim.PublishMessage(msg)
 		}
@@ -106,6 +114,9 @@ func (mg *MockConsumerGroup) ErrorOnConsume() {
 }
 
 func (mg *MockConsumerGroup) Consumed() bool {
+	mg.RLock()
+	defer mg.RUnlock()
+
 	return mg.consumed
 }
 
@@ -3,7 +3,9 @@ package saramatest
 import "github.com/Shopify/sarama"
 
 type MockConsumerGroupClaim struct {
-	Chan chan *sarama.ConsumerMessage
+	Chan  chan *sarama.ConsumerMessage
+	topic string
+	hwm   int64
 }
 
 func NewMockConsumerGroupClaim() *MockConsumerGroupClaim {
@@ -13,7 +15,11 @@ func NewMockConsumerGroupClaim() *MockConsumerGroupClaim {
 }
 
 func (gc MockConsumerGroupClaim) Topic() string {
-	return ""
+	return gc.topic
+}
+
+func (gc *MockConsumerGroupClaim) SetTopic(topic string) {
+	gc.topic = topic
 }
 
 func (gc MockConsumerGroupClaim) Partition() int32 {
@@ -25,7 +31,11 @@ func (gc MockConsumerGroupClaim) InitialOffset() int64 {
 }
 
 func (gc MockConsumerGroupClaim) HighWaterMarkOffset() int64 {
-	return 0
+	return gc.hwm
+}
+
+func (gc *MockConsumerGroupClaim) SetHighWaterMarkOffset(hwm int64) {
+	gc.hwm = hwm
 }
 
 func (gc MockConsumerGroupClaim) Messages() <-chan *sarama.ConsumerMessage {
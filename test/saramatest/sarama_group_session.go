@@ -10,17 +10,23 @@ import (
 type MockConsumerGroupSession struct {
 	sync.RWMutex
 	marked []*sarama.ConsumerMessage
+	claims map[string][]int32
 	ctx    context.Context
 }
 
 func NewMockConsumerGroupSession() *MockConsumerGroupSession {
 	return &MockConsumerGroupSession{
-		ctx: context.Background(),
+		claims: map[string][]int32{},
+		ctx:    context.Background(),
 	}
 }
 
 func (gs *MockConsumerGroupSession) Claims() map[string][]int32 {
-	return map[string][]int32{}
+	return gs.claims
+}
+
+func (gs *MockConsumerGroupSession) SetClaims(claims map[string][]int32) {
+	gs.claims = claims
 }
 
 func (gs *MockConsumerGroupSession) MemberID() string {
@@ -59,6 +65,17 @@ func (gs *MockConsumerGroupSession) MessageWasMarked(msg *sarama.ConsumerMessage
 	return false
 }
 
+// MarkedMessages returns the messages that have been marked, in the order that they were marked.
+func (gs *MockConsumerGroupSession) MarkedMessages() []*sarama.ConsumerMessage {
+	gs.RLock()
+	defer gs.RUnlock()
+
+	marked := make([]*sarama.ConsumerMessage, len(gs.marked))
+	copy(marked, gs.marked)
+
+	return marked
+}
+
 func (gs *MockConsumerGroupSession) Context() context.Context {
 	gs.RLock()
 	defer gs.RUnlock()
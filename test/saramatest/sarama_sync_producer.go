@@ -8,12 +8,14 @@ import (
 
 type MockSyncProducer struct {
 	recvd       map[string][][]byte
+	recvdMsgs   map[string][]*sarama.ProducerMessage
 	returnError bool
 }
 
 func NewMockSyncProducer() *MockSyncProducer {
 	return &MockSyncProducer{
-		recvd: map[string][][]byte{},
+		recvd:     map[string][][]byte{},
+		recvdMsgs: map[string][]*sarama.ProducerMessage{},
 	}
 }
 
@@ -28,6 +30,7 @@ func (p *MockSyncProducer) SendMessage(msg *sarama.ProducerMessage) (partition i
 	}
 
 	p.recvd[msg.Topic] = append(p.recvd[msg.Topic], b)
+	p.recvdMsgs[msg.Topic] = append(p.recvdMsgs[msg.Topic], msg)
 
 	return 0, 0, nil
 }
@@ -51,3 +54,8 @@ func (p *MockSyncProducer) GetLastMessageReceived(topic string) []byte {
 
 	return p.recvd[topic][0]
 }
+
+// GetMessagesReceived returns all the messages sent to the given topic.
+func (p *MockSyncProducer) GetMessagesReceived(topic string) []*sarama.ProducerMessage {
+	return p.recvdMsgs[topic]
+}
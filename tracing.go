@@ -0,0 +1,145 @@
+package consumer
+
+import (
+	"context"
+
+	"github.com/Shopify/sarama"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.10.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "github.com/inviqa/kafka-consumer-go"
+
+// WithTracerProvider sets the provider used to create a span for each handler invocation. By
+// default, the global provider returned from otel.GetTracerProvider() is used.
+func WithTracerProvider(tp trace.TracerProvider) Option {
+	return func(o *options) {
+		o.tracerProvider = tp
+	}
+}
+
+// WithPropagator sets the propagator used to extract the parent span context from message
+// headers. By default, the global propagator returned from otel.GetTextMapPropagator() is used.
+func WithPropagator(p propagation.TextMapPropagator) Option {
+	return func(o *options) {
+		o.propagator = p
+	}
+}
+
+func (o *options) tracer() trace.Tracer {
+	tp := o.tracerProvider
+	if tp == nil {
+		tp = otel.GetTracerProvider()
+	}
+
+	return tp.Tracer(tracerName)
+}
+
+func (o *options) textMapPropagator() propagation.TextMapPropagator {
+	if o.propagator == nil {
+		return otel.GetTextMapPropagator()
+	}
+
+	return o.propagator
+}
+
+// startHandlerSpan starts a span for handling the message, whose parent is extracted from the
+// message headers. As the headers are carried through the retry topics and the database, every
+// retry attempt belongs to the same trace as the original message.
+func (o *options) startHandlerSpan(ctx context.Context, msg *sarama.ConsumerMessage) (context.Context, trace.Span) {
+	ctx = o.textMapPropagator().Extract(ctx, messageCarrier{msg: msg})
+
+	return o.tracer().Start(ctx, msg.Topic+" process",
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(messageAttributes(msg)...),
+	)
+}
+
+// startBatchSpan starts a span for handling a batch of messages. A batch has no single parent, so
+// the span is linked to the span context extracted from each message instead.
+func (o *options) startBatchSpan(ctx context.Context, msgs []*sarama.ConsumerMessage) (context.Context, trace.Span) {
+	links := make([]trace.Link, 0, len(msgs))
+	for _, msg := range msgs {
+		sc := trace.SpanContextFromContext(o.textMapPropagator().Extract(context.Background(), messageCarrier{msg: msg}))
+		if sc.IsValid() {
+			links = append(links, trace.Link{SpanContext: sc})
+		}
+	}
+
+	return o.tracer().Start(ctx, msgs[0].Topic+" process",
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithLinks(links...),
+		trace.WithAttributes(
+			semconv.MessagingSystemKey.String("kafka"),
+			semconv.MessagingDestinationKindTopic,
+			semconv.MessagingDestinationKey.String(msgs[0].Topic),
+			semconv.MessagingOperationProcess,
+			attribute.Int("messaging.batch.message_count", len(msgs)),
+		),
+	)
+}
+
+func messageAttributes(msg *sarama.ConsumerMessage) []attribute.KeyValue {
+	attrs := []attribute.KeyValue{
+		semconv.MessagingSystemKey.String("kafka"),
+		semconv.MessagingDestinationKindTopic,
+		semconv.MessagingDestinationKey.String(msg.Topic),
+		semconv.MessagingOperationProcess,
+		semconv.MessagingKafkaPartitionKey.Int64(int64(msg.Partition)),
+		attribute.Int64("messaging.kafka.message.offset", msg.Offset),
+	}
+	if len(msg.Key) > 0 {
+		attrs = append(attrs, semconv.MessagingKafkaMessageKeyKey.String(string(msg.Key)))
+	}
+
+	return attrs
+}
+
+// endSpan records the outcome of a handler on the span, and ends it.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// messageCarrier adapts the headers of a sarama.ConsumerMessage to a propagation.TextMapCarrier.
+type messageCarrier struct {
+	msg *sarama.ConsumerMessage
+}
+
+func (c messageCarrier) Get(key string) string {
+	for _, h := range c.msg.Headers {
+		if h != nil && string(h.Key) == key {
+			return string(h.Value)
+		}
+	}
+
+	return ""
+}
+
+func (c messageCarrier) Set(key, value string) {
+	for _, h := range c.msg.Headers {
+		if h != nil && string(h.Key) == key {
+			h.Value = []byte(value)
+			return
+		}
+	}
+	c.msg.Headers = append(c.msg.Headers, &sarama.RecordHeader{Key: []byte(key), Value: []byte(value)})
+}
+
+func (c messageCarrier) Keys() []string {
+	keys := make([]string, 0, len(c.msg.Headers))
+	for _, h := range c.msg.Headers {
+		if h != nil {
+			keys = append(keys, string(h.Key))
+		}
+	}
+
+	return keys
+}
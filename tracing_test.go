@@ -0,0 +1,184 @@
+package consumer
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/Shopify/sarama"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/inviqa/kafka-consumer-go/data/failure/model"
+	retrymodel "github.com/inviqa/kafka-consumer-go/data/retry/model"
+	"github.com/inviqa/kafka-consumer-go/log"
+	"github.com/inviqa/kafka-consumer-go/test/saramatest"
+)
+
+const (
+	testTraceID     = "4bf92f3577b34da6a3ce929d0e0e4736"
+	testParentSpan  = "00f067aa0ba902b7"
+	testTraceparent = "00-" + testTraceID + "-" + testParentSpan + "-01"
+)
+
+func newTestTracingOptions(exp *tracetest.InMemoryExporter, opts ...Option) *options {
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exp))
+
+	return newOptions(append([]Option{WithTracerProvider(tp), WithPropagator(propagation.TraceContext{})}, opts...)...)
+}
+
+func TestConsumer_ConsumeClaim_StartsSpanFromMessageHeaders(t *testing.T) {
+	exp := tracetest.NewInMemoryExporter()
+	opts := newTestTracingOptions(exp)
+
+	var handlerSpan trace.SpanContext
+	hs := HandlerMap{"product": func(ctx context.Context, msg *sarama.ConsumerMessage) error {
+		handlerSpan = trace.SpanContextFromContext(ctx)
+		return errors.New("oops")
+	}}
+
+	gs := saramatest.NewMockConsumerGroupSession()
+	gc := saramatest.NewMockConsumerGroupClaim()
+	gc.PublishMessage(&sarama.ConsumerMessage{
+		Topic:   "product",
+		Headers: []*sarama.RecordHeader{{Key: []byte("traceparent"), Value: []byte(testTraceparent)}},
+	})
+	gc.CloseChannel()
+
+	con := newConsumer(make(chan model.Failure, 1), newTestConfig(), hs, log.NullLogger{}, opts)
+	if err := con.ConsumeClaim(gs, gc); err != nil {
+		t.Fatalf("unexpected error occurred: %s", err)
+	}
+
+	spans := exp.GetSpans()
+	if len(spans) != 1 {
+		t.Fatalf("expected 1 span, but got %d", len(spans))
+	}
+
+	span := spans[0]
+	if span.SpanContext.TraceID().String() != testTraceID {
+		t.Errorf("expected the span to belong to trace %s, but got %s", testTraceID, span.SpanContext.TraceID())
+	}
+	if span.Parent.SpanID().String() != testParentSpan {
+		t.Errorf("expected the span's parent to be %s, but got %s", testParentSpan, span.Parent.SpanID())
+	}
+	if span.SpanKind != trace.SpanKindConsumer {
+		t.Errorf("expected a consumer span, but got %s", span.SpanKind)
+	}
+	if span.Status.Code != codes.Error {
+		t.Errorf("expected the span status to be an error, but got %s", span.Status.Code)
+	}
+	if handlerSpan.SpanID() != span.SpanContext.SpanID() {
+		t.Error("expected the handler context to contain the span")
+	}
+}
+
+func TestTracing_RetryChainKeepsTrace(t *testing.T) {
+	exp := tracetest.NewInMemoryExporter()
+	opts := newTestTracingOptions(exp)
+	cfg := newTestConfig()
+
+	fch := make(chan model.Failure, 1)
+	hs := HandlerMap{"product": func(ctx context.Context, msg *sarama.ConsumerMessage) error {
+		return errors.New("oops")
+	}}
+	con := newConsumer(fch, cfg, hs, log.NullLogger{}, opts).(*consumer)
+
+	original := &sarama.ConsumerMessage{
+		Topic:   "product",
+		Headers: []*sarama.RecordHeader{{Key: []byte("traceparent"), Value: []byte(testTraceparent)}},
+	}
+	con.handleMessage(context.Background(), hs["product"], original)
+	failure := <-fch
+
+	t.Run("via a Kafka retry topic", func(t *testing.T) {
+		exp.Reset()
+		sp := saramatest.NewMockSyncProducer()
+		newKafkaFailureProducer(cfg, sp, make(chan model.Failure), log.NullLogger{}).publishFailure(failure)
+
+		published := sp.GetMessagesReceived("retry.kafkaGroup.product")
+		if len(published) != 1 {
+			t.Fatalf("expected 1 message to be published to the retry topic, but got %d", len(published))
+		}
+
+		retried := &sarama.ConsumerMessage{Topic: "retry.kafkaGroup.product"}
+		for _, h := range published[0].Headers {
+			h := h
+			retried.Headers = append(retried.Headers, &h)
+		}
+		con.handleMessage(context.Background(), hs["product"], retried)
+		<-fch
+
+		assertSingleSpanInTestTrace(t, exp)
+	})
+
+	t.Run("via the database", func(t *testing.T) {
+		exp.Reset()
+		retry := retrymodel.Retry{Topic: failure.Topic, PayloadHeaders: failure.MessageHeaders}
+		col := &kafkaConsumerDbCollection{
+			cfg:          cfg,
+			retryManager: newMockRetryManager(false),
+			opts:         opts,
+			logger:       log.NullLogger{},
+		}
+		col.processRetry(context.Background(), hs["product"], "product", "retry1", retry)
+
+		assertSingleSpanInTestTrace(t, exp)
+	})
+}
+
+func assertSingleSpanInTestTrace(t *testing.T, exp *tracetest.InMemoryExporter) {
+	t.Helper()
+
+	spans := exp.GetSpans()
+	if len(spans) != 1 {
+		t.Fatalf("expected 1 span, but got %d", len(spans))
+	}
+	if got := spans[0].SpanContext.TraceID().String(); got != testTraceID {
+		t.Errorf("expected the retry span to belong to trace %s, but got %s", testTraceID, got)
+	}
+}
+
+func TestConsumer_HandleBatch_LinksMessageSpans(t *testing.T) {
+	exp := tracetest.NewInMemoryExporter()
+	opts := newTestTracingOptions(exp)
+	con := newConsumer(make(chan model.Failure, 2), newTestConfig(), HandlerMap{}, log.NullLogger{}, opts).(*consumer)
+
+	batch := []*sarama.ConsumerMessage{
+		{Topic: "product", Headers: []*sarama.RecordHeader{{Key: []byte("traceparent"), Value: []byte(testTraceparent)}}},
+		{Topic: "product"},
+	}
+	con.handleBatch(context.Background(), func(ctx context.Context, msgs []*sarama.ConsumerMessage) error {
+		return nil
+	}, batch)
+
+	spans := exp.GetSpans()
+	if len(spans) != 1 {
+		t.Fatalf("expected 1 span, but got %d", len(spans))
+	}
+	if len(spans[0].Links) != 1 || spans[0].Links[0].SpanContext.TraceID().String() != testTraceID {
+		t.Errorf("expected the batch span to be linked to the message's trace, but got links %v", spans[0].Links)
+	}
+}
+
+func TestMessageCarrier(t *testing.T) {
+	msg := &sarama.ConsumerMessage{}
+	c := messageCarrier{msg: msg}
+
+	c.Set("traceparent", "a")
+	c.Set("traceparent", "b")
+	c.Set("tracestate", "c")
+
+	if got := c.Get("traceparent"); got != "b" {
+		t.Errorf("expected 'b', but got '%s'", got)
+	}
+	if got := c.Get("missing"); got != "" {
+		t.Errorf("expected an empty value, but got '%s'", got)
+	}
+	if got := c.Keys(); len(got) != 2 {
+		t.Errorf("expected 2 keys, but got %v", got)
+	}
+}
@@ -0,0 +1,123 @@
+package consumer
+
+import (
+	"hash/fnv"
+	"sync"
+
+	"github.com/Shopify/sarama"
+)
+
+// keyedWorkerPool runs submitted jobs on a fixed number of workers. Jobs submitted with the
+// same key are always run by the same worker, in the order that they were submitted, so that
+// messages sharing a key are processed in order whilst messages with different keys can be
+// processed in parallel. Jobs without a key are distributed across the workers in turn.
+type keyedWorkerPool struct {
+	queues []chan func()
+	next   int
+	wg     sync.WaitGroup
+}
+
+func newKeyedWorkerPool(size int) *keyedWorkerPool {
+	if size < 1 {
+		size = 1
+	}
+
+	p := &keyedWorkerPool{
+		queues: make([]chan func(), size),
+	}
+
+	for i := range p.queues {
+		q := make(chan func())
+		p.queues[i] = q
+
+		p.wg.Add(1)
+		go func() {
+			defer p.wg.Done()
+			for job := range q {
+				job()
+			}
+		}()
+	}
+
+	return p
+}
+
+// submit queues the job on the worker responsible for the given key. It blocks whilst
+// that worker is busy, which provides back-pressure to the caller.
+func (p *keyedWorkerPool) submit(key []byte, job func()) {
+	p.queues[p.workerFor(key)] <- job
+}
+
+// close stops accepting jobs, without waiting for submitted jobs to finish. The pool cannot be
+// used after calling close.
+func (p *keyedWorkerPool) close() {
+	for _, q := range p.queues {
+		close(q)
+	}
+}
+
+// wait stops accepting jobs and blocks until all submitted jobs have finished. The pool
+// cannot be used after calling wait.
+func (p *keyedWorkerPool) wait() {
+	p.close()
+	p.wg.Wait()
+}
+
+func (p *keyedWorkerPool) workerFor(key []byte) int {
+	if len(key) == 0 {
+		w := p.next
+		p.next = (p.next + 1) % len(p.queues)
+		return w
+	}
+
+	h := fnv.New32a()
+	_, _ = h.Write(key)
+	return int(h.Sum32() % uint32(len(p.queues)))
+}
+
+// offsetTracker tracks messages from a single partition that are being processed concurrently,
+// so that a message is only marked as processed once it, and every message before it in the
+// partition, has finished processing.
+type offsetTracker struct {
+	sync.Mutex
+	inFlight []*trackedMessage
+	mark     func(msg *sarama.ConsumerMessage)
+}
+
+type trackedMessage struct {
+	msg  *sarama.ConsumerMessage
+	done bool
+}
+
+func newOffsetTracker(mark func(msg *sarama.ConsumerMessage)) *offsetTracker {
+	return &offsetTracker{
+		mark: mark,
+	}
+}
+
+// add registers a message as in-flight. Messages must be added in the order that they were
+// received from the partition.
+func (t *offsetTracker) add(msg *sarama.ConsumerMessage) *trackedMessage {
+	t.Lock()
+	defer t.Unlock()
+
+	tm := &trackedMessage{msg: msg}
+	t.inFlight = append(t.inFlight, tm)
+
+	return tm
+}
+
+// complete flags the message as processed, and then marks every contiguous processed message
+// from the start of the in-flight list.
+func (t *offsetTracker) complete(tm *trackedMessage) {
+	t.Lock()
+	defer t.Unlock()
+
+	tm.done = true
+
+	i := 0
+	for ; i < len(t.inFlight) && t.inFlight[i].done; i++ {
+		t.mark(t.inFlight[i].msg)
+	}
+	t.inFlight = t.inFlight[i:]
+}
@@ -0,0 +1,103 @@
+package consumer
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/go-test/deep"
+)
+
+func TestKeyedWorkerPool(t *testing.T) {
+	t.Run("jobs with the same key are run in order", func(t *testing.T) {
+		pool := newKeyedWorkerPool(4)
+
+		var mu sync.Mutex
+		var got []int
+		for i := 0; i < 10; i++ {
+			i := i
+			pool.submit([]byte("SKU-123"), func() {
+				// earlier jobs take longer, so any parallelism would reorder them
+				time.Sleep(time.Millisecond * time.Duration(10-i))
+				mu.Lock()
+				got = append(got, i)
+				mu.Unlock()
+			})
+		}
+		pool.wait()
+
+		exp := []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}
+		if diff := deep.Equal(exp, got); diff != nil {
+			t.Error(diff)
+		}
+	})
+
+	t.Run("jobs with different keys are run in parallel", func(t *testing.T) {
+		pool := newKeyedWorkerPool(2)
+		release := make(chan struct{})
+		finished := make(chan struct{})
+
+		// find two keys that are handled by different workers
+		keyA, keyB := []byte("a"), []byte("b")
+		for i := 0; pool.workerFor(keyA) == pool.workerFor(keyB); i++ {
+			keyB = []byte{byte('b' + i)}
+		}
+
+		pool.submit(keyA, func() {
+			<-release
+		})
+		pool.submit(keyB, func() {
+			close(finished)
+		})
+
+		select {
+		case <-finished:
+		case <-time.After(time.Second):
+			t.Error("job for second key was blocked by the job for the first key")
+		}
+
+		close(release)
+		pool.wait()
+	})
+
+	t.Run("jobs without a key are distributed across workers", func(t *testing.T) {
+		pool := newKeyedWorkerPool(3)
+		defer pool.wait()
+
+		var got []int
+		for i := 0; i < 4; i++ {
+			got = append(got, pool.workerFor(nil))
+		}
+
+		if diff := deep.Equal([]int{0, 1, 2, 0}, got); diff != nil {
+			t.Error(diff)
+		}
+	})
+}
+
+func TestOffsetTracker(t *testing.T) {
+	var marked []int64
+	tracker := newOffsetTracker(func(msg *sarama.ConsumerMessage) {
+		marked = append(marked, msg.Offset)
+	})
+
+	tm1 := tracker.add(&sarama.ConsumerMessage{Offset: 1})
+	tm2 := tracker.add(&sarama.ConsumerMessage{Offset: 2})
+	tm3 := tracker.add(&sarama.ConsumerMessage{Offset: 3})
+
+	tracker.complete(tm3)
+	tracker.complete(tm2)
+	if len(marked) != 0 {
+		t.Fatalf("expected no offsets to be marked whilst offset 1 is in-flight, but got %v", marked)
+	}
+
+	tracker.complete(tm1)
+	if diff := deep.Equal([]int64{1, 2, 3}, marked); diff != nil {
+		t.Error(diff)
+	}
+
+	if len(tracker.inFlight) != 0 {
+		t.Errorf("expected no in-flight messages, but got %d", len(tracker.inFlight))
+	}
+}